@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/Dainerx/wpam/pkg/config_file"
+	"github.com/Dainerx/wpam/pkg/displayer"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	output       = "output"
+	outputTable  = "table"
+	outputJSON   = "json"
+	exitDown     = 1
+	exitNotValid = 2
+)
+
+// checkResult is the result of the one shot check of an instance, response times are in seconds.
+type checkResult struct {
+	Id             string  `json:"id"`
+	Url            string  `json:"url"`
+	Status         string  `json:"status"`
+	HttpStatusCode int     `json:"httpStatusCode"`
+	ResponseTime   float64 `json:"responseTime"`
+	ErrorClass     string  `json:"errorClass,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check [id or url]...",
+	Short: "Checks every instance of the config file once, exits with 1 if some are down",
+	Long: `Checks every instance of the config file once in parallel and prints the results, or only the instances given
+by id. An url not configured is checked with the default settings.
+Exits with 0 if every instance is up, 1 if some are down and 2 if the config file or an instance is not valid
+or if there is nothing to check.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var configuration types.Configuration
+		if configFilePath := viper.GetString(config); configFilePath != "" {
+			var err error
+			if configuration, err = config_file.Read(configFilePath); err != nil {
+				displayer.DisplayError("Failed to read config file: %v.\n", err)
+				os.Exit(exitNotValid)
+			}
+		}
+		// Instances are validated against the bounds of the settings
+		if _, err := applySettings(cmd, configuration.Settings); err != nil {
+			displayer.DisplayError("Settings are not valid: %v.\n", err)
+			os.Exit(exitNotValid)
+		}
+		instances, err := selectInstances(configuration.Input, args)
+		if err != nil {
+			displayer.DisplayError("%v.\n", err)
+			os.Exit(exitNotValid)
+		}
+		results := runChecks(instances)
+		format, _ := cmd.Flags().GetString(output)
+		if format == outputJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(results)
+		} else {
+			writeResults(os.Stdout, results)
+		}
+		os.Exit(exitCode(results))
+	},
+}
+
+// selectInstances returns the instances given by id or url in args, every instance if args is empty.
+// An url not configured is an instance of its own with the default settings.
+// Returns error if an arg is neither a configured id nor an url, or if there is no instance to check.
+func selectInstances(instances []types.Instance, args []string) ([]types.Instance, error) {
+	if len(args) == 0 {
+		if len(instances) == 0 {
+			return nil, ErrNothingToCheck
+		}
+		return instances, nil
+	}
+	var selected []types.Instance
+	for _, arg := range args {
+		found := false
+		for _, instance := range instances {
+			if instance.Id == arg || instance.Url == arg {
+				selected = append(selected, instance)
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		if u, err := url.ParseRequestURI(arg); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("%s is neither the id of an instance nor an url", arg)
+		}
+		selected = append(selected, types.Instance{Id: arg, Url: arg})
+	}
+	return selected, nil
+}
+
+// runChecks checks every instance once in parallel and returns their results in the instances' order.
+// Instances not valid have an error result and are not checked.
+func runChecks(instances []types.Instance) []checkResult {
+	store := safe_store.New()
+	results := make([]checkResult, len(instances))
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		results[i] = checkResult{Id: instance.Id, Url: instance.Url, Status: types.Unkown}
+		checkRequest, err := website_check.NewcheckRequestFromInstance(instance, store)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(result *checkResult) {
+			defer wg.Done()
+			response, err := checkRequest.Response()
+			result.Status = response.Status()
+			result.HttpStatusCode = response.HttpStatusCode()
+			result.ResponseTime = response.ResponseTime().Seconds()
+			result.ErrorClass = response.ErrorClass()
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// Writes the results as a table aligned with spaces.
+func writeResults(w io.Writer, results []checkResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tURL\tSTATUS\tCODE\tRESPONSE TIME\tERROR")
+	for _, result := range results {
+		problem := result.ErrorClass
+		if result.Error != "" {
+			problem = result.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.3fs\t%s\n", result.Id, result.Url, result.Status, result.HttpStatusCode, result.ResponseTime, problem)
+	}
+	tw.Flush()
+}
+
+// Returns the exit code of the results: 2 if an instance is not valid, 1 if one is down, 0 if all are up.
+func exitCode(results []checkResult) int {
+	code := 0
+	for _, result := range results {
+		switch {
+		case result.Status == types.Unkown:
+			return exitNotValid
+		case result.Status != types.Up:
+			code = exitDown
+		}
+	}
+	return code
+}
+
+func init() {
+	checkCmd.Flags().StringP(output, "o", outputTable, "--output json, prints the results as a table or as JSON")
+	rootCmd.AddCommand(checkCmd)
+}
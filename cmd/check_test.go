@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+func TestRunChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	configured := []types.Instance{{Id: "up", Url: server.URL + "/up"}, {Id: "down", Url: server.URL + "/down"}}
+	if _, err := selectInstances(nil, nil); err != ErrNothingToCheck {
+		t.Errorf("selectInstances() without instances = %v, want %v", err, ErrNothingToCheck)
+	}
+	if _, err := selectInstances(configured, []string{"unknown"}); err == nil {
+		t.Error("Unknown id not an url was selected.")
+	}
+	instances, err := selectInstances(configured, []string{"up", server.URL + "/other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 || instances[0].Id != "up" || instances[1].Id != server.URL+"/other" {
+		t.Fatalf("Selected %v", instances)
+	}
+	results := runChecks(instances)
+	if results[0].Status != types.Up || results[1].Status != types.Up {
+		t.Errorf("Results %v, should be up", results)
+	}
+	if code := exitCode(results); code != 0 {
+		t.Errorf("Exit code %d, should be 0", code)
+	}
+
+	results = runChecks(configured)
+	if results[1].Status == types.Up || results[1].HttpStatusCode != http.StatusInternalServerError {
+		t.Errorf("Result %v, should be down", results[1])
+	}
+	if code := exitCode(results); code != exitDown {
+		t.Errorf("Exit code %d, should be %d", code, exitDown)
+	}
+
+	results = runChecks([]types.Instance{{Id: "notvalid", Url: "::"}})
+	if results[0].Error == "" {
+		t.Error("Instance not valid was checked.")
+	}
+	if code := exitCode(results); code != exitNotValid {
+		t.Errorf("Exit code %d, should be %d", code, exitNotValid)
+	}
+}
@@ -0,0 +1,10 @@
+package cmd
+
+import "errors"
+
+var (
+	// ErrSettingNotPositive is returned when a duration of the settings is not positive.
+	ErrSettingNotPositive = errors.New("Setting is not a positive duration")
+	// ErrNothingToCheck is returned when check is given neither a config file with instances nor ids or urls.
+	ErrNothingToCheck = errors.New("Nothing to check, give a config file with instances or urls")
+)
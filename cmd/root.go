@@ -1,15 +1,27 @@
 package cmd
 
 import (
-	"bytes"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/Dainerx/wpam/pkg/api"
+	"github.com/Dainerx/wpam/pkg/badge"
+	"github.com/Dainerx/wpam/pkg/config_file"
 	"github.com/Dainerx/wpam/pkg/displayer"
+	"github.com/Dainerx/wpam/pkg/exporter"
 	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/rollup"
 	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/status_page"
+	"github.com/Dainerx/wpam/pkg/storage"
+	"github.com/Dainerx/wpam/pkg/stream"
+	"github.com/Dainerx/wpam/pkg/supervisor"
 	"github.com/Dainerx/wpam/pkg/types"
 	"github.com/Dainerx/wpam/pkg/website_check"
 	"github.com/spf13/cobra"
@@ -17,98 +29,143 @@ import (
 )
 
 const (
-	Author                  = "Oussama Ben Ghorbel"
-	PKG                     = "cmd"
-	titleStatsTenMinutesAgo = "Perodic 10s metrics for the past 10 minutes."
-	titleStatsOneHourAgo    = "Perodic 1m metrics in the past 1 hour."
-	tenMinutes              = 10
-	config                  = "config"
+	Author          = "Oussama Ben Ghorbel"
+	PKG             = "cmd"
+	titleStats      = "Periodic %s metrics for the past %s."
+	config          = "config"
+	dataDir         = "data-dir"
+	retention       = "retention"
+	rollupRetention = "rollup-retention"
+	listen          = "listen"
+	persist         = "persist"
+	apiToken        = "api-token"
+	watchConfig     = "watch-config"
+	// The config file is polled for changes at this interval with --watch-config.
+	watchInterval = 2 * time.Second
 )
 
+// yamlExample is the configuration run when no config file is given.
+var yamlExample = []byte(`
+input:
+  - id: datadog
+    url: https://www.datadoghq.com/
+`)
+
 var rootCmd = &cobra.Command{
 	Use:   "wpam",
 	Short: "wpam: Website Availability & Performance Monitoring Tool made by " + Author,
 	Run: func(cmd *cobra.Command, args []string) {
-		viper.SetConfigType("yaml")
 		configFilePath := viper.GetString(config)
+		// Unmarshal configuration, its instances are resolved from the defaults, templates and environment variables
+		var config types.Configuration
+		var err error
 		if configFilePath != "" {
-			viper.SetConfigFile(configFilePath)
-			if err := viper.ReadInConfig(); err != nil {
-				if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-					// Config file not found
-					displayer.DisplayError("Config file not found.\n")
-					logger.Logger.Fatal("Config file not found.")
-
-				} else {
-					// Config file was found but another error was produced
-					displayer.DisplayError("Failed to read config file: %v.\n", err)
-					logger.Logger.Fatalf("Failed to read config file: %v.", err)
-				}
+			if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+				// Config file not found
+				displayer.DisplayError("Config file not found.\n")
+				logger.Logger.Fatal("Config file not found.")
+			}
+			config, err = config_file.Read(configFilePath)
+			if err != nil {
+				// Config file was found but another error was produced
+				displayer.DisplayError("Failed to read config file: %v.\n", err)
+				logger.Logger.Fatalf("Failed to read config file: %v.", err)
 			}
-			// Config file found and successfully parsed
-			logger.Logger.Infof("Log file found and successfully parsed.")
-			displayer.DisplaySuccessMessage("Read config from file: %s\n", configFilePath)
+			// Config file found and successfully parsed, with the files it includes
+			displayer.DisplaySuccessMessage("Read config from file: %s\n", strings.Join(config.Files, ", "))
 		} else {
 			// Run with default config
-			var yamlExample = []byte(`
-input:
-  - id: datadog
-    url: https://www.datadoghq.com/
-`)
-			err := viper.ReadConfig(bytes.NewBuffer(yamlExample))
+			config, err = config_file.Parse(yamlExample)
 			if err != nil {
 				logger.Logger.Fatalf("Failed to read default config")
 			}
 			displayer.DisplayWarning("No config file given, launching one instance: https://www.datadoghq.com/.\n")
 		}
-
-		// Unmarshal configuration using Viper
-		var config types.Configuration
-		if err := viper.Unmarshal(&config); err != nil {
-			displayer.DisplayError("Failed to unmarshal configuration: %v.\n", err)
-			logger.Logger.Fatalf("Failed to unmarshal configuration: %v", err)
+		// Apply the settings before anything is logged or any instance is validated
+		settings, err := applySettings(cmd, config.Settings)
+		if err != nil {
+			displayer.DisplayError("Settings are not valid: %v.\n", err)
+			logger.Logger.Fatalf("Settings are not valid: %v", err)
+		}
+		if err := logger.SetFile(settings.LogFile); err != nil {
+			displayer.DisplayError("Failed to open the log file: %v.\n", err)
+			logger.Logger.Fatalf("Failed to open the log file: %v", err)
 		}
 		// Configuration unmarshalled
-		logger.Logger.Infof("Configuration successfully unmarshalled.")
+		logger.Logger.Infof("Configuration successfully unmarshalled from %v, settings: %+v.", config.Files, settings)
 		// Create the safe store
-		safeStore := safe_store.New()
+		safeStore, err := newSafeStore(cmd, settings.Retention)
+		if err != nil {
+			displayer.DisplayError("Failed to create the store: %v.\n", err)
+			logger.Logger.Fatalf("Failed to create the store: %v", err)
+		}
+
+		// The supervisor runs the instances, they can be changed through the api afterwards
+		instanceSupervisor := supervisor.New(safeStore)
+
+		// Serve the metrics and the api if a listen address is given, before any check is done
+		if addr := viper.GetString(listen); addr != "" {
+			token := viper.GetString(apiToken)
+			if token == "" {
+				displayer.DisplayWarning("No api token given, the instances can not be managed through the api.\n")
+			}
+			mux := newServeMux(safeStore, instanceSupervisor, token)
+			go func() {
+				if err := http.ListenAndServe(addr, mux); err != nil {
+					displayer.DisplayError("Failed to listen on %s: %v.\n", addr, err)
+					logger.Logger.Fatalf("Failed to listen on %s: %v", addr, err)
+				}
+			}()
+			displayer.DisplaySuccessMessage("Listening on %s.\n", addr)
+		}
 
 		// Run valid instances on different Go routine
-		var instances []website_check.CheckRequest
-		seenIds, seenUrls := make(map[string]string), make(map[string]string)
+		rejected := 0
 		for _, instance := range config.Input {
-			instance.CheckInterval *= 1e9 // Defaults nano seconds, converts before moving on.
-			instance.Timeout *= 1e9       // Defaults nano seconds, converts before moving on.
-			checkRequest, err := website_check.NewcheckRequestFromInstance(instance, safeStore)
+			// The same url can be checked by several instances, not the same id
+			_, err := instanceSupervisor.Add(instance)
 			if err != nil {
-				displayer.DisplayWarning("Instance with Id {%s} will not be considered: %v\n", checkRequest.Id(), err)
-				logger.Logger.Warnf("%s", err.Error())
-				continue
+				rejected++
 			}
-			if id, seen := seenIds[checkRequest.Id()]; seen {
-				displayer.DisplayWarning("Instance with Id {%s} already seen, thus duplicated instance will not be considered.\n", id)
-				logger.Logger.Warnf("Instance with Id {%s} already seen, thus duplicated instance will not be considered.", id)
-				continue
+			if err == supervisor.ErrIdDuplicated {
+				displayer.DisplayWarning("Instance with Id {%s} already seen, thus duplicated instance will not be considered.\n", instance.Id)
+				logger.Logger.Warnf("Instance with Id {%s} already seen, thus duplicated instance will not be considered.", instance.Id)
+			} else if err != nil {
+				displayer.DisplayWarning("Instance with Id {%s} will not be considered: %v\n", instance.Id, err)
+				logger.Logger.Warnf("%s", err.Error())
 			}
-			if url, seen := seenUrls[checkRequest.Url()]; seen {
-				displayer.DisplayWarning("Instance with Url {%s} already seen, thus duplicated instance will not be considered.\n", url)
-				logger.Logger.Warnf("Instance with Url {%s} already seen, thus duplicated instance will not be considered.", url)
-				continue
+		}
+		// Write the instances changed through the api back to the config file
+		var configPersister *persister
+		if viper.GetBool(persist) {
+			if configFilePath == "" {
+				displayer.DisplayWarning("No config file given, the instances changed through the api will not be persisted.\n")
+			} else {
+				configPersister = &persister{path: configFilePath}
+				configPersister.setRejected(rejected)
+				configPersister.setConfig(config)
+				instanceSupervisor.OnChange(configPersister.persist)
 			}
+		}
 
-			// Consider this instance
-			instances = append(instances, *checkRequest)
-			// Add it in seen ids and urls
-			seenIds[checkRequest.Id()] = checkRequest.Id()
-			seenUrls[checkRequest.Url()] = checkRequest.Url()
-			// Run checkRequest on different go routines (for each instance a goroutine)
-			go checkRequest.Run()
+		// Reload the config file on SIGHUP and, if watched, once it changed
+		configIds := instanceIds(config.Input)
+		reloads := make(chan os.Signal, 1)
+		signal.Notify(reloads, syscall.SIGHUP)
+		if viper.GetBool(watchConfig) {
+			if configFilePath == "" {
+				displayer.DisplayWarning("No config file given, nothing to watch.\n")
+			} else {
+				go watch(configFilePath, reloads)
+			}
 		}
 
 		// Keep going with the main thread to display
-		tickerTenSeconds := time.NewTicker(time.Duration(10 * time.Second))
-		tickerOneMinute := time.NewTicker(time.Duration(1 * time.Minute))
-		tickerOneHour := time.NewTicker(time.Duration(1 * time.Hour))
+		tickerDisplay := time.NewTicker(settings.DisplayInterval)
+		tickerSummary := time.NewTicker(settings.SummaryInterval)
+		tickerCleanup := time.NewTicker(settings.CleanupInterval)
+		titleDisplay := fmt.Sprintf(titleStats, shortDuration(settings.DisplayInterval), shortDuration(settings.DisplayWindow))
+		titleSummary := fmt.Sprintf(titleStats, shortDuration(settings.SummaryInterval), shortDuration(settings.SummaryWindow))
 		// Channel to capture System exit
 		c := make(chan os.Signal, 1) //buffer size 1 or risk missing the signal
 		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -118,39 +175,283 @@ input:
 				// Stop all the instances
 				displayer.DisplayWarning("\nCaptured shutdown signal.\n")
 				displayer.DisplayWarning("Stopping all instances.\n")
-				for _, instance := range instances {
-					instance.Stop()
-				}
+				instanceSupervisor.StopAll()
 				displayer.DisplaySuccessMessage("All Instances have stopped.\n")
+				if err := safeStore.Close(); err != nil {
+					displayer.DisplayError("Failed to close the storage: %v.\n", err)
+					logger.Logger.Errorf("Failed to close the storage: %v", err)
+				}
 				displayer.DisplaySuccessMessage("Bye!\n")
-				// Safe Store will be garbage collected
 				os.Exit(0)
-			case <-tickerOneHour.C:
-				// Clean data after one hour
-				logger.Logger.Info("Started data cleaning process. Dropping data dating more than one hour ago.\n")
+			case <-reloads:
+				if configFilePath == "" {
+					displayer.DisplayWarning("No config file given, nothing to reload.\n")
+					continue
+				}
+				configIds = reloadConfig(configFilePath, instanceSupervisor, configPersister, configIds, config.Settings)
+			case <-tickerCleanup.C:
+				// Clean the data older than the retention, prune the history older than the retention
 				safeStore.CleanData()
-				logger.Logger.Info("Data cleaning process has finished.\n")
-			case <-tickerOneMinute.C:
-				mapAllStats := safeStore.GetAllStatsOneHourAgo()
+			case <-tickerSummary.C:
+				now := time.Now()
+				from := now.Add(-settings.SummaryWindow)
+				mapAllStats := safeStore.StatsAll(from, now)
 				mapAllAlerts := safeStore.GetAllAlerts()
-				displayer.DisplayStatsAndAlerts(titleStatsOneHourAgo, time.Now().Add(-1*tenMinutes*time.Minute), mapAllAlerts, mapAllStats)
+				mapAllBudgets := safeStore.ErrorBudgetsAll(now)
+				displayer.DisplayStatsAndAlerts(titleSummary, from, safeStore.GetAllUrls(), mapAllAlerts, mapAllStats, mapAllBudgets)
 
-			case <-tickerTenSeconds.C:
+			case <-tickerDisplay.C:
+				now := time.Now()
+				from := now.Add(-settings.DisplayWindow)
 				// map used for display metrics
-				mapAllStats := safeStore.GetAllStatsTenMinutesAgo()
+				mapAllStats := safeStore.StatsAll(from, now)
 				// map used for alerts needed to be displayed
 				mapAllAlerts := safeStore.GetAllAlerts()
-				displayer.DisplayStatsAndAlerts(titleStatsTenMinutesAgo, time.Now().Add(-1*tenMinutes*time.Minute), mapAllAlerts, mapAllStats)
+				// map used for error budgets of instances with an objective
+				mapAllBudgets := safeStore.ErrorBudgetsAll(now)
+				displayer.DisplayStatsAndAlerts(titleDisplay, from, safeStore.GetAllUrls(), mapAllAlerts, mapAllStats, mapAllBudgets)
 			}
 		}
 	},
 }
 
-func init() {
-	rootCmd.PersistentFlags().StringP("config", "c", "", "--config path/to/configfile.yaml")
-	err := viper.BindPFlag("config", rootCmd.PersistentFlags().Lookup("config"))
+// newSafeStore creates the safe store keeping the raw history for rawRetention,
+// history and rollups are persisted on disk only if a data directory is given.
+// Returns error if the retention flags are not valid or the storage could not be opened.
+func newSafeStore(cmd *cobra.Command, rawRetention time.Duration) (*safe_store.SafeStore, error) {
+	storeRetention := safe_store.DefaultRetention()
+	storeRetention.Raw = rawRetention
+	rollupRetentions, err := cmd.Flags().GetStringToString(rollupRetention)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range rollupRetentions {
+		resolution, err := rollup.ParseResolution(name)
+		if err != nil {
+			return nil, err
+		}
+		storeRetention.Rollups[resolution], err = time.ParseDuration(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dir := viper.GetString(dataDir)
+	if dir == "" {
+		return safe_store.NewWithRetention(storeRetention), nil
+	}
+	st, err := storage.NewDisk(dir)
 	if err != nil {
-		logger.Logger.Fatalf("Failed to bind flag: %v", err)
+		return nil, err
+	}
+	safeStore, err := safe_store.NewWithStorage(st, storeRetention)
+	if err != nil {
+		return nil, err
+	}
+	displayer.DisplaySuccessMessage("History is stored under %s and kept for %v.\n", dir, storeRetention.Raw)
+	return safeStore, nil
+}
+
+// newServeMux returns the handlers served on the listen address:
+// - /metrics the checks of every instance in the Prometheus text exposition format.
+// - /api/ the status, stats, alerts and incidents of the instances as JSON, instances are managed through the supervisor
+// by the requests having the token, the api is read only without one.
+// - /status the status page of the instances.
+// - /badge/ the SVG badges of the instances.
+// - /stream the check results and alert transitions of the instances as Server-Sent Events.
+func newServeMux(safeStore *safe_store.SafeStore, instanceSupervisor *supervisor.Supervisor, token string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter.New(safeStore))
+	mux.Handle(api.Prefix, api.NewWithToken(safeStore, instanceSupervisor, token))
+	mux.Handle("/status", status_page.New(safeStore))
+	mux.Handle(badge.Prefix, badge.New(safeStore))
+	mux.Handle("/stream", stream.New(safeStore))
+	return mux
+}
+
+// persister writes the instances changed through the api to the config file.
+// The whole input is rewritten from the supervisor, thus nothing is written while the config file has instances
+// the supervisor rejected, they would be dropped, or the instances can not be written back as they were read.
+type persister struct {
+	sync.Mutex //embedded field
+	path       string
+	rejected   int
+	readOnly   string // Why the instances can not be written back, empty if they can
+}
+
+// Tells how many instances of the config file the supervisor rejected when it was last read.
+func (p *persister) setRejected(rejected int) {
+	p.Lock()
+	defer p.Unlock()
+	if rejected > 0 {
+		displayer.DisplayWarning("%d instances of the config file were not considered, the instances changed through the api will not be persisted to keep them: fix them first.\n", rejected)
+		logger.Logger.Warnf("%d instances of the config file were not considered, persist disabled", rejected)
+	}
+	p.rejected = rejected
+}
+
+// Tells whether the instances of the config file, as it was last read, can be written back to it.
+// They can not if they use defaults, templates or environment variables, they would be written expanded,
+// or if they are read from a directory or several files, they would all be written to one.
+func (p *persister) setConfig(config types.Configuration) {
+	p.Lock()
+	defer p.Unlock()
+	p.readOnly = ""
+	if config.Templated {
+		p.readOnly = "uses defaults, templates or environment variables"
+	} else if len(config.Files) != 1 || config.Files[0] != p.path {
+		p.readOnly = "is a directory or includes other files"
+	}
+	if p.readOnly != "" {
+		displayer.DisplayWarning("The config file %s, the instances changed through the api will not be persisted to keep it.\n", p.readOnly)
+		logger.Logger.Warnf("The config file %s, persist disabled", p.readOnly)
+	}
+}
+
+// Tells whether the instances changed through the api are written to the config file, false for a nil persister.
+func (p *persister) writable() bool {
+	if p == nil {
+		return false
+	}
+	p.Lock()
+	defer p.Unlock()
+	return p.rejected == 0 && p.readOnly == ""
+}
+
+// persist is a supervisor.ChangeListener writing the instances to the config file, the file is left unchanged on failure.
+func (p *persister) persist(instances []types.Instance) {
+	p.Lock()
+	defer p.Unlock()
+	if p.rejected > 0 {
+		logger.Logger.Warnf("Instances not persisted, %d instances of the config file were not considered", p.rejected)
+		return
+	}
+	if p.readOnly != "" {
+		logger.Logger.Warnf("Instances not persisted, the config file %s", p.readOnly)
+		return
+	}
+	if err := config_file.WriteInstances(p.path, instances); err != nil {
+		displayer.DisplayError("Failed to persist the instances to %s: %v.\n", p.path, err)
+		logger.Logger.Errorf("Failed to persist the instances to %s: %v", p.path, err)
+		return
+	}
+	logger.Logger.Infof("Instances persisted to %s", p.path)
+}
+
+// reloadConfig reads the config file again and applies its instances: new ones are started, removed ones stopped,
+// changed ones restarted, the data and alerts of the instances kept are not lost.
+// Instances added through the api, not in the config file as it was read before (configIds), are kept
+// unless they are persisted: they are in the config file then, and only missing if removed from it.
+// The running instances are left unchanged if the file could not be read.
+// Settings are not applied, the ones changed since they were read at startup (settings) are warned about.
+// Returns the ids of the config file's instances, configIds if it could not be read.
+func reloadConfig(configFilePath string, instanceSupervisor *supervisor.Supervisor, configPersister *persister, configIds map[string]bool,
+	settings types.Settings) map[string]bool {
+	config, err := config_file.Read(configFilePath)
+	if err != nil {
+		displayer.DisplayError("Failed to reload config file: %v.\n", err)
+		logger.Logger.Errorf("Failed to reload config file: %v", err)
+		return configIds
+	}
+	if changed := changedSettings(settings, config.Settings); len(changed) > 0 {
+		displayer.DisplayWarning("Settings %s changed, they are applied on restart only.\n", strings.Join(changed, ", "))
+		logger.Logger.Warnf("Settings %s changed, they are applied on restart only", strings.Join(changed, ", "))
+	}
+	instances := config.Input
+	ids := instanceIds(instances)
+	if !configPersister.writable() {
+		for _, instance := range instanceSupervisor.Instances() {
+			if !configIds[instance.Id] && !ids[instance.Id] {
+				displayer.DisplayWarning("Instance %s was added through the api and is not persisted, it is kept.\n", instance.Id)
+				logger.Logger.Warnf("Instance %s was added through the api and is not persisted, it is kept", instance.Id)
+				instances = append(instances, instance)
+			}
+		}
+	}
+	reloaded := instanceSupervisor.Reload(instances)
+	for _, err := range reloaded.Skipped {
+		displayer.DisplayWarning("%v, it will not be considered.\n", err)
+		logger.Logger.Warnf("%v", err)
+	}
+	if configPersister != nil {
+		configPersister.setRejected(len(reloaded.Skipped))
+		configPersister.setConfig(config)
+	}
+	displayer.DisplaySuccessMessage("Reloaded config file: %d added, %d updated, %d deleted, %d unchanged.\n",
+		len(reloaded.Added), len(reloaded.Updated), len(reloaded.Deleted), len(reloaded.Unchanged))
+	logger.Logger.Infof("Reloaded config file: added %v, updated %v, deleted %v", reloaded.Added, reloaded.Updated, reloaded.Deleted)
+	return ids
+}
+
+// Returns the ids of the instances as a set.
+func instanceIds(instances []types.Instance) map[string]bool {
+	ids := make(map[string]bool, len(instances))
+	for _, instance := range instances {
+		ids[instance.Id] = true
+	}
+	return ids
+}
+
+// watch polls the config and sends a reload once one of its files changed: the modification time or size of a file
+// changed, or a file was included, added to the directory or removed.
+// Polling follows the editors replacing the file rather than writing it.
+func watch(configFilePath string, reloads chan<- os.Signal) {
+	last := configState(configFilePath)
+	for range time.Tick(watchInterval) {
+		if _, err := os.Stat(configFilePath); err != nil {
+			continue // Being replaced
+		}
+		state := configState(configFilePath)
+		if state != last {
+			select {
+			case reloads <- syscall.SIGHUP:
+			default: // A reload is pending already
+			}
+		}
+		last = state
+	}
+}
+
+// configState returns the files of the config with their modification time and size, and the error reading them if any.
+func configState(configFilePath string) string {
+	var state strings.Builder
+	files, err := config_file.Files(configFilePath)
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&state, "%s %d %d\n", file, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(&state, "%v\n", err)
+	}
+	return state.String()
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringP("config", "c", "", "--config path/to/configfile.yaml or path/to/configdir, a directory's .yml and .yaml files are read together")
+	rootCmd.PersistentFlags().String(dataDir, "", "--data-dir path/to/history, keeps the check history on disk across restarts")
+	rootCmd.PersistentFlags().Duration(retention, safe_store.DefaultRawRetention, "--retention 24h, how long the raw check history is kept, on disk with --data-dir else in memory")
+	rootCmd.PersistentFlags().StringToString(rollupRetention, map[string]string{}, "--rollup-retention 1m=48h,1h=720h,1d=8760h, how long rollups of every resolution are kept on disk")
+	rootCmd.PersistentFlags().String(listen, "", "--listen :9100, serves the Prometheus metrics on /metrics, the JSON api on /api/, the status page on /status, badges on /badge/ and live events on /stream")
+	rootCmd.PersistentFlags().Bool(persist, false, "--persist, writes the instances added, updated, paused or deleted through the api back to the config file")
+	rootCmd.PersistentFlags().Bool(watchConfig, false, "--watch-config, reloads the config once one of its files changed like on SIGHUP")
+	rootCmd.PersistentFlags().String(apiToken, "", "--api-token secret, required as bearer by the api requests managing the instances and incidents, the api is read only without it")
+	rootCmd.PersistentFlags().Duration(displayInterval, defaultDisplayInterval, "--display-interval 30s, how often the stats over the display window are displayed")
+	rootCmd.PersistentFlags().Duration(displayWindow, defaultDisplayWindow, "--display-window 10m, the past the stats displayed every display interval are computed over")
+	rootCmd.PersistentFlags().Duration(summaryInterval, defaultSummaryInterval, "--summary-interval 1m, how often the stats over the summary window are displayed")
+	rootCmd.PersistentFlags().Duration(summaryWindow, defaultSummaryWindow, "--summary-window 1h, the past the stats displayed every summary interval are computed over")
+	rootCmd.PersistentFlags().Duration(cleanupInterval, defaultCleanupInterval, "--cleanup-interval 1h, how often the data older than the retention is dropped")
+	rootCmd.PersistentFlags().String(logFile, defaultLogFile, "--log-file /var/log/wpam.log, the file logs are appended to")
+	rootCmd.PersistentFlags().Duration(minTimeout, website_check.DefaultBounds.MinTimeout, "--min-timeout 100ms, the shortest timeout of an instance")
+	rootCmd.PersistentFlags().Duration(maxTimeout, website_check.DefaultBounds.MaxTimeout, "--max-timeout 20s, the longest timeout of an instance")
+	rootCmd.PersistentFlags().Duration(minCheckInterval, website_check.DefaultBounds.MinCheckInterval, "--min-check-interval 5s, the shortest check interval of an instance")
+	rootCmd.PersistentFlags().Duration(maxCheckInterval, website_check.DefaultBounds.MaxCheckInterval, "--max-check-interval 2m, the longest check interval of an instance")
+	for _, flag := range []string{config, dataDir, retention, listen, persist, apiToken, watchConfig,
+		displayInterval, displayWindow, summaryInterval, summaryWindow, cleanupInterval, logFile,
+		minTimeout, maxTimeout, minCheckInterval, maxCheckInterval} {
+		err := viper.BindPFlag(flag, rootCmd.PersistentFlags().Lookup(flag))
+		if err != nil {
+			logger.Logger.Fatalf("Failed to bind flag: %v", err)
+		}
 	}
 }
 
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Dainerx/wpam/pkg/config_file"
 	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/supervisor"
 	"github.com/Dainerx/wpam/pkg/types"
 	"github.com/Dainerx/wpam/pkg/website_check"
 	"github.com/spf13/viper"
@@ -50,3 +55,39 @@ func TestUnmarshall(t *testing.T) {
 	}
 
 }
+
+// Instances added through the api are kept by a reload unless they are persisted to the config file.
+func TestReloadConfigKeepsApiInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte("input:\n  - id: config\n    url: http://example.com\n    paused: true\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	instanceSupervisor := supervisor.New(safe_store.New())
+	defer instanceSupervisor.StopAll()
+	for _, id := range []string{"config", "api"} {
+		if _, err := instanceSupervisor.Add(types.Instance{Id: id, Url: "http://example.com", Paused: true}); err != nil {
+			t.Fatalf("instanceSupervisor.Add(%s) failed: %v", id, err)
+		}
+	}
+	configIds := reloadConfig(path, instanceSupervisor, nil, map[string]bool{"config": true}, types.Settings{})
+	if got := instanceSupervisor.Instances(); len(got) != 2 || len(configIds) != 1 || !configIds["config"] {
+		t.Errorf("Instances after reload = %+v, config ids %v; want the api instance kept", got, configIds)
+	}
+
+	// Persisted, the api instance would be in the config file: it was removed from it
+	config, err := config_file.Read(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	configPersister := &persister{path: path}
+	configPersister.setConfig(config)
+	reloadConfig(path, instanceSupervisor, configPersister, configIds, types.Settings{})
+	if got := instanceSupervisor.Instances(); len(got) != 1 || got[0].Id != "config" {
+		t.Errorf("Instances after reload = %+v; want the api instance deleted", got)
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Flags of the settings, the keys of the settings section are the same in camel case, e.g. displayInterval.
+const (
+	displayInterval  = "display-interval"
+	displayWindow    = "display-window"
+	summaryInterval  = "summary-interval"
+	summaryWindow    = "summary-window"
+	cleanupInterval  = "cleanup-interval"
+	logFile          = "log-file"
+	minTimeout       = "min-timeout"
+	maxTimeout       = "max-timeout"
+	minCheckInterval = "min-check-interval"
+	maxCheckInterval = "max-check-interval"
+)
+
+// Default settings.
+const (
+	defaultDisplayInterval = 10 * time.Second
+	defaultDisplayWindow   = 10 * time.Minute
+	defaultSummaryInterval = 1 * time.Minute
+	defaultSummaryWindow   = 1 * time.Hour
+	defaultCleanupInterval = 1 * time.Hour
+	defaultLogFile         = "log.log"
+)
+
+// applySettings returns the settings of the config file overridden by the flags set, the settings not configured
+// are the flags' values. The bounds of the instances' timeouts and check intervals are set.
+// Returns error if a duration is not positive or a minimum is above its maximum.
+func applySettings(cmd *cobra.Command, configured types.Settings) (types.Settings, error) {
+	settings := configured
+	flags := cmd.Flags()
+	durations := []struct {
+		flag  string
+		value *time.Duration
+	}{
+		{displayInterval, &settings.DisplayInterval},
+		{displayWindow, &settings.DisplayWindow},
+		{summaryInterval, &settings.SummaryInterval},
+		{summaryWindow, &settings.SummaryWindow},
+		{cleanupInterval, &settings.CleanupInterval},
+		{retention, &settings.Retention},
+		{minTimeout, &settings.MinTimeout},
+		{maxTimeout, &settings.MaxTimeout},
+		{minCheckInterval, &settings.MinCheckInterval},
+		{maxCheckInterval, &settings.MaxCheckInterval},
+	}
+	for _, d := range durations {
+		if *d.value == 0 || flags.Changed(d.flag) {
+			*d.value = viper.GetDuration(d.flag)
+		}
+		if *d.value <= 0 {
+			return settings, fmt.Errorf("%w: %s is %v", ErrSettingNotPositive, d.flag, *d.value)
+		}
+	}
+	if settings.LogFile == "" || flags.Changed(logFile) {
+		settings.LogFile = viper.GetString(logFile)
+	}
+	err := website_check.SetBounds(website_check.Bounds{
+		MinTimeout:       settings.MinTimeout,
+		MaxTimeout:       settings.MaxTimeout,
+		MinCheckInterval: settings.MinCheckInterval,
+		MaxCheckInterval: settings.MaxCheckInterval,
+	})
+	return settings, err
+}
+
+// changedSettings returns the keys of the settings section which differ between previous and current,
+// e.g. the config file read at startup and reloaded.
+func changedSettings(previous, current types.Settings) []string {
+	settings := []struct {
+		key               string
+		previous, current interface{}
+	}{
+		{"displayInterval", previous.DisplayInterval, current.DisplayInterval},
+		{"displayWindow", previous.DisplayWindow, current.DisplayWindow},
+		{"summaryInterval", previous.SummaryInterval, current.SummaryInterval},
+		{"summaryWindow", previous.SummaryWindow, current.SummaryWindow},
+		{"cleanupInterval", previous.CleanupInterval, current.CleanupInterval},
+		{"retention", previous.Retention, current.Retention},
+		{"logFile", previous.LogFile, current.LogFile},
+		{"minTimeout", previous.MinTimeout, current.MinTimeout},
+		{"maxTimeout", previous.MaxTimeout, current.MaxTimeout},
+		{"minCheckInterval", previous.MinCheckInterval, current.MinCheckInterval},
+		{"maxCheckInterval", previous.MaxCheckInterval, current.MaxCheckInterval},
+	}
+	var changed []string
+	for _, setting := range settings {
+		if setting.previous != setting.current {
+			changed = append(changed, setting.key)
+		}
+	}
+	return changed
+}
+
+// Returns the duration without its zero minutes and seconds, e.g. 1h rather than 1h0m0s.
+func shortDuration(d time.Duration) string {
+	return strings.Replace(strings.Replace(d.String(), "m0s", "m", 1), "h0m", "h", 1)
+}
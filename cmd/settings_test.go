@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+func TestApplySettings(t *testing.T) {
+	defer website_check.SetBounds(website_check.DefaultBounds)
+	// The configured settings are kept, the others are the flags' defaults
+	settings, err := applySettings(rootCmd, types.Settings{DisplayInterval: 30 * time.Second, Retention: 24 * time.Hour, LogFile: "/var/log/wpam.log"})
+	if err != nil {
+		t.Fatalf("applySettings() failed: %v", err)
+	}
+	if settings.DisplayInterval != 30*time.Second || settings.Retention != 24*time.Hour || settings.LogFile != "/var/log/wpam.log" ||
+		settings.DisplayWindow != defaultDisplayWindow || settings.SummaryInterval != defaultSummaryInterval || settings.MaxTimeout != website_check.DefaultBounds.MaxTimeout {
+		t.Errorf("applySettings() = %+v; want the configured settings and the defaults", settings)
+	}
+	if _, err := applySettings(rootCmd, types.Settings{CleanupInterval: -time.Hour}); !errors.Is(err, ErrSettingNotPositive) {
+		t.Errorf("applySettings() of a negative interval = %v; want %v", err, ErrSettingNotPositive)
+	}
+	if _, err := applySettings(rootCmd, types.Settings{MinTimeout: time.Minute}); err != website_check.ErrBoundsNotValid {
+		t.Errorf("applySettings() of a minimum timeout above the maximum = %v; want %v", err, website_check.ErrBoundsNotValid)
+	}
+
+	// The flags set override the configured settings
+	if err := rootCmd.ParseFlags([]string{"--display-interval=1m", "--max-check-interval=10m"}); err != nil {
+		t.Fatal(err)
+	}
+	settings, err = applySettings(rootCmd, types.Settings{DisplayInterval: 30 * time.Second, MaxCheckInterval: 5 * time.Minute})
+	if err != nil {
+		t.Fatalf("applySettings() failed: %v", err)
+	}
+	if settings.DisplayInterval != time.Minute || settings.MaxCheckInterval != 10*time.Minute || website_check.GetBounds().MaxCheckInterval != 10*time.Minute {
+		t.Errorf("applySettings() = %+v; want the flags over the configured settings and the bounds set", settings)
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	previous := types.Settings{DisplayInterval: 30 * time.Second, LogFile: "/var/log/wpam.log"}
+	if changed := changedSettings(previous, previous); len(changed) != 0 {
+		t.Errorf("changedSettings() of the same settings = %v; want none", changed)
+	}
+	current := types.Settings{DisplayInterval: time.Minute, LogFile: "/var/log/wpam.log", MaxTimeout: time.Minute}
+	if changed := changedSettings(previous, current); len(changed) != 2 || changed[0] != "displayInterval" || changed[1] != "maxTimeout" {
+		t.Errorf("changedSettings() = %v; want [displayInterval maxTimeout]", changed)
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/Dainerx/wpam/pkg/config_file"
+	"github.com/Dainerx/wpam/pkg/displayer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [path/to/configfile.yaml or path/to/configdir]",
+	Short: "Validates every instance of the config file, exits with 1 if some are not valid",
+	Long: `Validates every instance of the config file like wpam does before running them and reports every problem
+with the instance's file, line, position and id: path:line: instance #n (id): problem.
+The config file is the argument or the one given by --config, the files it includes and the files of a directory
+are validated together. Exits with 1 if an instance is not valid, 2 if a file can not be read or parsed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		configFilePath := viper.GetString(config)
+		if len(args) == 1 {
+			configFilePath = args[0]
+		}
+		if configFilePath == "" {
+			displayer.DisplayError("No config file given.\n")
+			os.Exit(2)
+		}
+		// Instances are validated against the bounds of the settings
+		settings, err := config_file.ReadSettings(configFilePath)
+		if err == nil {
+			_, err = applySettings(cmd, settings)
+		}
+		if err != nil {
+			displayer.DisplayError("%v.\n", err)
+			os.Exit(2)
+		}
+		problems, err := config_file.Validate(configFilePath)
+		if err != nil {
+			displayer.DisplayError("%v.\n", err)
+			os.Exit(2)
+		}
+		for _, problem := range problems {
+			displayer.DisplayError("%s: %v\n", problem.Where(), problem.Err)
+		}
+		if len(problems) > 0 {
+			displayer.DisplayError("%d instances are not valid.\n", len(problems))
+			os.Exit(1)
+		}
+		displayer.DisplaySuccessMessage("%s is valid.\n", configFilePath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
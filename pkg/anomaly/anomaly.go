@@ -0,0 +1,81 @@
+// Package anomaly detects values deviating from a baseline learnt from the past values of a series.
+package anomaly
+
+import "math"
+
+const (
+	PKG = "anomaly"
+	// Weight of a new value in the baseline, the baseline mostly reflects the last hundreds of values.
+	DefaultAlpha = 0.01
+	// Values learnt before the baseline is trusted.
+	DefaultWarmup = 30
+	// Lowest deviation of the baseline, very stable series would flag negligible changes otherwise.
+	minStdDev = 0.005
+)
+
+// Detector keeps a baseline of a series as its exponentially weighted moving mean and variance.
+// A Detector is not safe for concurrent use.
+type Detector struct {
+	alpha    float64
+	warmup   int
+	count    int
+	mean     float64
+	variance float64
+}
+
+// NewDetector creates a detector with the default alpha and warmup.
+func NewDetector() *Detector {
+	return &Detector{alpha: DefaultAlpha, warmup: DefaultWarmup}
+}
+
+// Update learns a value of the series into the baseline.
+func (d *Detector) Update(x float64) {
+	d.count++
+	if d.count == 1 {
+		d.mean = x
+		return
+	}
+	// Incremental EWMA of the mean and the variance
+	diff := x - d.mean
+	increment := d.alpha * diff
+	d.mean += increment
+	d.variance = (1 - d.alpha) * (d.variance + diff*increment)
+}
+
+// Learn is like Update but clips x to deviations standard deviations above the mean once the detector is ready,
+// thus an anomaly shifts the baseline slowly instead of widening its deviation and hiding itself.
+func (d *Detector) Learn(x, deviations float64) {
+	if d.Ready() {
+		x = math.Min(x, d.mean+deviations*d.StdDev())
+	}
+	d.Update(x)
+}
+
+// Ready tells whether enough values were learnt to trust the baseline.
+func (d *Detector) Ready() bool {
+	return d.count >= d.warmup
+}
+
+// Mean returns the baseline's mean.
+func (d *Detector) Mean() float64 {
+	return d.mean
+}
+
+// StdDev returns the baseline's standard deviation, never below the minimum deviation.
+func (d *Detector) StdDev() float64 {
+	return math.Max(math.Sqrt(d.variance), minStdDev)
+}
+
+// Score returns by how many standard deviations x is above the baseline's mean, negative if below.
+// Returns 0 until the detector is ready.
+func (d *Detector) Score(x float64) float64 {
+	if !d.Ready() {
+		return 0
+	}
+	return (x - d.mean) / d.StdDev()
+}
+
+// Anomalous tells whether x is more than deviations standard deviations above the baseline.
+func (d *Detector) Anomalous(x, deviations float64) bool {
+	return d.Ready() && d.Score(x) > deviations
+}
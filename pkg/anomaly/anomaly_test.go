@@ -0,0 +1,39 @@
+package anomaly_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/Dainerx/wpam/pkg/anomaly"
+)
+
+func TestDetector(t *testing.T) {
+	rand.Seed(42)
+	d := anomaly.NewDetector()
+	if d.Anomalous(10, 3) {
+		t.Errorf("d.Anomalous() before warmup = true; want false")
+	}
+	// Response times around 200ms with a 20ms deviation
+	for i := 0; i < 1000; i++ {
+		d.Update(0.2 + rand.NormFloat64()*0.02)
+	}
+	if math.Abs(d.Mean()-0.2) > 0.01 || math.Abs(d.StdDev()-0.02) > 0.005 {
+		t.Errorf("d.Mean(), d.StdDev() = %f, %f; want 0.2, 0.02", d.Mean(), d.StdDev())
+	}
+	if d.Anomalous(0.23, 3) {
+		t.Errorf("d.Anomalous(0.23, 3) = true; want false")
+	}
+	if !d.Anomalous(0.4, 3) {
+		t.Errorf("d.Anomalous(0.4, 3) = false; want true")
+	}
+	if d.Anomalous(0.1, 3) {
+		t.Errorf("d.Anomalous(0.1, 3) = true; want false, faster responses are not anomalous")
+	}
+	// Learning an outlier clipped keeps the deviation
+	stdDev := d.StdDev()
+	d.Learn(10, 3)
+	if d.StdDev() > 1.1*stdDev || !d.Anomalous(0.4, 3) {
+		t.Errorf("d.StdDev() after learning an outlier = %f; want about %f", d.StdDev(), stdDev)
+	}
+}
@@ -0,0 +1,443 @@
+// Package api serves the instances' status, stats, alerts and incidents as JSON, read from the safe store.
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/supervisor"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const (
+	PKG         = "api"
+	Prefix      = "/api/"
+	contentType = "application/json; charset=utf-8"
+	// Stats are computed over the last 10 minutes like the periodic display if no range is given.
+	defaultStatsWindow = 10 * time.Minute
+	// Incidents are listed over the longest default rollup retention if no range is given.
+	defaultIncidentsWindow = 365 * 24 * time.Hour
+	statusOk               = "ok"
+	statusDegraded         = "degraded"
+	maxBodySize            = 1 << 20
+)
+
+// Api routes the requests under /api/ to its endpoints:
+// - GET /api/health the health of wpam itself, 503 if an instance is not checked on time.
+// - GET /api/instances every instance with its current status.
+// - POST /api/instances adds an instance, validated like the ones of the configuration file.
+// - GET /api/instances/{id} an instance with its current status.
+// - PUT /api/instances/{id} replaces an instance, its data and alerts are kept.
+// - DELETE /api/instances/{id} deletes an instance with its data and alerts.
+// - GET /api/instances/{id}/config an instance as added or updated.
+// - POST /api/instances/{id}/pause and /api/instances/{id}/resume stop and restart checking an instance.
+// - GET /api/instances/{id}/stats?from=&to=&window= an instance's stats over a range, the last 10 minutes by default.
+// - GET /api/alerts?id= the alerts history of every instance or one.
+// - GET /api/incidents?id=&from=&to=&window= the incidents of every instance or one.
+// - POST /api/incidents/notes adds an operator's note to an incident, shown on the status page.
+// Requests other than GET and HEAD change the instances or the incidents, they need the api token as bearer.
+type Api struct {
+	store      *safe_store.SafeStore
+	supervisor *supervisor.Supervisor
+	token      string // Empty if the api is read only
+	started    time.Time
+	mux        *http.ServeMux
+}
+
+// New creates a read only api reading from the store, wpam is considered started at the call.
+func New(store *safe_store.SafeStore, supervisor *supervisor.Supervisor) *Api {
+	return NewWithToken(store, supervisor, "")
+}
+
+// NewWithToken creates an api reading from the store and managing the instances through the supervisor
+// for the requests authorized with the token, wpam is considered started at the call.
+// An empty token makes the api read only.
+func NewWithToken(store *safe_store.SafeStore, supervisor *supervisor.Supervisor, token string) *Api {
+	a := &Api{
+		store:      store,
+		supervisor: supervisor,
+		token:      token,
+		started:    time.Now(),
+		mux:        http.NewServeMux(),
+	}
+	a.mux.HandleFunc(Prefix+"health", methods{http.MethodGet: a.health}.serve)
+	a.mux.HandleFunc(Prefix+"instances", methods{http.MethodGet: a.instances, http.MethodPost: a.addInstance}.serve)
+	a.mux.HandleFunc(Prefix+"instances/", a.instance)
+	a.mux.HandleFunc(Prefix+"alerts", methods{http.MethodGet: a.alerts}.serve)
+	a.mux.HandleFunc(Prefix+"incidents", methods{http.MethodGet: a.incidents}.serve)
+	a.mux.HandleFunc(Prefix+"incidents/notes", methods{http.MethodPost: a.addIncidentNote}.serve)
+	return a
+}
+
+// ServeHTTP dispatches the request to its endpoint, 404 if there is none.
+// Requests changing the state are rejected with 403 if the api is read only, 401 if their token is not the api's one.
+func (a *Api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if a.token == "" {
+			writeError(w, http.StatusForbidden, ErrReadOnly)
+			return
+		}
+		if !a.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="wpam"`)
+			writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+// Tells whether the request has the api token as bearer, compared in constant time.
+func (a *Api) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// methods maps the methods an endpoint supports to their handler.
+type methods map[string]http.HandlerFunc
+
+// Calls the handler of the request's method, rejects the other methods with 405.
+func (m methods) serve(w http.ResponseWriter, r *http.Request) {
+	handler, ok := m[r.Method]
+	if !ok {
+		var allowed []string
+		for method := range m {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	handler(w, r)
+}
+
+func (a *Api) health(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	instances := a.store.GetAllInstances()
+	health := Health{
+		Status:    statusOk,
+		StartedAt: a.started,
+		Uptime:    now.Sub(a.started).Seconds(),
+		Instances: len(instances),
+		Stale:     []string{},
+	}
+	for id, instance := range instances {
+		if instance.Paused {
+			continue
+		}
+		lastCheck := a.started
+		if responses := a.store.Get(id); len(responses) > 0 {
+			lastCheck = time.Unix(0, responses[len(responses)-1].Timestamp())
+		}
+		if now.Sub(lastCheck) > 2*instance.CheckInterval+instance.Timeout {
+			health.Stale = append(health.Stale, id)
+		}
+	}
+	sort.Strings(health.Stale)
+	code := http.StatusOK
+	if len(health.Stale) > 0 {
+		health.Status = statusDegraded
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, health)
+}
+
+func (a *Api) instances(w http.ResponseWriter, r *http.Request) {
+	instances := a.store.GetAllInstances()
+	mapAllAlerts := a.store.GetAllAlerts()
+	statuses := []InstanceStatus{}
+	for id, instance := range instances {
+		statuses = append(statuses, newInstanceStatus(instance, a.store.Get(id), mapAllAlerts[id]))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Id < statuses[j].Id })
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// Serves /api/instances/{id} and its sub resources.
+func (a *Api) instance(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, Prefix+"instances/"), "/")
+	id := parts[0]
+	if _, ok := a.store.GetInstance(id); !ok {
+		writeError(w, http.StatusNotFound, ErrInstanceNotFound)
+		return
+	}
+	var m methods
+	switch {
+	case len(parts) == 1:
+		m = methods{http.MethodGet: a.getInstance, http.MethodPut: a.updateInstance, http.MethodDelete: a.deleteInstance}
+	case len(parts) == 2 && parts[1] == "config":
+		m = methods{http.MethodGet: a.getInstanceConfig}
+	case len(parts) == 2 && parts[1] == "stats":
+		m = methods{http.MethodGet: a.stats}
+	case len(parts) == 2 && parts[1] == "pause":
+		m = methods{http.MethodPost: a.pauseInstance}
+	case len(parts) == 2 && parts[1] == "resume":
+		m = methods{http.MethodPost: a.resumeInstance}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	m.serve(w, r)
+}
+
+// Returns the id of the url /api/instances/{id}...
+func instanceId(r *http.Request) string {
+	return strings.Split(strings.TrimPrefix(r.URL.Path, Prefix+"instances/"), "/")[0]
+}
+
+func (a *Api) getInstance(w http.ResponseWriter, r *http.Request) {
+	id := instanceId(r)
+	instance, ok := a.store.GetInstance(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrInstanceNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, newInstanceStatus(instance, a.store.Get(id), a.store.GetInstanceAlerts(id)))
+}
+
+func (a *Api) getInstanceConfig(w http.ResponseWriter, r *http.Request) {
+	instance, ok := a.store.GetInstance(instanceId(r))
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrInstanceNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, newInstanceConfig(instance))
+}
+
+func (a *Api) addInstance(w http.ResponseWriter, r *http.Request) {
+	config, err := readInstanceConfig(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	instance, err := a.supervisor.Add(config.Instance())
+	if err != nil {
+		writeSupervisorError(w, err)
+		return
+	}
+	w.Header().Set("Location", Prefix+"instances/"+instance.Id)
+	writeJSON(w, http.StatusCreated, newInstanceConfig(instance))
+}
+
+func (a *Api) updateInstance(w http.ResponseWriter, r *http.Request) {
+	config, err := readInstanceConfig(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id := instanceId(r)
+	if config.Id == "" {
+		config.Id = id
+	} else if config.Id != id {
+		writeError(w, http.StatusBadRequest, ErrIdMismatch)
+		return
+	}
+	instance, err := a.supervisor.Update(config.Instance())
+	if err != nil {
+		writeSupervisorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newInstanceConfig(instance))
+}
+
+func (a *Api) deleteInstance(w http.ResponseWriter, r *http.Request) {
+	if err := a.supervisor.Delete(instanceId(r)); err != nil {
+		writeSupervisorError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) pauseInstance(w http.ResponseWriter, r *http.Request) {
+	instance, err := a.supervisor.Pause(instanceId(r))
+	if err != nil {
+		writeSupervisorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newInstanceConfig(instance))
+}
+
+func (a *Api) resumeInstance(w http.ResponseWriter, r *http.Request) {
+	instance, err := a.supervisor.Resume(instanceId(r))
+	if err != nil {
+		writeSupervisorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newInstanceConfig(instance))
+}
+
+// Reads the instance of the request's body, unknown fields are rejected to not ignore a typo.
+func readInstanceConfig(r *http.Request) (InstanceConfig, error) {
+	var config InstanceConfig
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("%v: %v", ErrBodyNotValid, err)
+	}
+	return config, nil
+}
+
+func (a *Api) stats(w http.ResponseWriter, r *http.Request) {
+	id := instanceId(r)
+	from, to, err := parseRange(r.URL.Query(), time.Now(), defaultStatsWindow)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	instanceStat, err := a.store.Stats(id, from, to)
+	if err != nil && err != stat.ErrDataSizeInvalid { // No data in the range is an UNKOWN stat
+		logger.Logger.Errorf("Could not compute stats of %s: %v", id, err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newStats(id, instanceStat, from, to))
+}
+
+func (a *Api) alerts(w http.ResponseWriter, r *http.Request) {
+	ids, ok := a.ids(r.URL.Query())
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrInstanceNotFound)
+		return
+	}
+	mapAllAlerts := a.store.GetAllAlerts()
+	views := make(map[string]Alerts)
+	for _, id := range ids {
+		views[id] = newAlerts(mapAllAlerts[id])
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (a *Api) incidents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ids, ok := a.ids(query)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrInstanceNotFound)
+		return
+	}
+	now := time.Now()
+	from, to, err := parseRange(query, now, defaultIncidentsWindow)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	views := []Incident{}
+	for _, id := range ids {
+		for _, incident := range a.store.Incidents(id, from, to) {
+			views = append(views, newIncident(id, incident, now))
+		}
+	}
+	// Most recent first
+	sort.SliceStable(views, func(i, j int) bool { return views[i].Start.After(views[j].Start) })
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (a *Api) addIncidentNote(w http.ResponseWriter, r *http.Request) {
+	var note NewIncidentNote
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&note); err != nil || note.Id == "" || note.Start == "" || strings.TrimSpace(note.Text) == "" {
+		writeError(w, http.StatusBadRequest, ErrNoteNotValid)
+		return
+	}
+	start, err := parseTime(note.Start)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	now := time.Now()
+	incident, err := a.store.AddIncidentNote(note.Id, start, types.IncidentNote{Timestamp: now, Text: note.Text})
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newIncident(note.Id, incident, now))
+}
+
+// Returns the id given in the query or every registered id, ok is false if the given id is not registered.
+func (a *Api) ids(query url.Values) (ids []string, ok bool) {
+	if id := query.Get("id"); id != "" {
+		_, ok := a.store.GetInstance(id)
+		return []string{id}, ok
+	}
+	for id := range a.store.GetAllInstances() {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, true
+}
+
+// Parses the range [from, to] of the query: to is now if not given,
+// from is to minus the window if not given, the window is the default one if not given.
+// Returns error if a time or the window is not valid, or from is after to.
+func parseRange(query url.Values, now time.Time, defaultWindow time.Duration) (from, to time.Time, err error) {
+	to = now
+	if value := query.Get("to"); value != "" {
+		if to, err = parseTime(value); err != nil {
+			return from, to, err
+		}
+	}
+	window := defaultWindow
+	if value := query.Get("window"); value != "" {
+		if window, err = time.ParseDuration(value); err != nil || window <= 0 {
+			return from, to, ErrWindowNotValid
+		}
+	}
+	from = to.Add(-window)
+	if value := query.Get("from"); value != "" {
+		if from, err = parseTime(value); err != nil {
+			return from, to, err
+		}
+	}
+	if from.After(to) {
+		return from, to, ErrRangeNotValid
+	}
+	return from, to, nil
+}
+
+// Parses a RFC3339 time or unix seconds.
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, ErrTimeNotValid
+	}
+	return t, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Logger.Errorf("Failed to write the api response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// Writes an error of the supervisor: 404 if the instance is not found, 409 if its id exists,
+// 400 otherwise since the instance is not valid.
+func writeSupervisorError(w http.ResponseWriter, err error) {
+	switch err {
+	case supervisor.ErrInstanceNotFound:
+		writeError(w, http.StatusNotFound, err)
+	case supervisor.ErrIdDuplicated:
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
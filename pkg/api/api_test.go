@@ -0,0 +1,176 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/api"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/supervisor"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+const token = "secret"
+
+func get(t *testing.T, handler http.Handler, method, target string, code int, v interface{}) {
+	do(t, handler, method, target, "", code, v)
+}
+
+func do(t *testing.T, handler http.Handler, method, target, body string, code int, v interface{}) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(rec, req)
+	if rec.Code != code {
+		t.Fatalf("%s %s = %d; want %d, body: %s", method, target, rec.Code, code, rec.Body.String())
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s returned invalid JSON: %v", method, target, err)
+		}
+	}
+}
+
+func TestApi(t *testing.T) {
+	store := safe_store.New()
+	a := api.NewWithToken(store, supervisor.New(store), token)
+	store.Register(types.Instance{Id: "first", Url: "http://example.com", HttpMethod: "GET", CheckInterval: time.Minute, Timeout: time.Second})
+	store.Put("first", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 20*time.Millisecond, 0))
+	store.Put("first", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusNotFound, 300*time.Millisecond, 0))
+
+	var statuses []api.InstanceStatus
+	get(t, a, http.MethodGet, "/api/instances", http.StatusOK, &statuses)
+	if len(statuses) != 1 || statuses[0].Id != "first" || statuses[0].LastStatus != types.Down || statuses[0].LastHttpStatusCode != http.StatusNotFound {
+		t.Errorf("GET /api/instances = %+v; want first down with a 404", statuses)
+	}
+	if !statuses[0].Down {
+		t.Errorf("GET /api/instances first is not down at 50%% availability")
+	}
+
+	var stats api.Stats
+	get(t, a, http.MethodGet, "/api/instances/first/stats?window=1h", http.StatusOK, &stats)
+	if stats.Availability != 50 || stats.FailuresCount != 1 || stats.StatusCodes["404"] != 1 || stats.ErrorClasses[types.ErrorClassBadStatus] != 1 {
+		t.Errorf("GET /api/instances/first/stats = %+v; want 50%% availability with one 404", stats)
+	}
+	if last := stats.Histogram[len(stats.Histogram)-1]; last.Le != "+Inf" {
+		t.Errorf("Last histogram bucket le = %s; want +Inf", last.Le)
+	}
+
+	var alerts map[string]api.Alerts
+	get(t, a, http.MethodGet, "/api/alerts?id=first", http.StatusOK, &alerts)
+	if n := len(alerts["first"].Availability); n == 0 || !alerts["first"].Availability[n-1].Down {
+		t.Errorf("GET /api/alerts = %+v; want a down alert last", alerts)
+	}
+
+	var incidents []api.Incident
+	get(t, a, http.MethodGet, "/api/incidents", http.StatusOK, &incidents)
+	if len(incidents) != 1 || !incidents[0].Ongoing || incidents[0].End != nil {
+		t.Fatalf("GET /api/incidents = %+v; want an ongoing incident", incidents)
+	}
+	var incident api.Incident
+	start := incidents[0].Start.Format(time.RFC3339Nano)
+	do(t, a, http.MethodPost, "/api/incidents/notes", `{"id":"first","start":"`+start+`","text":"Investigating"}`, http.StatusCreated, &incident)
+	if len(incident.Notes) != 1 || incident.Notes[0].Text != "Investigating" {
+		t.Errorf("POST /api/incidents/notes = %+v; want the incident with the note", incident)
+	}
+	do(t, a, http.MethodPost, "/api/incidents/notes", `{"id":"first","start":"0","text":"Investigating"}`, http.StatusNotFound, nil)
+	do(t, a, http.MethodPost, "/api/incidents/notes", `{"id":"first","start":"`+start+`"}`, http.StatusBadRequest, nil)
+
+	var health api.Health
+	get(t, a, http.MethodGet, "/api/health", http.StatusOK, &health)
+	if health.Status != "ok" || health.Instances != 1 {
+		t.Errorf("GET /api/health = %+v; want ok with one instance", health)
+	}
+
+	// Stale instance: never checked within two intervals and its timeout
+	store.Register(types.Instance{Id: "stale", Url: "http://example.com"})
+	get(t, a, http.MethodGet, "/api/health", http.StatusServiceUnavailable, &health)
+	if health.Status != "degraded" || len(health.Stale) != 1 || health.Stale[0] != "stale" {
+		t.Errorf("GET /api/health = %+v; want degraded by stale", health)
+	}
+
+	get(t, a, http.MethodGet, "/api/instances/unknown", http.StatusNotFound, nil)
+	get(t, a, http.MethodGet, "/api/alerts?id=unknown", http.StatusNotFound, nil)
+	get(t, a, http.MethodGet, "/api/instances/first/stats?from=yesterday", http.StatusBadRequest, nil)
+	get(t, a, http.MethodGet, "/api/instances/first/stats?window=-1h", http.StatusBadRequest, nil)
+	get(t, a, http.MethodPost, "/api/alerts", http.StatusMethodNotAllowed, nil)
+}
+
+func TestApiInstances(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	store := safe_store.New()
+	s := supervisor.New(store)
+	defer s.StopAll()
+	a := api.NewWithToken(store, s, token)
+
+	var config api.InstanceConfig
+	do(t, a, http.MethodPost, "/api/instances", `{"id":"first","url":"`+server.URL+`","checkInterval":5,"slo":{"target":99.9}}`, http.StatusCreated, &config)
+	if config.CheckInterval != 5 || config.Timeout != 10 || config.HttpMethod != types.HTTPGet || config.Slo.WindowDays != types.DefaultSloWindowDays {
+		t.Errorf("POST /api/instances = %+v; want the defaults", config)
+	}
+	do(t, a, http.MethodPost, "/api/instances", `{"id":"first","url":"`+server.URL+`"}`, http.StatusConflict, nil)
+	do(t, a, http.MethodPost, "/api/instances", `{"id":"second","url":"`+server.URL+`","checkInterval":1}`, http.StatusBadRequest, nil)
+	do(t, a, http.MethodPost, "/api/instances", `{"id":"second","urll":"`+server.URL+`"}`, http.StatusBadRequest, nil)
+
+	do(t, a, http.MethodPut, "/api/instances/first", `{"url":"`+server.URL+`","httpMethod":"POST"}`, http.StatusOK, &config)
+	if config.Id != "first" || config.HttpMethod != types.HTTPPost || config.Slo.Enabled() {
+		t.Errorf("PUT /api/instances/first = %+v; want the instance replaced", config)
+	}
+	do(t, a, http.MethodPut, "/api/instances/first", `{"id":"second","url":"`+server.URL+`"}`, http.StatusBadRequest, nil)
+
+	do(t, a, http.MethodPost, "/api/instances/first/pause", "", http.StatusOK, &config)
+	var status api.InstanceStatus
+	get(t, a, http.MethodGet, "/api/instances/first", http.StatusOK, &status)
+	if !status.Paused {
+		t.Errorf("GET /api/instances/first = %+v; want it paused", status)
+	}
+	do(t, a, http.MethodPost, "/api/instances/first/resume", "", http.StatusOK, &config)
+	if config.Paused {
+		t.Errorf("POST /api/instances/first/resume = %+v; want it running", config)
+	}
+	get(t, a, http.MethodGet, "/api/instances/first/pause", http.StatusMethodNotAllowed, nil)
+
+	get(t, a, http.MethodGet, "/api/instances/first/config", http.StatusOK, &config)
+	body, _ := json.Marshal(config)
+	do(t, a, http.MethodPut, "/api/instances/first", string(body), http.StatusOK, nil)
+
+	do(t, a, http.MethodDelete, "/api/instances/first", "", http.StatusNoContent, nil)
+	get(t, a, http.MethodGet, "/api/instances/first", http.StatusNotFound, nil)
+	var statuses []api.InstanceStatus
+	get(t, a, http.MethodGet, "/api/instances", http.StatusOK, &statuses)
+	if len(statuses) != 0 {
+		t.Errorf("GET /api/instances = %+v; want no instance", statuses)
+	}
+}
+
+// Requests changing the state need the api token, the api is read only without one.
+func TestApiToken(t *testing.T) {
+	store := safe_store.New()
+	s := supervisor.New(store)
+	defer s.StopAll()
+	for _, tc := range []struct {
+		handler       http.Handler
+		authorization string
+		code          int
+	}{
+		{api.New(store, s), "Bearer " + token, http.StatusForbidden},
+		{api.NewWithToken(store, s, token), "", http.StatusUnauthorized},
+		{api.NewWithToken(store, s, token), "Bearer wrong", http.StatusUnauthorized},
+		{api.NewWithToken(store, s, token), "Bearer " + token, http.StatusBadRequest}, // Authorized, the body is not valid
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/instances", strings.NewReader("{}"))
+		req.Header.Set("Authorization", tc.authorization)
+		tc.handler.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("POST /api/instances with %q = %d; want %d", tc.authorization, rec.Code, tc.code)
+		}
+	}
+	get(t, api.New(store, s), http.MethodGet, "/api/instances", http.StatusOK, nil)
+}
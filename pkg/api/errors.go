@@ -0,0 +1,35 @@
+package api
+
+import "errors"
+
+var (
+	// ErrInstanceNotFound is returned when no instance is registered under the requested id.
+	ErrInstanceNotFound = errors.New("Instance not found")
+
+	// ErrTimeNotValid is returned when from or to is neither a RFC3339 time nor unix seconds.
+	ErrTimeNotValid = errors.New("Time must be RFC3339 (2006-01-02T15:04:05Z) or unix seconds")
+
+	// ErrWindowNotValid is returned when the window is not a positive duration, e.g. 24h.
+	ErrWindowNotValid = errors.New("Window must be a positive duration, e.g. 10m or 24h")
+
+	// ErrRangeNotValid is returned when from is after to.
+	ErrRangeNotValid = errors.New("From must be before to")
+
+	// ErrBodyNotValid is returned when the request's body is not an instance in JSON.
+	ErrBodyNotValid = errors.New("Body must be an instance in JSON")
+
+	// ErrNoteNotValid is returned when a note is not an instance id, the start of its incident and a text in JSON.
+	ErrNoteNotValid = errors.New("Note must have the instance id, the start of the incident and a text")
+
+	// ErrIdMismatch is returned when the id of the body is not the id of the url.
+	ErrIdMismatch = errors.New("Id of the body must be the id of the url")
+
+	// ErrReadOnly is returned when a request changes the state while no api token is set.
+	ErrReadOnly = errors.New("Api is read only, set an api token to manage the instances")
+
+	// ErrUnauthorized is returned when a request changing the state does not have the api token as bearer.
+	ErrUnauthorized = errors.New("Unauthorized, the api token must be given as bearer")
+
+	// ErrMethodNotAllowed is returned when the endpoint does not support the request's method.
+	ErrMethodNotAllowed = errors.New("Method not allowed")
+)
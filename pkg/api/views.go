@@ -0,0 +1,298 @@
+package api
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/latency"
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+// The JSON views of the store's types: response times and durations are in seconds, times are RFC3339.
+
+// InstanceStatus is an instance with the result of its last check and its alerts firing.
+type InstanceStatus struct {
+	Id                 string       `json:"id"`
+	Url                string       `json:"url"`
+	HttpMethod         string       `json:"httpMethod"`
+	CheckInterval      float64      `json:"checkInterval"`
+	Tags               []string     `json:"tags,omitempty"`
+	Group              string       `json:"group,omitempty"`
+	Paused             bool         `json:"paused"`
+	LastStatus         string       `json:"lastStatus"`
+	LastCheck          *time.Time   `json:"lastCheck,omitempty"`
+	LastHttpStatusCode int          `json:"lastHttpStatusCode,omitempty"`
+	LastResponseTime   float64      `json:"lastResponseTime,omitempty"`
+	LastErrorClass     string       `json:"lastErrorClass,omitempty"`
+	Down               bool         `json:"down"`
+	Firing             []AlertEvent `json:"firing"`
+}
+
+func newInstanceStatus(instance types.Instance, responses []types.Response, alerts types.Alerts) InstanceStatus {
+	status := InstanceStatus{
+		Id:            instance.Id,
+		Url:           instance.Url,
+		HttpMethod:    instance.HttpMethod,
+		CheckInterval: instance.CheckInterval.Seconds(),
+		Tags:          instance.Tags,
+		Group:         instance.Group,
+		Paused:        instance.Paused,
+		LastStatus:    types.Unkown,
+		Down:          alerts.Down(),
+		Firing:        []AlertEvent{},
+	}
+	if n := len(responses); n > 0 {
+		last := responses[n-1]
+		lastCheck := time.Unix(0, last.Timestamp())
+		status.LastStatus = last.Status()
+		status.LastCheck = &lastCheck
+		status.LastHttpStatusCode = last.HttpStatusCode()
+		status.LastResponseTime = last.ResponseTime().Seconds()
+		status.LastErrorClass = last.ErrorClass()
+	}
+	for _, event := range alerts.Firing() {
+		status.Firing = append(status.Firing, newAlertEvent(event))
+	}
+	return status
+}
+
+// InstanceConfig is an instance as added or updated through the api, durations are in seconds like in the configuration file.
+type InstanceConfig struct {
+	Id                             string                 `json:"id"`
+	Url                            string                 `json:"url"`
+	HttpMethod                     string                 `json:"httpMethod,omitempty"`
+	Timeout                        float64                `json:"timeout,omitempty"`
+	HttpAcceptedResponseStatusCode []int                  `json:"httpAcceptedResponseStatusCode,omitempty"`
+	CheckInterval                  float64                `json:"checkInterval,omitempty"`
+	Data                           map[string]interface{} `json:"data,omitempty"`
+	Rules                          []types.Rule           `json:"rules,omitempty"`
+	ApdexT                         float64                `json:"apdexT,omitempty"`
+	Slo                            types.Slo              `json:"slo"`
+	AnomalyDeviations              float64                `json:"anomalyDeviations,omitempty"`
+	Content                        types.Content          `json:"content"`
+	Tags                           []string               `json:"tags,omitempty"`
+	Paused                         bool                   `json:"paused"`
+	Group                          string                 `json:"group,omitempty"`
+}
+
+func newInstanceConfig(instance types.Instance) InstanceConfig {
+	return InstanceConfig{
+		Id:                             instance.Id,
+		Url:                            instance.Url,
+		HttpMethod:                     instance.HttpMethod,
+		Timeout:                        instance.Timeout.Seconds(),
+		HttpAcceptedResponseStatusCode: instance.HttpAcceptedResponseStatusCode,
+		CheckInterval:                  instance.CheckInterval.Seconds(),
+		Data:                           instance.Data,
+		Rules:                          instance.Rules,
+		ApdexT:                         instance.ApdexT,
+		Slo:                            instance.Slo,
+		AnomalyDeviations:              instance.AnomalyDeviations,
+		Content:                        instance.Content,
+		Tags:                           instance.Tags,
+		Paused:                         instance.Paused,
+		Group:                          instance.Group,
+	}
+}
+
+// Instance returns the instance to validate, durations converted from seconds.
+func (config InstanceConfig) Instance() types.Instance {
+	return types.Instance{
+		Id:                             config.Id,
+		Url:                            config.Url,
+		HttpMethod:                     config.HttpMethod,
+		Timeout:                        time.Duration(config.Timeout * float64(time.Second)),
+		HttpAcceptedResponseStatusCode: config.HttpAcceptedResponseStatusCode,
+		CheckInterval:                  time.Duration(config.CheckInterval * float64(time.Second)),
+		Data:                           config.Data,
+		Rules:                          config.Rules,
+		ApdexT:                         config.ApdexT,
+		Slo:                            config.Slo,
+		AnomalyDeviations:              config.AnomalyDeviations,
+		Content:                        config.Content,
+		Tags:                           config.Tags,
+		Paused:                         config.Paused,
+		Group:                          config.Group,
+	}
+}
+
+// Stats are the stats of an instance over [From, To].
+type Stats struct {
+	Id            string            `json:"id"`
+	From          time.Time         `json:"from"`
+	To            time.Time         `json:"to"`
+	LastStatus    string            `json:"lastStatus"`
+	Availability  float64           `json:"availability"`
+	Apdex         float64           `json:"apdex"`
+	FailuresCount int               `json:"failuresCount"`
+	MaxRt         float64           `json:"maxRt"`
+	MinRt         float64           `json:"minRt"`
+	AvgRt         float64           `json:"avgRt"`
+	P50Rt         float64           `json:"p50Rt"`
+	P90Rt         float64           `json:"p90Rt"`
+	P95Rt         float64           `json:"p95Rt"`
+	P99Rt         float64           `json:"p99Rt"`
+	StdDevRt      float64           `json:"stdDevRt"`
+	Histogram     []HistogramBucket `json:"histogram"`
+	StatusCodes   map[string]int    `json:"statusCodes"`
+	ErrorClasses  map[string]int    `json:"errorClasses"`
+	ContentLength int64             `json:"contentLength"`
+	Incidents     int               `json:"incidents"`
+	Mttr          float64           `json:"mttr"` // -1 when there is no incident resolved in the range
+	Mtbf          float64           `json:"mtbf"` // -1 when there is no incident in the range
+}
+
+// HistogramBucket counts the response times lower or equal to Le, +Inf for the last bucket like Prometheus.
+type HistogramBucket struct {
+	Le    string `json:"le"`
+	Count int    `json:"count"`
+}
+
+func newStats(id string, s stat.Stat, from, to time.Time) Stats {
+	stats := Stats{
+		Id:            id,
+		From:          from,
+		To:            to,
+		LastStatus:    s.LastStatus,
+		Availability:  s.Availability,
+		Apdex:         s.Apdex,
+		FailuresCount: s.FailuresCount,
+		MaxRt:         s.MaxRt,
+		MinRt:         s.MinRt,
+		AvgRt:         s.AvgRt,
+		P50Rt:         s.P50Rt,
+		P90Rt:         s.P90Rt,
+		P95Rt:         s.P95Rt,
+		P99Rt:         s.P99Rt,
+		StdDevRt:      s.StdDevRt,
+		Histogram:     newHistogram(s.Histogram),
+		StatusCodes:   make(map[string]int),
+		ErrorClasses:  make(map[string]int),
+		ContentLength: s.ContentLength,
+		Incidents:     s.Reliability.IncidentsCount,
+		Mttr:          s.Reliability.Mttr,
+		Mtbf:          s.Reliability.Mtbf,
+	}
+	// JSON keys are strings
+	for code, count := range s.StatusCodes {
+		stats.StatusCodes[strconv.Itoa(code)] = count
+	}
+	for errorClass, count := range s.ErrorClasses {
+		stats.ErrorClasses[errorClass] = count
+	}
+	return stats
+}
+
+// JSON has no infinity, the bounds are written as strings.
+func newHistogram(histogram []latency.HistogramBucket) []HistogramBucket {
+	buckets := []HistogramBucket{}
+	for _, bucket := range histogram {
+		le := "+Inf"
+		if !math.IsInf(bucket.Le, 1) {
+			le = strconv.FormatFloat(bucket.Le, 'g', -1, 64)
+		}
+		buckets = append(buckets, HistogramBucket{Le: le, Count: bucket.Count})
+	}
+	return buckets
+}
+
+// Alerts are the availability alerts and the other alert events of an instance, oldest first.
+type Alerts struct {
+	Availability []AvailabilityAlert `json:"availability"`
+	Events       []AlertEvent        `json:"events"`
+}
+
+// AvailabilityAlert is a down alert if the availability is below the threshold, a resume alert otherwise.
+type AvailabilityAlert struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Availability float64   `json:"availability"`
+	Down         bool      `json:"down"`
+}
+
+// AlertEvent is an alert that started firing or got resolved.
+type AlertEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Value     float64   `json:"value"`
+	Firing    bool      `json:"firing"`
+}
+
+func newAlerts(alerts types.Alerts) Alerts {
+	view := Alerts{Availability: []AvailabilityAlert{}, Events: []AlertEvent{}}
+	for _, alert := range alerts.Alerts {
+		view.Availability = append(view.Availability, AvailabilityAlert{
+			Timestamp:    alert.Timestamp,
+			Availability: alert.Availability,
+			Down:         alert.Availability < types.AvaiabilityThreshold,
+		})
+	}
+	for _, event := range alerts.Events {
+		view.Events = append(view.Events, newAlertEvent(event))
+	}
+	return view
+}
+
+func newAlertEvent(event types.AlertEvent) AlertEvent {
+	return AlertEvent{Timestamp: event.Timestamp, Kind: event.Kind, Name: event.Name, Value: event.Value, Firing: event.Firing}
+}
+
+// Incident is a period an instance was down, End is omitted while it is ongoing.
+type Incident struct {
+	Id              string         `json:"id"`
+	Start           time.Time      `json:"start"`
+	End             *time.Time     `json:"end,omitempty"`
+	Ongoing         bool           `json:"ongoing"`
+	Duration        float64        `json:"duration"`
+	MinAvailability float64        `json:"minAvailability"`
+	ErrorClasses    map[string]int `json:"errorClasses"`
+	Notes           []IncidentNote `json:"notes"`
+}
+
+// IncidentNote is a message of an operator about an incident.
+type IncidentNote struct {
+	Timestamp time.Time `json:"timestamp"`
+	Text      string    `json:"text"`
+}
+
+// NewIncidentNote is a note to add to the incident of the instance Id started at Start.
+type NewIncidentNote struct {
+	Id    string `json:"id"`
+	Start string `json:"start"` // RFC3339 or unix seconds, compared to the second
+	Text  string `json:"text"`
+}
+
+func newIncident(id string, incident types.Incident, now time.Time) Incident {
+	view := Incident{
+		Id:              id,
+		Start:           incident.Start,
+		Ongoing:         incident.Ongoing(),
+		Duration:        incident.Duration(now).Seconds(),
+		MinAvailability: incident.MinAvailability,
+		ErrorClasses:    incident.ErrorClasses,
+		Notes:           []IncidentNote{},
+	}
+	for _, note := range incident.Notes {
+		view.Notes = append(view.Notes, IncidentNote{Timestamp: note.Timestamp, Text: note.Text})
+	}
+	if !incident.Ongoing() {
+		end := incident.End
+		view.End = &end
+	}
+	if view.ErrorClasses == nil {
+		view.ErrorClasses = map[string]int{}
+	}
+	return view
+}
+
+// Health tells whether every instance is being checked on time.
+// An instance is stale if it has not been checked for two check intervals and its timeout.
+type Health struct {
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"startedAt"`
+	Uptime    float64   `json:"uptime"`
+	Instances int       `json:"instances"`
+	Stale     []string  `json:"stale"`
+}
@@ -0,0 +1,65 @@
+// Package badge renders shields style SVG badges of the instances: status, uptime and average latency.
+package badge
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+const PKG = "badge"
+
+// Colors of the badges' messages, the ones of shields.io.
+const (
+	ColorBrightGreen = "#4c1"
+	ColorGreen       = "#97ca00"
+	ColorYellow      = "#dfb317"
+	ColorOrange      = "#fe7d37"
+	ColorRed         = "#e05d44"
+	ColorGrey        = "#9f9f9f"
+	labelColor       = "#555"
+)
+
+// Approximate widths in pixels of the Verdana 11px characters badges are drawn with.
+const (
+	narrowChars = " !',.:;Iijlt|"
+	wideChars   = "MWmw%@"
+	narrowWidth = 4
+	charWidth   = 7
+	wideWidth   = 10
+	padding     = 10
+)
+
+// Returns the approximate width of a text in pixels.
+func textWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(narrowChars, r):
+			width += narrowWidth
+		case strings.ContainsRune(wideChars, r):
+			width += wideWidth
+		default:
+			width += charWidth
+		}
+	}
+	return width
+}
+
+// Render returns the SVG of a flat badge with the label on a grey background and the message on the color.
+func Render(label, message, color string) []byte {
+	labelWidth := textWidth(label) + padding
+	messageWidth := textWidth(message) + padding
+	width := labelWidth + messageWidth
+	label, message = html.EscapeString(label), html.EscapeString(message)
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">`+
+		`<title>%[4]s: %[5]s</title>`+
+		`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+
+		`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>`+
+		`<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="%[7]s"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[4]s</text><text x="%[8]d" y="14">%[4]s</text>`+
+		`<text x="%[9]d" y="15" fill="#010101" fill-opacity=".3">%[5]s</text><text x="%[9]d" y="14">%[5]s</text>`+
+		`</g></svg>`,
+		width, labelWidth, messageWidth, label, message, color, labelColor, labelWidth/2, labelWidth+messageWidth/2))
+}
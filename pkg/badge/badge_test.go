@@ -0,0 +1,66 @@
+package badge_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/badge"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+func TestRender(t *testing.T) {
+	svg := string(badge.Render("status", "<up>", badge.ColorBrightGreen))
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, badge.ColorBrightGreen) || !strings.Contains(svg, "&lt;up&gt;") {
+		t.Errorf("badge.Render() = %s; want an escaped green badge", svg)
+	}
+}
+
+func TestBadges(t *testing.T) {
+	store := safe_store.New()
+	b := badge.New(store)
+	store.Register(types.Instance{Id: "first", Url: "http://example.com", ApdexT: 0.5})
+	store.Put("first", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 100*time.Millisecond, 0))
+	store.Put("first", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 300*time.Millisecond, 0))
+
+	for _, test := range []struct {
+		target string
+		code   int
+		want   []string
+	}{
+		{"/badge/first/status.svg", http.StatusOK, []string{"status: up", badge.ColorBrightGreen, "max-age=5"}},
+		{"/badge/first/uptime-24h.svg", http.StatusOK, []string{"uptime 24h: 100.00%", "max-age=60"}},
+		{"/badge/first/uptime-30d.svg?label=api", http.StatusOK, []string{"api: 100.00%", "max-age=600"}},
+		{"/badge/first/latency-7d.svg", http.StatusOK, []string{"latency 7d: 200ms", badge.ColorBrightGreen}},
+		{"/badge/unknown/status.svg", http.StatusNotFound, []string{"status: instance not found", badge.ColorGrey}},
+		{"/badge/first/uptime-1y.svg", http.StatusNotFound, nil},
+		{"/badge/first/status", http.StatusNotFound, nil},
+	} {
+		rec := httptest.NewRecorder()
+		b.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.target, nil))
+		if rec.Code != test.code {
+			t.Errorf("GET %s = %d; want %d", test.target, rec.Code, test.code)
+			continue
+		}
+		got := rec.Header().Get("Cache-Control") + rec.Body.String()
+		for _, want := range test.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("GET %s does not contain %s, got: %s", test.target, want, got)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/badge/first/status.svg", nil))
+	req := httptest.NewRequest(http.MethodGet, "/badge/first/status.svg", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	b.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("GET with the badge's ETag = %d; want %d", rec.Code, http.StatusNotModified)
+	}
+}
@@ -0,0 +1,178 @@
+package badge
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const (
+	Prefix      = "/badge/"
+	extension   = ".svg"
+	contentType = "image/svg+xml; charset=utf-8"
+	notFound    = "instance not found"
+)
+
+// Windows of the uptime and latency badges, longer windows change slower thus are cached longer.
+var windows = map[string]struct {
+	duration time.Duration
+	maxAge   time.Duration
+}{
+	"24h": {24 * time.Hour, time.Minute},
+	"7d":  {7 * 24 * time.Hour, 10 * time.Minute},
+	"30d": {30 * 24 * time.Hour, 10 * time.Minute},
+}
+
+// Status badges are cached as long as the shortest check interval.
+const statusMaxAge = 5 * time.Second
+
+// Badges serves the badges of the instances on /badge/{id}/{metric}.svg, metric being one of:
+// - status: up, down, paused or unknown.
+// - uptime-24h, uptime-7d, uptime-30d: availability over the window.
+// - latency-24h, latency-7d, latency-30d: average response time over the window.
+// The label can be replaced with the label query parameter.
+type Badges struct {
+	store *safe_store.SafeStore
+}
+
+// New creates badges of the instances registered in the store.
+func New(store *safe_store.SafeStore) *Badges {
+	return &Badges{store: store}
+}
+
+// ServeHTTP renders the badge, 404 with a grey badge if the instance is not registered.
+// Badges have an ETag so caches revalidate them without downloading them again.
+func (b *Badges) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, Prefix)
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || !strings.HasSuffix(parts[1], extension) {
+		http.NotFound(w, r)
+		return
+	}
+	id, metric := parts[0], strings.TrimSuffix(parts[1], extension)
+	_, registered := b.store.GetInstance(id)
+	label, message, color, maxAge, ok := b.badge(id, metric, registered, time.Now())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if custom := r.URL.Query().Get("label"); custom != "" {
+		label = custom
+	}
+	code := http.StatusOK
+	if !registered {
+		code = http.StatusNotFound
+	}
+	svg := Render(label, message, color)
+	sum := sha1.Sum(svg)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	if code == http.StatusOK && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(svg)
+}
+
+// Returns the label, message and color of the instance's badge and how long it can be cached.
+// Instances not registered have an instance not found badge, their stats are not computed.
+// ok is false if the metric is unknown.
+func (b *Badges) badge(id, metric string, registered bool, now time.Time) (label, message, color string, maxAge time.Duration, ok bool) {
+	if metric == "status" {
+		if !registered {
+			return "status", notFound, ColorGrey, statusMaxAge, true
+		}
+		message, color = b.status(id)
+		return "status", message, color, statusMaxAge, true
+	}
+	kv := strings.SplitN(metric, "-", 2)
+	if len(kv) != 2 || (kv[0] != "uptime" && kv[0] != "latency") {
+		return "", "", "", 0, false
+	}
+	window, ok := windows[kv[1]]
+	if !ok {
+		return "", "", "", 0, false
+	}
+	label = kv[0] + " " + kv[1]
+	if !registered {
+		return label, notFound, ColorGrey, window.maxAge, true
+	}
+	instanceStat, err := b.store.Stats(id, now.Add(-window.duration), now)
+	if err != nil {
+		if err != stat.ErrDataSizeInvalid {
+			logger.Logger.Errorf("Could not compute stats of %s: %v", id, err)
+		}
+		return label, "no data", ColorGrey, window.maxAge, true
+	}
+	if kv[0] == "uptime" {
+		message, color = uptime(instanceStat.Availability)
+	} else {
+		message, color = b.latency(id, instanceStat.AvgRt)
+	}
+	return label, message, color, window.maxAge, true
+}
+
+func (b *Badges) status(id string) (message, color string) {
+	instance, _ := b.store.GetInstance(id)
+	responses := b.store.Get(id)
+	switch {
+	case instance.Paused:
+		return "paused", ColorGrey
+	case len(responses) == 0:
+		return "unknown", ColorGrey
+	case b.store.GetInstanceAlerts(id).Down() || responses[len(responses)-1].Status() != types.Up:
+		return "down", ColorRed
+	default:
+		return "up", ColorBrightGreen
+	}
+}
+
+// Colors the availability like the status page bars, with more shades below 99.9%.
+func uptime(availability float64) (message, color string) {
+	message = fmt.Sprintf("%.2f%%", availability)
+	switch {
+	case availability >= 99.9:
+		return message, ColorBrightGreen
+	case availability >= 99:
+		return message, ColorGreen
+	case availability >= 97:
+		return message, ColorYellow
+	case availability >= types.AvaiabilityThreshold:
+		return message, ColorOrange
+	default:
+		return message, ColorRed
+	}
+}
+
+// Colors the average response time by its Apdex zone against the instance's target time.
+func (b *Badges) latency(id string, avgRt float64) (message, color string) {
+	apdexT := types.DefaultApdexT
+	if instance, ok := b.store.GetInstance(id); ok && instance.ApdexT > 0 {
+		apdexT = instance.ApdexT
+	}
+	message = time.Duration(avgRt * float64(time.Second)).Round(time.Millisecond).String()
+	switch {
+	case avgRt <= apdexT:
+		return message, ColorBrightGreen
+	case avgRt <= 4*apdexT:
+		return message, ColorYellow
+	default:
+		return message, ColorRed
+	}
+}
@@ -0,0 +1,51 @@
+package config_file
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// durationType is the type of the fields decoded by durationHook.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// durationHook decodes the durations of the configuration: Go duration strings such as "500ms" or "1m30s",
+// or numbers of seconds ("10", 10 or 0.5) as written by the previous versions.
+func durationHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != durationType {
+		return data, nil
+	}
+	switch value := data.(type) {
+	case string:
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+			return time.Duration(seconds * float64(time.Second)), nil
+		}
+		return time.ParseDuration(value)
+	case int:
+		return time.Duration(value) * time.Second, nil
+	case int64:
+		return time.Duration(value) * time.Second, nil
+	case uint64:
+		return time.Duration(value) * time.Second, nil
+	case float64:
+		return time.Duration(value * float64(time.Second)), nil
+	}
+	return data, nil
+}
+
+// decodeHooks are the hooks the instances are decoded with, like the default ones of viper:
+// durationHook replaces its duration hook and strings are still split into slices on commas.
+var decodeHooks = mapstructure.ComposeDecodeHookFunc(durationHook, mapstructure.StringToSliceHookFunc(","))
+
+// duration is a duration as written in the configuration file:
+// a whole number of seconds as read by every version, else a Go duration string.
+type duration time.Duration
+
+func (d duration) MarshalYAML() (interface{}, error) {
+	if time.Duration(d)%time.Second == 0 {
+		return int64(time.Duration(d) / time.Second), nil
+	}
+	return time.Duration(d).String(), nil
+}
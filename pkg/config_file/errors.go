@@ -0,0 +1,44 @@
+package config_file
+
+import "errors"
+
+var (
+	// ErrIdDuplicated is returned when an instance has the id of a previous instance of the configuration.
+	ErrIdDuplicated = errors.New("Instance id already exists")
+
+	// ErrDefaultsNotValid is returned when the defaults of the configuration are not a mapping.
+	ErrDefaultsNotValid = errors.New("Defaults are not a mapping of settings")
+
+	// ErrTemplatesNotValid is returned when the templates of the configuration are not a mapping of names to settings.
+	ErrTemplatesNotValid = errors.New("Templates are not a mapping of names to settings")
+
+	// ErrInputNotValid is returned when the input of the configuration is not a list of instances.
+	ErrInputNotValid = errors.New("Input is not a list of instances")
+
+	// ErrInstanceNotValid is returned when an instance of the input is not a mapping of settings.
+	ErrInstanceNotValid = errors.New("Instance is not a mapping of settings")
+
+	// ErrExtendsNotValid is returned when an instance extends something else than a template name or a list of names.
+	ErrExtendsNotValid = errors.New("Extends is not a template name or a list of template names")
+
+	// ErrDefaultsDuplicated is returned when several files of the configuration have defaults.
+	ErrDefaultsDuplicated = errors.New("Defaults already defined by another file")
+
+	// ErrTemplateDuplicated is returned when several files of the configuration have a template of the same name.
+	ErrTemplateDuplicated = errors.New("Template already defined by another file")
+
+	// ErrSettingsNotValid is returned when the settings of the configuration are not a mapping.
+	ErrSettingsNotValid = errors.New("Settings are not a mapping of settings")
+
+	// ErrSettingsDuplicated is returned when several files of the configuration have settings.
+	ErrSettingsDuplicated = errors.New("Settings already defined by another file")
+
+	// ErrIncludeNotValid is returned when a file includes something else than a path or a list of paths.
+	ErrIncludeNotValid = errors.New("Include is not a path or a list of paths")
+
+	// ErrTemplateNotFound is returned when an instance extends a template the configuration does not have.
+	ErrTemplateNotFound = errors.New("Template not found")
+
+	// ErrEnvNotSet is returned when a setting has an environment variable that is not set.
+	ErrEnvNotSet = errors.New("Environment variable not set")
+)
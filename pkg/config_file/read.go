@@ -0,0 +1,207 @@
+package config_file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Dainerx/wpam/pkg/types"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// Key of the files a configuration file includes, a path or a glob or a list of them.
+	IncludeKey = "include"
+	// Key of the global settings.
+	SettingsKey = "settings"
+)
+
+// source is an instance as read from a configuration file, before it is resolved.
+type source struct {
+	file  string // Empty if the configuration was not read from a file
+	index int    // Position of the instance in the input of its file, from 0
+	line  int    // Line of the instance in its file from 1, 0 if unknown
+	raw   interface{}
+}
+
+// loader reads a configuration file and the files it includes, the defaults and templates of every file are shared.
+type loader struct {
+	files     []string        // Files read in order, the including file before the included ones
+	read      map[string]bool // Absolute paths of the files read, a file included twice is read once
+	defaults  section
+	templates section
+	settings  section
+	sources   []source
+}
+
+func newLoader() *loader {
+	return &loader{read: make(map[string]bool), templates: section{}}
+}
+
+// Read reads the instances of the configuration at path, see Parse.
+// The configuration is a file, with the files it includes, or a directory whose every .yml and .yaml file is read.
+// Returns error if a file could not be read or parsed or an instance could not be resolved.
+func Read(path string) (types.Configuration, error) {
+	l := newLoader()
+	if err := l.readPath(path); err != nil {
+		return types.Configuration{}, err
+	}
+	return l.configuration()
+}
+
+// ReadSettings reads the settings of the configuration at path, zero values are not set.
+// Returns error if a file could not be read or parsed or the settings are not valid.
+func ReadSettings(path string) (types.Settings, error) {
+	l := newLoader()
+	if err := l.readPath(path); err != nil {
+		return types.Settings{}, err
+	}
+	return l.decodeSettings()
+}
+
+// Files returns the files the configuration at path is read from: the file or the files of the directory,
+// and the files they include.
+// Returns error if a file could not be read or parsed.
+func Files(path string) ([]string, error) {
+	l := newLoader()
+	err := l.readPath(path)
+	return l.files, err
+}
+
+// Reads the file, or every .yml and .yaml file of the directory in name order.
+func (l *loader) readPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return l.readFile(path)
+	}
+	var files []string
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(path, pattern))
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if err := l.readFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads the file unless it was read already.
+func (l *loader) readFile(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if l.read[abs] {
+		return nil
+	}
+	l.read[abs] = true
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	l.files = append(l.files, path)
+	if err := l.add(path, content); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// add adds the defaults, templates, settings and instances of the content of file, then reads the files it includes.
+// Included paths are relative to the directory of file, a glob matching no file includes nothing.
+// Returns error if the content could not be parsed, the defaults or a template are defined by another file already
+// or an included file could not be read.
+func (l *loader) add(file string, content []byte) error {
+	var document section
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return err
+	}
+	if value := document[DefaultsKey]; value != nil {
+		defaults, ok := value.(section)
+		if !ok {
+			return ErrDefaultsNotValid
+		}
+		if l.defaults != nil {
+			return ErrDefaultsDuplicated
+		}
+		l.defaults = defaults
+	}
+	if value := document[TemplatesKey]; value != nil {
+		templates, ok := value.(section)
+		if !ok {
+			return ErrTemplatesNotValid
+		}
+		for name, template := range templates {
+			if _, ok := l.templates[name]; ok {
+				return fmt.Errorf("%w: %v", ErrTemplateDuplicated, name)
+			}
+			l.templates[name] = template
+		}
+	}
+	if value := document[SettingsKey]; value != nil {
+		settings, ok := value.(section)
+		if !ok {
+			return ErrSettingsNotValid
+		}
+		if l.settings != nil {
+			return ErrSettingsDuplicated
+		}
+		l.settings = settings
+	}
+	input, ok := document[InputKey].([]interface{})
+	if !ok && document[InputKey] != nil {
+		return ErrInputNotValid
+	}
+	lines := InstanceLines(content)
+	for i, item := range input {
+		s := source{file: file, index: i, raw: item}
+		if i < len(lines) {
+			s.line = lines[i]
+		}
+		l.sources = append(l.sources, s)
+	}
+
+	var patterns []interface{}
+	switch include := document[IncludeKey].(type) {
+	case nil:
+	case string:
+		patterns = []interface{}{include}
+	case []interface{}:
+		patterns = include
+	default:
+		return ErrIncludeNotValid
+	}
+	for _, p := range patterns {
+		pattern, ok := p.(string)
+		if !ok {
+			return ErrIncludeNotValid
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			matches = []string{pattern} // Not found when read
+		}
+		for _, match := range matches {
+			if err := l.readPath(match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
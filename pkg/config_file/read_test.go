@@ -0,0 +1,173 @@
+package config_file_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/config_file"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte("input:\n  - id: first\n    url: http://example.com\n    timeout: 2\n    checkInterval: 30\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := config_file.Read(path)
+	if err != nil {
+		t.Fatalf("config_file.Read() failed: %v", err)
+	}
+	if len(config.Input) != 1 || config.Input[0].Id != "first" || config.Input[0].Timeout != 2*time.Second || config.Input[0].CheckInterval != 30*time.Second {
+		t.Errorf("config_file.Read() = %+v; want first with seconds converted", config)
+	}
+	if err := ioutil.WriteFile(path, []byte("input:\n  - id: first\n    url: http://example.com\n    timeout: 500ms\n    checkInterval: 1m30s\n  - id: second\n    url: http://example.org\n    timeout: 0.5\n    checkInterval: \"45\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err = config_file.Read(path)
+	if err != nil {
+		t.Fatalf("config_file.Read() failed: %v", err)
+	}
+	for _, instance := range config.Input {
+		if instance.Timeout != 500*time.Millisecond {
+			t.Errorf("Timeout of %s = %v; want 500ms", instance.Id, instance.Timeout)
+		}
+	}
+	if config.Input[0].CheckInterval != 90*time.Second || config.Input[1].CheckInterval != 45*time.Second {
+		t.Errorf("Check intervals = %v, %v; want 1m30s, 45s", config.Input[0].CheckInterval, config.Input[1].CheckInterval)
+	}
+	if err := ioutil.WriteFile(path, []byte("input:\n  - id: first\n    url: http://example.com\n    timeout: 5 minutes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config_file.Read(path); err == nil {
+		t.Errorf("config_file.Read() of a timeout not a duration succeeded")
+	}
+	if _, err := config_file.Read(filepath.Join(dir, "missing.yml")); err == nil {
+		t.Errorf("config_file.Read() of a missing file succeeded")
+	}
+}
+
+func TestReadIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"config.yml":           "include: [conf.d/*.yml, config.yml]\ntemplates:\n  slow:\n    timeout: 15s\ninput:\n  - id: main\n    url: http://example.com\n",
+		"conf.d/a.yml":         "input:\n  - id: a\n    extends: slow\n    url: http://a.com\n",
+		"conf.d/b.yml":         "include: ../shared/*.yml\ninput:\n  - id: main\n    url: http://b.com\n",
+		"conf.d/ignored.txt":   "not yaml: [",
+		"shared/c.yml":         "input:\n  - id: c\n    url: http://c.com\n",
+		"other/duplicated.yml": "templates:\n  slow:\n    timeout: 20s\n",
+		"other/missing.yml":    "include: nowhere.yml\n",
+		"other/nothing.yml":    "include: empty/*.yml\ninput:\n  - id: d\n    url: http://d.com\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := config_file.Read(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		t.Fatalf("config_file.Read() failed: %v", err)
+	}
+	var ids []string
+	for _, instance := range config.Input {
+		ids = append(ids, instance.Id)
+	}
+	if !reflect.DeepEqual(ids, []string{"main", "a", "main", "c"}) || config.Input[1].Timeout != 15*time.Second {
+		t.Errorf("config_file.Read() = %+v; want the instances of the included files in order", config.Input)
+	}
+	wantFiles := []string{"config.yml", "conf.d/a.yml", "conf.d/b.yml", "shared/c.yml"}
+	if len(config.Files) != len(wantFiles) {
+		t.Fatalf("Files = %v; want %v", config.Files, wantFiles)
+	}
+	for i, file := range wantFiles {
+		if filepath.Clean(config.Files[i]) != filepath.Join(dir, file) {
+			t.Errorf("Files[%d] = %s; want %s", i, config.Files[i], file)
+		}
+	}
+
+	problems, err := config_file.Validate(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		t.Fatalf("config_file.Validate() failed: %v", err)
+	}
+	if len(problems) != 1 || problems[0].File != filepath.Join(dir, "conf.d/b.yml") || problems[0].Line != 3 || problems[0].Err != config_file.ErrIdDuplicated {
+		t.Errorf("config_file.Validate() = %v; want main duplicated in conf.d/b.yml", problems)
+	}
+
+	config, err = config_file.Read(filepath.Join(dir, "shared"))
+	if err != nil || len(config.Input) != 1 || config.Input[0].Id != "c" {
+		t.Errorf("config_file.Read() of a directory = %+v, %v; want the instances of its files", config.Input, err)
+	}
+	if _, err := config_file.Read(filepath.Join(dir, "conf.d")); !errors.Is(err, config_file.ErrTemplateNotFound) {
+		t.Errorf("config_file.Read() of a directory = %v; want %v, the template is defined by config.yml", err, config_file.ErrTemplateNotFound)
+	}
+	if config, err := config_file.Read(filepath.Join(dir, "other/nothing.yml")); err != nil || len(config.Input) != 1 {
+		t.Errorf("config_file.Read() including a glob matching nothing = %+v, %v; want its instance", config.Input, err)
+	}
+	if _, err := config_file.Read(filepath.Join(dir, "other/missing.yml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("config_file.Read() including a missing file = %v; want %v", err, os.ErrNotExist)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "both.yml"), []byte("include: [config.yml, other/duplicated.yml]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config_file.Read(filepath.Join(dir, "both.yml")); !errors.Is(err, config_file.ErrTemplateDuplicated) {
+		t.Errorf("config_file.Read() of a template defined twice = %v; want %v", err, config_file.ErrTemplateDuplicated)
+	}
+}
+
+func TestReadSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("WPAM_TEST_LOG_DIR", "/var/log")
+	defer os.Unsetenv("WPAM_TEST_LOG_DIR")
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte("settings:\n  displayInterval: 30s\n  retention: 24h\n  minTimeout: 0.5\n  logFile: ${WPAM_TEST_LOG_DIR}/wpam.log\ninput: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := types.Settings{DisplayInterval: 30 * time.Second, Retention: 24 * time.Hour, MinTimeout: 500 * time.Millisecond, LogFile: "/var/log/wpam.log"}
+	if settings, err := config_file.ReadSettings(path); err != nil || settings != want {
+		t.Errorf("config_file.ReadSettings() = %+v, %v; want %+v", settings, err, want)
+	}
+	if config, err := config_file.Read(path); err != nil || config.Settings != want {
+		t.Errorf("config_file.Read() settings = %+v, %v; want %+v", config.Settings, err, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("settings:\n  displayInterval: 30s\n  displayIntervall: 1m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config_file.Read(path); err == nil {
+		t.Errorf("config_file.Read() of an unknown setting succeeded")
+	}
+	if _, err := config_file.Validate(path); err == nil {
+		t.Errorf("config_file.Validate() of an unknown setting succeeded")
+	}
+	if err := ioutil.WriteFile(path, []byte("include: other.yml\nsettings:\n  retention: 24h\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.yml"), []byte("settings:\n  retention: 48h\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config_file.ReadSettings(path); !errors.Is(err, config_file.ErrSettingsDuplicated) {
+		t.Errorf("config_file.ReadSettings() of settings defined twice = %v; want %v", err, config_file.ErrSettingsDuplicated)
+	}
+}
@@ -0,0 +1,234 @@
+package config_file
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// Key of the settings every instance starts from.
+	DefaultsKey = "defaults"
+	// Key of the named settings instances extend.
+	TemplatesKey = "templates"
+	// Key of the template or templates an instance extends.
+	ExtendsKey = "extends"
+)
+
+// envVariable matches ${NAME}, and $${NAME} written for a literal ${NAME}.
+var envVariable = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// section is a mapping of the configuration file as parsed.
+type section = map[interface{}]interface{}
+
+// Parse returns the instances of the configuration file's content, files it includes are relative to the current
+// directory. Every instance starts from the defaults, then the templates it extends in order, then its own settings,
+// mappings such as slo or data are merged and other values replaced. ${NAME} is then replaced by the environment
+// variable NAME in every string. Instances are resolved before they are validated.
+// Returns error if the content or an included file could not be parsed or an instance could not be resolved.
+func Parse(content []byte) (types.Configuration, error) {
+	l := newLoader()
+	if err := l.add("", content); err != nil {
+		return types.Configuration{}, err
+	}
+	return l.configuration()
+}
+
+// configuration returns the instances and settings read, see Parse.
+// Returns error if an instance could not be resolved.
+// Returns error if the settings are not valid or an instance could not be resolved.
+func (l *loader) configuration() (types.Configuration, error) {
+	config, problems := l.resolveAll()
+	var err error
+	if config.Settings, err = l.decodeSettings(); err != nil {
+		return config, err
+	}
+	for _, problem := range problems {
+		if problem.Err != nil {
+			return config, fmt.Errorf("%s: %w", problem.Where(), problem.Err)
+		}
+	}
+	return config, nil
+}
+
+// decodeSettings returns the settings read, ${NAME} is replaced by the environment variable NAME in every string.
+// Returns error if a variable is not set or a setting is unknown or not of its type.
+func (l *loader) decodeSettings() (types.Settings, error) {
+	var settings types.Settings
+	if l.settings == nil {
+		return settings, nil
+	}
+	var e expander
+	expanded, err := e.expand(l.settings)
+	if err != nil {
+		return settings, fmt.Errorf("%s: %w", SettingsKey, err)
+	}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       decodeHooks,
+		WeaklyTypedInput: true,
+		ErrorUnused:      true, // A misspelled setting is not silently ignored
+		Result:           &settings,
+	})
+	if err != nil {
+		return settings, err
+	}
+	if err := decoder.Decode(expanded); err != nil {
+		return settings, fmt.Errorf("%s: %w", SettingsKey, err)
+	}
+	return settings, nil
+}
+
+// resolveAll resolves the instances read, see Parse.
+// problems has a problem for every instance, its Err is set if the instance could not be resolved,
+// such an instance is left empty in config but for its id.
+func (l *loader) resolveAll() (config types.Configuration, problems []Problem) {
+	config.Files = l.files
+	config.Templated = len(l.defaults) > 0
+	config.Input = make([]types.Instance, len(l.sources))
+	problems = make([]Problem, len(l.sources))
+	for i, s := range l.sources {
+		problems[i] = Problem{File: s.file, Index: s.index, Line: s.line}
+		raw, ok := s.raw.(section)
+		if !ok {
+			problems[i].Err = ErrInstanceNotValid
+			continue
+		}
+		if _, ok := raw[ExtendsKey]; ok {
+			config.Templated = true
+		}
+		resolved, err := resolve(raw, l.defaults, l.templates)
+		if err == nil {
+			var e expander
+			var expanded interface{}
+			expanded, err = e.expand(resolved)
+			config.Templated = config.Templated || e.expanded
+			if err == nil {
+				err = decode(expanded, &config.Input[i])
+			}
+		}
+		if err != nil {
+			config.Input[i].Id, _ = raw["id"].(string)
+			problems[i].Err = err
+		}
+		problems[i].Id = config.Input[i].Id
+	}
+	return config, problems
+}
+
+// resolve merges the defaults, the templates the instance extends and the instance.
+// Returns error if a template does not exist.
+func resolve(instance section, defaults section, templates section) (section, error) {
+	var names []interface{}
+	switch extends := instance[ExtendsKey].(type) {
+	case nil:
+	case string:
+		names = []interface{}{extends}
+	case []interface{}:
+		names = extends
+	default:
+		return nil, ErrExtendsNotValid
+	}
+	resolved := merge(section{}, defaults, true)
+	for _, name := range names {
+		template, ok := templates[name].(section)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v", ErrTemplateNotFound, name)
+		}
+		resolved = merge(resolved, template, true)
+	}
+	resolved = merge(resolved, instance, true)
+	delete(resolved, ExtendsKey)
+	return resolved, nil
+}
+
+// merge returns a copy of base overridden by override, mappings in both are merged.
+// Keys of the settings of an instance are matched ignoring the case like when they are decoded, fold tells they are.
+func merge(base section, override section, fold bool) section {
+	merged := make(section, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseValue, found := merged[key]
+		if name, ok := key.(string); ok && fold {
+			for other := range merged {
+				if otherName, ok := other.(string); ok && strings.EqualFold(name, otherName) {
+					baseValue, found = merged[other], true
+					delete(merged, other)
+				}
+			}
+		}
+		baseSection, baseIsSection := baseValue.(section)
+		overrideSection, overrideIsSection := value.(section)
+		if found && baseIsSection && overrideIsSection {
+			value = merge(baseSection, overrideSection, false)
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// expander replaces the environment variables of the settings of an instance.
+type expander struct {
+	expanded bool // A variable was replaced
+}
+
+// expand returns a copy of the value where ${NAME} is replaced by the environment variable NAME in every string.
+// Returns error if a variable is not set, an empty variable is replaced by an empty string.
+func (e *expander) expand(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var err error
+		expanded := envVariable.ReplaceAllStringFunc(v, func(match string) string {
+			if strings.HasPrefix(match, "$$") {
+				return match[1:]
+			}
+			e.expanded = true
+			name := match[2 : len(match)-1]
+			env, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("%w: %s", ErrEnvNotSet, name)
+			}
+			return env
+		})
+		return expanded, err
+	case section:
+		expanded := make(section, len(v))
+		for key, item := range v {
+			expandedItem, err := e.expand(item)
+			if err != nil {
+				return nil, err
+			}
+			expanded[key] = expandedItem
+		}
+		return expanded, nil
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			expandedItem, err := e.expand(item)
+			if err != nil {
+				return nil, err
+			}
+			expanded[i] = expandedItem
+		}
+		return expanded, nil
+	}
+	return value, nil
+}
+
+// decode decodes a resolved instance like viper would, with durationHook for its durations.
+func decode(resolved interface{}, instance *types.Instance) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       decodeHooks,
+		WeaklyTypedInput: true,
+		Result:           instance,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(resolved)
+}
@@ -0,0 +1,87 @@
+package config_file_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/config_file"
+)
+
+const templatedConfig = `defaults:
+  timeout: 5s
+  httpAcceptedResponseStatusCode: [200, 204]
+  data:
+    Source: wpam
+templates:
+  api:
+    httpMethod: POST
+    checkInterval: 30s
+    slo:
+      target: 99.9
+  prod:
+    tags: ["env:prod"]
+    slo:
+      windowDays: 7
+input:
+  - id: plain
+    url: http://example.com
+  - id: checkout
+    extends: [api, prod]
+    url: https://${WPAM_TEST_HOST}/checkout
+    Timeout: 2s
+    data:
+      token: ${WPAM_TEST_TOKEN}
+      price: $${amount}
+`
+
+func TestParse(t *testing.T) {
+	os.Setenv("WPAM_TEST_HOST", "shop.example.com")
+	os.Setenv("WPAM_TEST_TOKEN", "")
+	defer os.Unsetenv("WPAM_TEST_HOST")
+	defer os.Unsetenv("WPAM_TEST_TOKEN")
+
+	config, err := config_file.Parse([]byte(templatedConfig))
+	if err != nil {
+		t.Fatalf("config_file.Parse() failed: %v", err)
+	}
+	if !config.Templated || len(config.Input) != 2 {
+		t.Fatalf("config_file.Parse() = %+v; want 2 templated instances", config)
+	}
+	plain := config.Input[0]
+	if plain.Timeout != 5*time.Second || !reflect.DeepEqual(plain.HttpAcceptedResponseStatusCode, []int{200, 204}) || plain.Data["Source"] != "wpam" {
+		t.Errorf("Plain instance = %+v; want the defaults", plain)
+	}
+	checkout := config.Input[1]
+	if checkout.Url != "https://shop.example.com/checkout" {
+		t.Errorf("Url = %s; want the environment variable replaced", checkout.Url)
+	}
+	if checkout.Timeout != 2*time.Second || checkout.CheckInterval != 30*time.Second || checkout.HttpMethod != "POST" {
+		t.Errorf("Checkout instance = %+v; want its timeout over the defaults and the api template", checkout)
+	}
+	if checkout.Slo.Target != 99.9 || checkout.Slo.WindowDays != 7 || !reflect.DeepEqual(checkout.Tags, []string{"env:prod"}) {
+		t.Errorf("Slo = %+v, tags = %v; want the templates merged", checkout.Slo, checkout.Tags)
+	}
+	wantData := map[string]interface{}{"Source": "wpam", "token": "", "price": "${amount}"}
+	if !reflect.DeepEqual(checkout.Data, wantData) {
+		t.Errorf("Data = %v; want %v", checkout.Data, wantData)
+	}
+
+	config, err = config_file.Parse([]byte("input:\n  - id: plain\n    url: http://example.com\n"))
+	if err != nil || config.Templated {
+		t.Errorf("config_file.Parse() = %+v, %v; want an instance not templated", config, err)
+	}
+	for content, want := range map[string]error{
+		"input:\n  - id: a\n    url: http://${WPAM_TEST_NOT_SET}\n":        config_file.ErrEnvNotSet,
+		"input:\n  - id: a\n    url: http://a.com\n    extends: missing\n": config_file.ErrTemplateNotFound,
+		"input:\n  - id: a\n    url: http://a.com\n    extends: {a: b}\n":  config_file.ErrExtendsNotValid,
+		"templates: [a, b]\ninput: []\n":                                   config_file.ErrTemplatesNotValid,
+		"defaults: 10\ninput: []\n":                                        config_file.ErrDefaultsNotValid,
+	} {
+		if _, err := config_file.Parse([]byte(content)); !errors.Is(err, want) {
+			t.Errorf("config_file.Parse(%q) = %v; want %v", content, err, want)
+		}
+	}
+}
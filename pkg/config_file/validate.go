@@ -0,0 +1,110 @@
+package config_file
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+// Problem is an instance of the configuration that is not valid.
+type Problem struct {
+	File  string // File of the instance, empty if the configuration was not read from a file
+	Index int    // Position of the instance in the input of its file, from 0
+	Id    string
+	Line  int // Line of the instance in its file from 1, 0 if unknown
+	Err   error
+}
+
+// String returns the problem with its instance, e.g. instance #2 (google): Url not valid.
+func (problem Problem) String() string {
+	return fmt.Sprintf("%s: %v", problem.instance(), problem.Err)
+}
+
+// Where returns the instance with its file and line if known, e.g. conf.d/team.yml:12: instance #2 (google).
+func (problem Problem) Where() string {
+	instance := problem.instance()
+	switch {
+	case problem.File != "" && problem.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", problem.File, problem.Line, instance)
+	case problem.File != "":
+		return fmt.Sprintf("%s: %s", problem.File, instance)
+	}
+	return instance
+}
+
+func (problem Problem) instance() string {
+	instance := fmt.Sprintf("instance #%d", problem.Index+1)
+	if problem.Id != "" {
+		instance += " (" + problem.Id + ")"
+	}
+	return instance
+}
+
+// Validate reads the configuration at path and validates every instance like they are before running:
+// the checks of website_check plus ids duplicated in any of its files, after the instances are resolved.
+// Every problem is returned, not only the first one.
+// Returns error if a file could not be read or parsed or the settings are not valid.
+func Validate(path string) ([]Problem, error) {
+	l := newLoader()
+	if err := l.readPath(path); err != nil {
+		return nil, err
+	}
+	if _, err := l.decodeSettings(); err != nil {
+		return nil, err
+	}
+	config, resolved := l.resolveAll()
+	store := safe_store.New()
+	seen := make(map[string]bool)
+	var problems []Problem
+	for i, instance := range config.Input {
+		problem := resolved[i]
+		if problem.Err == nil {
+			if _, err := website_check.NewcheckRequestFromInstance(instance, store); err != nil {
+				problem.Err = err
+			} else if seen[instance.Id] {
+				problem.Err = ErrIdDuplicated
+			}
+		}
+		seen[instance.Id] = true
+		if problem.Err != nil {
+			problems = append(problems, problem)
+		}
+	}
+	return problems, nil
+}
+
+// InstanceLines returns the line, from 1, of every instance of the input of the configuration file's content in order.
+// Instances are the items of the block sequence under the top level input key, none is found in a flow sequence.
+func InstanceLines(content []byte) []int {
+	var lines []int
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	inInput := false
+	itemIndent := -1
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == 0 && !strings.HasPrefix(trimmed, "-") {
+			// A top level key starts or ends the input
+			inInput = strings.HasPrefix(trimmed, InputKey+":")
+			continue
+		}
+		if !inInput || !(trimmed == "-" || strings.HasPrefix(trimmed, "- ")) {
+			continue
+		}
+		if itemIndent < 0 {
+			itemIndent = indent
+		}
+		if indent == itemIndent {
+			lines = append(lines, n)
+		}
+	}
+	return lines
+}
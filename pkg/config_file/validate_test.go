@@ -0,0 +1,80 @@
+package config_file_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Dainerx/wpam/pkg/config_file"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+const invalidConfig = `# Instances
+listen: ":9100"
+input:
+  - id: google
+    url: http://google.com
+  - id: google
+    url: http://google.org
+  # Comments are not instances
+  - id: facebook
+    url: not an url
+    tags:
+      - env:prod
+  -
+    url: http://example.com
+other: kept
+`
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte(invalidConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := config_file.Validate(path)
+	if err != nil {
+		t.Fatalf("config_file.Validate() failed: %v", err)
+	}
+	want := []config_file.Problem{
+		{File: path, Index: 1, Id: "google", Line: 6, Err: config_file.ErrIdDuplicated},
+		{File: path, Index: 2, Id: "facebook", Line: 9, Err: website_check.ErrUrlNotValid},
+		{File: path, Index: 3, Line: 13, Err: website_check.ErrIdEmpty},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("config_file.Validate() = %v; want %v", problems, want)
+	}
+	if got := problems[1].String(); got != "instance #3 (facebook): "+website_check.ErrUrlNotValid.Error() {
+		t.Errorf("problem.String() = %s", got)
+	}
+	if got := problems[1].Where(); got != path+":9: instance #3 (facebook)" {
+		t.Errorf("problem.Where() = %s", got)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("input:\n  - id: a\n    url: http://a.com\n    extends: missing\n  - id: b\n    url: http://b.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = config_file.Validate(path)
+	if err != nil {
+		t.Fatalf("config_file.Validate() failed: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Id != "a" || problems[0].Line != 2 || !errors.Is(problems[0].Err, config_file.ErrTemplateNotFound) {
+		t.Errorf("config_file.Validate() = %v; want the instance extending a missing template", problems)
+	}
+}
+
+func TestInstanceLines(t *testing.T) {
+	if got := config_file.InstanceLines([]byte(invalidConfig)); !reflect.DeepEqual(got, []int{4, 6, 9, 13}) {
+		t.Errorf("config_file.InstanceLines() = %v; want [4 6 9 13]", got)
+	}
+	if got := config_file.InstanceLines([]byte("input: [{id: a}]\n")); len(got) != 0 {
+		t.Errorf("config_file.InstanceLines() of a flow sequence = %v; want none", got)
+	}
+}
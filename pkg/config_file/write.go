@@ -0,0 +1,131 @@
+// Package config_file reads and writes the configuration file of wpam.
+package config_file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Dainerx/wpam/pkg/types"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	PKG = "config_file"
+	// Key of the instances in the configuration file.
+	InputKey = "input"
+)
+
+// instance is an instance as written in the configuration file, durations are in seconds when they are whole.
+type instance struct {
+	Id                             string                 `yaml:"id"`
+	Url                            string                 `yaml:"url"`
+	HttpMethod                     string                 `yaml:"httpMethod,omitempty"`
+	Timeout                        duration               `yaml:"timeout,omitempty"`
+	HttpAcceptedResponseStatusCode []int                  `yaml:"httpAcceptedResponseStatusCode,omitempty"`
+	CheckInterval                  duration               `yaml:"checkInterval,omitempty"`
+	Data                           map[string]interface{} `yaml:"data,omitempty"`
+	Rules                          []rule                 `yaml:"rules,omitempty"`
+	ApdexT                         float64                `yaml:"apdexT,omitempty"`
+	Slo                            *slo                   `yaml:"slo,omitempty"`
+	AnomalyDeviations              float64                `yaml:"anomalyDeviations,omitempty"`
+	Content                        *content               `yaml:"content,omitempty"`
+	Tags                           []string               `yaml:"tags,omitempty"`
+	Paused                         bool                   `yaml:"paused,omitempty"`
+	Group                          string                 `yaml:"group,omitempty"`
+}
+
+type rule struct {
+	Metric    string  `yaml:"metric"`
+	Operator  string  `yaml:"operator"`
+	Threshold float64 `yaml:"threshold"`
+}
+
+type slo struct {
+	Target     float64 `yaml:"target"`
+	WindowDays int     `yaml:"windowDays,omitempty"`
+}
+
+type content struct {
+	Hash            bool     `yaml:"hash,omitempty"`
+	Ignore          []string `yaml:"ignore,omitempty"`
+	LengthDeviation float64  `yaml:"lengthDeviation,omitempty"`
+	Expect          string   `yaml:"expect,omitempty"`
+}
+
+func newInstance(i types.Instance) instance {
+	written := instance{
+		Id:                             i.Id,
+		Url:                            i.Url,
+		HttpMethod:                     i.HttpMethod,
+		Timeout:                        duration(i.Timeout),
+		HttpAcceptedResponseStatusCode: i.HttpAcceptedResponseStatusCode,
+		CheckInterval:                  duration(i.CheckInterval),
+		Data:                           i.Data,
+		ApdexT:                         i.ApdexT,
+		AnomalyDeviations:              i.AnomalyDeviations,
+		Tags:                           i.Tags,
+		Paused:                         i.Paused,
+		Group:                          i.Group,
+	}
+	for _, r := range i.Rules {
+		written.Rules = append(written.Rules, rule{Metric: r.Metric, Operator: r.Operator, Threshold: r.Threshold})
+	}
+	if i.Slo.Enabled() {
+		written.Slo = &slo{Target: i.Slo.Target, WindowDays: i.Slo.WindowDays}
+	}
+	if i.Content.Hash || i.Content.LengthDeviation > 0 || i.Content.Expect != "" {
+		written.Content = &content{Hash: i.Content.Hash, Ignore: i.Content.Ignore, LengthDeviation: i.Content.LengthDeviation, Expect: i.Content.Expect}
+	}
+	return written
+}
+
+// WriteInstances replaces the instances of the configuration file by the given ones, its other settings are kept.
+// The file is replaced at once so it is never read half written, its comments are lost.
+// Returns error if the file could not be read, parsed or written.
+func WriteInstances(path string, instances []types.Instance) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var document yaml.MapSlice
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return err
+	}
+	written := make([]instance, 0, len(instances))
+	for _, i := range instances {
+		written = append(written, newInstance(i))
+	}
+	replaced := false
+	for i := range document {
+		if key, ok := document[i].Key.(string); ok && key == InputKey {
+			document[i].Value = written
+			replaced = true
+		}
+	}
+	if !replaced {
+		document = append(document, yaml.MapItem{Key: InputKey, Value: written})
+	}
+	out, err := yaml.Marshal(document)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,54 @@
+package config_file_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/config_file"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+func TestWriteInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte("other: kept\ninput:\n  - id: removed\n    url: http://removed.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	instances := []types.Instance{
+		{Id: "first", Url: "http://example.com", HttpMethod: types.HTTPGet, Timeout: 10 * time.Second, CheckInterval: 5 * time.Second,
+			Slo: types.Slo{Target: 99.9, WindowDays: 30}, Rules: []types.Rule{{Metric: "p95_rt", Operator: ">", Threshold: 2.5}}},
+		{Id: "second", Url: "http://example.org", Timeout: 500 * time.Millisecond, Paused: true},
+	}
+	if err := config_file.WriteInstances(path, instances); err != nil {
+		t.Fatalf("config_file.WriteInstances() failed: %v", err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(content)
+	for _, want := range []string{
+		"other: kept\ninput:\n- id: first\n",
+		"  timeout: 10\n",
+		"  checkInterval: 5\n",
+		"  slo:\n    target: 99.9\n    windowDays: 30\n",
+		"  - metric: p95_rt\n    operator: '>'\n    threshold: 2.5\n",
+		"- id: second\n  url: http://example.org\n  timeout: 500ms\n  paused: true\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Written config does not contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "removed") {
+		t.Errorf("Written config still has the replaced instances, got:\n%s", got)
+	}
+}
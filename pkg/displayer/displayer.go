@@ -3,6 +3,7 @@ package displayer
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/Dainerx/wpam/pkg/types"
 
+	"github.com/Dainerx/wpam/pkg/latency"
+	"github.com/Dainerx/wpam/pkg/slo"
 	"github.com/Dainerx/wpam/pkg/stat"
 	"github.com/fatih/color"
 )
@@ -47,21 +50,95 @@ func colorizeAlert(website string, time time.Time, availability float64) string
 	return colorizedAlertMessage
 }
 
-func DisplayStatsAndAlerts(title string, time time.Time, mapAllAlerts map[string]types.Alerts, mapAllStats map[string]stat.Stat) {
+func colorizeAlertEvent(website string, event types.AlertEvent) string {
+	if event.Firing {
+		return color.RedString("Website " + website + " alert [" + event.Name + "] is firing. Value=" +
+			fmt.Sprintf("%.3f", event.Value) + ", time=" + event.Timestamp.Format(timeFormat))
+	}
+	return color.GreenString("Website " + website + " alert [" + event.Name + "] is resolved. Value=" +
+		fmt.Sprintf("%.3f", event.Value) + ", time=" + event.Timestamp.Format(timeFormat))
+}
+
+// Formats the state of an error budget, red once exhausted.
+func colorizeBudget(budget slo.Budget) string {
+	message := fmt.Sprintf("SLO=%.2f%% over %dd, Availability=%.3f%%, Error budget remaining=%.2f%%",
+		budget.Target, int(budget.Window.Hours()/24), budget.Availability, budget.Remaining*100)
+	if budget.Exhausted() {
+		return color.RedString(message + " (exhausted)")
+	}
+	if budget.Remaining < 0.25 {
+		return color.YellowString(message)
+	}
+	return color.GreenString(message)
+}
+
+// Formats a duration in seconds of the reliability rounded to the second, n/a if it could not be computed.
+func formatReliabilityDuration(seconds float64) string {
+	if seconds < 0 {
+		return "n/a"
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// Formats the non empty buckets of a latency histogram, e.g. <=100ms:3 <=250ms:1 >10s:1.
+func formatHistogram(histogram []latency.HistogramBucket) string {
+	var buckets []string
+	for _, bucket := range histogram {
+		if bucket.Count == 0 {
+			continue
+		}
+		if math.IsInf(bucket.Le, 1) {
+			buckets = append(buckets, fmt.Sprintf(">%v:%d", time.Duration(latency.HistogramBounds[len(latency.HistogramBounds)-1]*float64(time.Second)), bucket.Count))
+		} else {
+			buckets = append(buckets, fmt.Sprintf("<=%v:%d", time.Duration(bucket.Le*float64(time.Second)), bucket.Count))
+		}
+	}
+	return strings.Join(buckets, " ")
+}
+
+// Formats the status codes counts sorted by code, e.g. -1:1 200:5 404:2.
+func formatStatusCodes(statusCodes map[int]int) string {
+	var codes []int
+	for code := range statusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	var counts []string
+	for _, code := range codes {
+		counts = append(counts, fmt.Sprintf("%d:%d", code, statusCodes[code]))
+	}
+	return strings.Join(counts, " ")
+}
+
+// Formats the error classes counts sorted by class, e.g. bad_status:2 timeout:1.
+func formatErrorClasses(errorClasses map[string]int) string {
+	var classes []string
+	for errorClass := range errorClasses {
+		classes = append(classes, errorClass)
+	}
+	sort.Strings(classes)
+	var counts []string
+	for _, errorClass := range classes {
+		counts = append(counts, fmt.Sprintf("%s:%d", errorClass, errorClasses[errorClass]))
+	}
+	return strings.Join(counts, " ")
+}
+
+func DisplayStatsAndAlerts(title string, time time.Time, mapAllUrls map[string]string, mapAllAlerts map[string]types.Alerts, mapAllStats map[string]stat.Stat, mapAllBudgets map[string]slo.Budget) {
 	output := title + newLine
 	output += color.CyanString("Metrics since " + time.Format(timeFormat))
 	output += sep
 	// Sort the map stat to assure the same display every time.
-	var urls []string
-	for url := range mapAllStats {
-		urls = append(urls, url)
+	var ids []string
+	for id := range mapAllStats {
+		ids = append(ids, id)
 	}
-	sort.Strings(urls)
+	sort.Strings(ids)
 
 	// Loop the sorted slice
-	for _, url := range urls {
-		stats := mapAllStats[url]
-		urlColored := color.CyanString(url)
+	for _, id := range ids {
+		stats := mapAllStats[id]
+		idColored := color.CyanString(id)
 		var lastStatusColored string
 		if stats.LastStatus == types.Up {
 			lastStatusColored = color.GreenString(stats.LastStatus)
@@ -76,6 +153,14 @@ func DisplayStatsAndAlerts(title string, time time.Time, mapAllAlerts map[string
 		} else {
 			availabilityColored = color.RedString(fmt.Sprintf("%.2f%%", stats.Availability))
 		}
+		var apdexColored string
+		if stats.Apdex >= 0.85 { // Good or excellent user satisfaction
+			apdexColored = color.GreenString(fmt.Sprintf("%.2f", stats.Apdex))
+		} else if stats.Apdex >= 0.5 {
+			apdexColored = color.YellowString(fmt.Sprintf("%.2f", stats.Apdex))
+		} else {
+			apdexColored = color.RedString(fmt.Sprintf("%.2f", stats.Apdex))
+		}
 		var failuresCountColored string
 		if stats.FailuresCount == 0 {
 			failuresCountColored = color.GreenString(strconv.FormatInt(int64(stats.FailuresCount), 10))
@@ -83,14 +168,31 @@ func DisplayStatsAndAlerts(title string, time time.Time, mapAllAlerts map[string
 			failuresCountColored = color.RedString(strconv.FormatInt(int64(stats.FailuresCount), 10))
 		}
 
-		line := "[" + urlColored + "]"
-		line += fmt.Sprintf("Last status=%s, Availability=%s, Failures count=%s, AvgRt=%.3fs, MaxRt=%.3fs, MinRt=%.3fs, Content Length=%d",
-			lastStatusColored, availabilityColored, failuresCountColored, stats.AvgRt, stats.MaxRt, stats.MinRt, stats.ContentLength)
+		line := "[" + idColored + "]"
+		if url, ok := mapAllUrls[id]; ok {
+			line += "(" + url + ") "
+		}
+		line += fmt.Sprintf("Last status=%s, Availability=%s, Apdex=%s, Failures count=%s, AvgRt=%.3fs, MaxRt=%.3fs, MinRt=%.3fs, Content Length=%d",
+			lastStatusColored, availabilityColored, apdexColored, failuresCountColored, stats.AvgRt, stats.MaxRt, stats.MinRt, stats.ContentLength)
+		line += newLine + fmt.Sprintf("P50Rt=%.3fs, P90Rt=%.3fs, P95Rt=%.3fs, P99Rt=%.3fs, StdDevRt=%.3fs, Histogram=[%s]",
+			stats.P50Rt, stats.P90Rt, stats.P95Rt, stats.P99Rt, stats.StdDevRt, formatHistogram(stats.Histogram))
+		line += newLine + fmt.Sprintf("Status codes=[%s]", formatStatusCodes(stats.StatusCodes))
+		if len(stats.ErrorClasses) > 0 {
+			line += ", Errors=" + color.RedString("[%s]", formatErrorClasses(stats.ErrorClasses))
+		}
+		line += fmt.Sprintf(", Incidents=%d, MTTR=%s, MTBF=%s", stats.Reliability.IncidentsCount,
+			formatReliabilityDuration(stats.Reliability.Mttr), formatReliabilityDuration(stats.Reliability.Mtbf))
+		if budget, ok := mapAllBudgets[id]; ok {
+			line += newLine + colorizeBudget(budget)
+		}
 
 		// Alerts
-		if mapAllAlerts[url].Display {
-			for _, alert := range mapAllAlerts[url].Alerts {
-				line += newLine + colorizeAlert(url, alert.Timestamp, alert.Availability)
+		if mapAllAlerts[id].Display {
+			for _, alert := range mapAllAlerts[id].Alerts {
+				line += newLine + colorizeAlert(id, alert.Timestamp, alert.Availability)
+			}
+			for _, event := range mapAllAlerts[id].Events {
+				line += newLine + colorizeAlertEvent(id, event)
 			}
 		}
 		output += line + sep
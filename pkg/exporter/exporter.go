@@ -0,0 +1,236 @@
+// Package exporter exposes the checks of the instances in the Prometheus text exposition format.
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Dainerx/wpam/pkg/latency"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const (
+	PKG         = "exporter"
+	namespace   = "wpam"
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+	// Prefix of the labels made from the instances' tags, they can not clash with the exporter's labels.
+	tagPrefix = "tag_"
+)
+
+// series holds the counters of an instance since the exporter started, Prometheus computes rates from them.
+type series struct {
+	up                bool
+	histogram         latency.Histogram
+	sumRt             float64
+	count             int
+	statusCodes       map[int]int
+	errorClasses      map[string]int
+	certificateExpiry int64 // Unix time, 0 if unknown
+}
+
+// Exporter serves the metrics of every registered instance on /metrics.
+type Exporter struct {
+	sync.Mutex //embedded field
+	store      *safe_store.SafeStore
+	series     map[string]*series
+}
+
+// New creates an exporter fed by every response put in the store afterwards.
+func New(store *safe_store.SafeStore) *Exporter {
+	e := &Exporter{
+		store:  store,
+		series: map[string]*series{},
+	}
+	store.OnResponse(e.observe)
+	return e
+}
+
+// observe adds a response to the instance's counters.
+// Locks the Exporter then unlock it.
+func (e *Exporter) observe(id string, response types.Response) {
+	e.Lock()
+	defer e.Unlock()
+	s, ok := e.series[id]
+	if !ok {
+		s = &series{
+			histogram:    latency.NewHistogram(),
+			statusCodes:  map[int]int{},
+			errorClasses: map[string]int{},
+		}
+		e.series[id] = s
+	}
+	rt := response.ResponseTime().Seconds()
+	s.up = response.Status() == types.Up
+	s.histogram.Add(rt)
+	s.sumRt += rt
+	s.count++
+	s.statusCodes[response.HttpStatusCode()]++
+	if errorClass := response.ErrorClass(); errorClass != "" {
+		s.errorClasses[errorClass]++
+	}
+	if certificateResponse, ok := response.(types.CertificateResponse); ok && !certificateResponse.CertificateExpiry().IsZero() {
+		s.certificateExpiry = certificateResponse.CertificateExpiry().Unix()
+	}
+}
+
+// ServeHTTP writes the metrics of every registered instance having responses.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	e.Write(w)
+}
+
+// metric is a metric family being written: its samples are grouped under its help and type.
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	samples []string
+}
+
+func (m *metric) add(labels []string, value float64) {
+	m.addWithSuffix("", labels, value)
+}
+
+func (m *metric) addWithSuffix(suffix string, labels []string, value float64) {
+	m.samples = append(m.samples, fmt.Sprintf("%s%s{%s} %s", m.name, suffix, strings.Join(labels, ","), formatValue(value)))
+}
+
+func (m *metric) writeTo(w io.Writer) {
+	if len(m.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	for _, sample := range m.samples {
+		fmt.Fprintln(w, sample)
+	}
+}
+
+// Write writes the metrics in the Prometheus text exposition format, instances are sorted by id.
+func (e *Exporter) Write(w io.Writer) {
+	probeSuccess := &metric{name: namespace + "_probe_success", help: "Whether the last check of the instance succeeded.", kind: "gauge"}
+	responseTime := &metric{name: namespace + "_response_time_seconds", help: "Response times of the checks in seconds.", kind: "histogram"}
+	responses := &metric{name: namespace + "_responses_total", help: "Checks per http status code, -1 when the request failed.", kind: "counter"}
+	errors := &metric{name: namespace + "_errors_total", help: "Failed checks per error class.", kind: "counter"}
+	certificateExpiry := &metric{name: namespace + "_certificate_expiry_timestamp_seconds", help: "Unix time the certificate of the instance's https url expires.", kind: "gauge"}
+	down := &metric{name: namespace + "_instance_down", help: "Whether the instance's availability alert is firing.", kind: "gauge"}
+	alertFiring := &metric{name: namespace + "_alert_firing", help: "Whether the instance's alert is firing.", kind: "gauge"}
+
+	mapAllAlerts := e.store.GetAllAlerts()
+	e.Lock()
+	var ids []string
+	for id := range e.series {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		instance, ok := e.store.GetInstance(id)
+		if !ok {
+			continue // Removed instances are no longer exported
+		}
+		s := e.series[id]
+		labels := instanceLabels(instance)
+		probeSuccess.add(labels, boolValue(s.up))
+
+		cumulative := 0
+		for _, bucket := range s.histogram.Buckets() {
+			cumulative += bucket.Count
+			responseTime.addWithSuffix("_bucket", withLabel(labels, "le", formatValue(bucket.Le)), float64(cumulative))
+		}
+		responseTime.addWithSuffix("_sum", labels, s.sumRt)
+		responseTime.addWithSuffix("_count", labels, float64(s.count))
+
+		var codes []int
+		for code := range s.statusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			responses.add(withLabel(labels, "code", strconv.Itoa(code)), float64(s.statusCodes[code]))
+		}
+		var classes []string
+		for errorClass := range s.errorClasses {
+			classes = append(classes, errorClass)
+		}
+		sort.Strings(classes)
+		for _, errorClass := range classes {
+			errors.add(withLabel(labels, "class", errorClass), float64(s.errorClasses[errorClass]))
+		}
+		if s.certificateExpiry != 0 {
+			certificateExpiry.add(labels, float64(s.certificateExpiry))
+		}
+
+		alerts := mapAllAlerts[id]
+		if len(alerts.Alerts) > 0 {
+			down.add(labels, boolValue(alerts.Down()))
+		}
+		// The last event of every alert tells its state
+		lastEvents := make(map[string]types.AlertEvent)
+		var names []string
+		for _, event := range alerts.Events {
+			if _, ok := lastEvents[event.Name]; !ok {
+				names = append(names, event.Name)
+			}
+			lastEvents[event.Name] = event
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			event := lastEvents[name]
+			alertFiring.add(withLabel(withLabel(labels, "kind", event.Kind), "alert", name), boolValue(event.Firing))
+		}
+	}
+	e.Unlock()
+
+	for _, m := range []*metric{probeSuccess, responseTime, responses, errors, certificateExpiry, down, alertFiring} {
+		m.writeTo(w)
+	}
+}
+
+// Returns the labels of an instance: its id, url and tags.
+func instanceLabels(instance types.Instance) []string {
+	labels := []string{label("id", instance.Id), label("url", instance.Url)}
+	var tags []string
+	for _, tag := range instance.Tags {
+		kv := strings.SplitN(tag, ":", 2)
+		value := "true" // A tag without value is a flag
+		if len(kv) == 2 {
+			value = kv[1]
+		}
+		tags = append(tags, label(tagPrefix+kv[0], value))
+	}
+	sort.Strings(tags)
+	return append(labels, tags...)
+}
+
+// Returns a copy of the labels with another label, the labels of an instance are shared between its samples.
+func withLabel(labels []string, name, value string) []string {
+	extended := make([]string, len(labels), len(labels)+1)
+	copy(extended, labels)
+	return append(extended, label(name, value))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name, value string) string {
+	return name + `="` + labelValueEscaper.Replace(value) + `"`
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
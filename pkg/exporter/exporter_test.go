@@ -0,0 +1,53 @@
+package exporter_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/exporter"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+func TestExporter(t *testing.T) {
+	store := safe_store.New()
+	e := exporter.New(store)
+	store.Register(types.Instance{Id: "first", Url: "http://example.com", Tags: []string{"env:prod", "critical"}})
+	store.Put("first", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 20*time.Millisecond, 0))
+	store.Put("first", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusNotFound, 300*time.Millisecond, 0))
+	// Not registered, not exported
+	store.Put("second", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+
+	var b bytes.Buffer
+	e.Write(&b)
+	got := b.String()
+	labels := `id="first",url="http://example.com",tag_critical="true",tag_env="prod"`
+	for _, want := range []string{
+		"# TYPE wpam_probe_success gauge",
+		"wpam_probe_success{" + labels + "} 0",
+		"wpam_response_time_seconds_bucket{" + labels + `,le="0.025"} 1`,
+		"wpam_response_time_seconds_bucket{" + labels + `,le="+Inf"} 2`,
+		"wpam_response_time_seconds_count{" + labels + "} 2",
+		"wpam_responses_total{" + labels + `,code="404"} 1`,
+		"wpam_errors_total{" + labels + `,class="bad_status"} 1`,
+		"wpam_instance_down{" + labels + "} 1", // 50% availability
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("e.Write() does not contain %s, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `id="second"`) {
+		t.Errorf("e.Write() exports an instance not registered, got:\n%s", got)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s; want the text exposition format", contentType)
+	}
+}
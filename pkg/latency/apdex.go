@@ -0,0 +1,30 @@
+package latency
+
+// Apdex zones of a response given a target time T in seconds.
+const (
+	ApdexSatisfied = iota
+	ApdexTolerating
+	ApdexFrustrated
+)
+
+// ApdexZone returns the zone of a response: satisfied if it is up within T, tolerating if it is up within 4T,
+// frustrated otherwise, failed responses are always frustrated.
+func ApdexZone(rt float64, up bool, t float64) int {
+	switch {
+	case !up || rt > 4*t:
+		return ApdexFrustrated
+	case rt > t:
+		return ApdexTolerating
+	default:
+		return ApdexSatisfied
+	}
+}
+
+// Apdex returns the Apdex score of count responses: (satisfied + tolerating/2) / count, between 0 and 1.
+// Returns -1 if count is 0.
+func Apdex(satisfied, tolerating, count int) float64 {
+	if count == 0 {
+		return -1
+	}
+	return (float64(satisfied) + float64(tolerating)/2) / float64(count)
+}
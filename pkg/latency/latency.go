@@ -0,0 +1,156 @@
+// Package latency summarizes response time distributions with structures that can be merged and updated in place.
+package latency
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	PKG = "latency"
+	// Relative accuracy of the quantiles estimated by a Sketch.
+	sketchAccuracy = 0.02
+	// Response times below this value in seconds share the first sketch bucket.
+	sketchMin = 1e-4
+)
+
+// Growth between two consecutive sketch buckets.
+var gamma = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+
+// HistogramBounds are the upper bounds in seconds of the histogram buckets, a last bucket counts the slower ones.
+var HistogramBounds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Sketch estimates quantiles of response times (in seconds) within a relative error of 2%.
+// Response times are counted in logarithmic buckets mapping a bucket index to its count,
+// thus sketches can be merged and response times removed from them.
+type Sketch map[int]int
+
+// Returns the index of the sketch bucket holding rt.
+func sketchIndex(rt float64) int {
+	if rt <= sketchMin {
+		return 0
+	}
+	return int(math.Ceil(math.Log(rt/sketchMin) / math.Log(gamma)))
+}
+
+// Returns the value representing a sketch bucket, in the middle of its bounds.
+func sketchValue(index int) float64 {
+	if index == 0 {
+		return sketchMin
+	}
+	return sketchMin * math.Pow(gamma, float64(index)) * 2 / (1 + gamma)
+}
+
+// Add counts a response time in the sketch.
+func (s Sketch) Add(rt float64) {
+	s[sketchIndex(rt)]++
+}
+
+// Remove uncounts a response time previously added to the sketch.
+func (s Sketch) Remove(rt float64) {
+	index := sketchIndex(rt)
+	if s[index] <= 1 {
+		delete(s, index)
+		return
+	}
+	s[index]--
+}
+
+// Merge adds the counts of another sketch to the sketch.
+func (s Sketch) Merge(other Sketch) {
+	for index, count := range other {
+		s[index] += count
+	}
+}
+
+// Quantile returns the estimated q-quantile (0 <= q <= 1) of the counted response times.
+// Returns -1 if the sketch is empty.
+func (s Sketch) Quantile(q float64) float64 {
+	total := 0
+	indexes := make([]int, 0, len(s))
+	for index, count := range s {
+		total += count
+		indexes = append(indexes, index)
+	}
+	if total == 0 {
+		return -1
+	}
+	sort.Ints(indexes)
+	rank := int(math.Ceil(q * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for _, index := range indexes {
+		seen += s[index]
+		if seen >= rank {
+			return sketchValue(index)
+		}
+	}
+	return sketchValue(indexes[len(indexes)-1])
+}
+
+// Histogram counts response times in the buckets bounded by HistogramBounds.
+type Histogram []int
+
+// HistogramBucket is a bucket of a Histogram, counting response times up to Le seconds (+Inf for the last).
+type HistogramBucket struct {
+	Le    float64
+	Count int
+}
+
+// NewHistogram creates an empty histogram.
+func NewHistogram() Histogram {
+	return make(Histogram, len(HistogramBounds)+1)
+}
+
+// Returns the index of the histogram bucket holding rt.
+func histogramIndex(rt float64) int {
+	return sort.SearchFloat64s(HistogramBounds, rt)
+}
+
+// Add counts a response time in the histogram.
+func (h Histogram) Add(rt float64) {
+	h[histogramIndex(rt)]++
+}
+
+// Remove uncounts a response time previously added to the histogram.
+func (h Histogram) Remove(rt float64) {
+	h[histogramIndex(rt)]--
+}
+
+// Merge adds the counts of another histogram to the histogram.
+func (h Histogram) Merge(other Histogram) {
+	for i := range other {
+		if i < len(h) {
+			h[i] += other[i]
+		}
+	}
+}
+
+// Buckets returns the buckets of the histogram with their bounds.
+func (h Histogram) Buckets() []HistogramBucket {
+	buckets := make([]HistogramBucket, len(h))
+	for i, count := range h {
+		le := math.Inf(1)
+		if i < len(HistogramBounds) {
+			le = HistogramBounds[i]
+		}
+		buckets[i] = HistogramBucket{Le: le, Count: count}
+	}
+	return buckets
+}
+
+// StdDev returns the population standard deviation of count values given their sum and sum of squares.
+// Returns -1 if count is 0.
+func StdDev(count int, sum, sumSq float64) float64 {
+	if count == 0 {
+		return -1
+	}
+	mean := sum / float64(count)
+	variance := sumSq/float64(count) - mean*mean
+	if variance < 0 { // Float errors on values all alike
+		return 0
+	}
+	return math.Sqrt(variance)
+}
@@ -0,0 +1,83 @@
+package latency_test
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/Dainerx/wpam/pkg/latency"
+)
+
+// Quantiles estimated by the sketch must be within its relative accuracy.
+func TestSketchQuantile(t *testing.T) {
+	sketch := latency.Sketch{}
+	var rts []float64
+	for i := 1; i <= 1000; i++ {
+		rt := float64(i) * 0.003 // 3ms to 3s
+		rts = append(rts, rt)
+		sketch.Add(rt)
+	}
+	sort.Float64s(rts)
+	for _, q := range []float64{0.5, 0.9, 0.95, 0.99} {
+		want := rts[int(math.Ceil(q*float64(len(rts))))-1]
+		if got := sketch.Quantile(q); math.Abs(got-want)/want > 0.02 {
+			t.Errorf("sketch.Quantile(%.2f) = %f; want %f within 2%%", q, got, want)
+		}
+	}
+	// Removing the slowest half moves the median down
+	for _, rt := range rts[500:] {
+		sketch.Remove(rt)
+	}
+	if got, want := sketch.Quantile(0.5), rts[249]; math.Abs(got-want)/want > 0.02 {
+		t.Errorf("sketch.Quantile(0.5) after removal = %f; want %f within 2%%", got, want)
+	}
+	if got := (latency.Sketch{}).Quantile(0.5); got != -1 {
+		t.Errorf("Quantile of an empty sketch = %f; want -1", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := latency.NewHistogram()
+	for _, rt := range []float64{0.001, 0.3, 0.5, 0.7, 30} {
+		h.Add(rt)
+	}
+	other := latency.NewHistogram()
+	other.Add(0.5)
+	h.Merge(other)
+	want := map[float64]int{0.005: 1, 0.5: 3, 1: 1, math.Inf(1): 1}
+	for _, bucket := range h.Buckets() {
+		if bucket.Count != want[bucket.Le] {
+			t.Errorf("Bucket le=%f count=%d; want %d", bucket.Le, bucket.Count, want[bucket.Le])
+		}
+	}
+}
+
+func TestStdDev(t *testing.T) {
+	// 2, 4, 4, 4, 5, 5, 7, 9 has a standard deviation of 2
+	if got := latency.StdDev(8, 40, 232); math.Abs(got-2) > 1e-9 {
+		t.Errorf("latency.StdDev() = %f; want 2", got)
+	}
+}
+
+func TestApdex(t *testing.T) {
+	// T=0.5s: 2 satisfied, 1 tolerating, 1 too slow and 1 down
+	satisfied, tolerating, count := 0, 0, 0
+	for _, r := range []struct {
+		rt float64
+		up bool
+	}{{0.1, true}, {0.5, true}, {1.5, true}, {2.5, true}, {0.1, false}} {
+		switch latency.ApdexZone(r.rt, r.up, 0.5) {
+		case latency.ApdexSatisfied:
+			satisfied++
+		case latency.ApdexTolerating:
+			tolerating++
+		}
+		count++
+	}
+	if got := latency.Apdex(satisfied, tolerating, count); got != 0.5 {
+		t.Errorf("latency.Apdex(%d, %d, %d) = %f; want 0.5", satisfied, tolerating, count, got)
+	}
+	if got := latency.Apdex(0, 0, 0); got != -1 {
+		t.Errorf("latency.Apdex(0, 0, 0) = %f; want -1", got)
+	}
+}
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"os"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -12,3 +14,18 @@ func init() {
 		Logger = *log.WithFields(log.Fields{})
 	}
 }
+
+// SetFile logs as JSON from the info severity to the file at path, appended to if it exists.
+// Returns error if the file could not be opened.
+func SetFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	// Log as JSON instead of the default ASCII formatter.
+	log.SetFormatter(&log.JSONFormatter{})
+	log.SetOutput(f)
+	log.SetLevel(log.InfoLevel) // Only log the info severity or above.
+	Logger = *log.WithFields(log.Fields{})
+	return nil
+}
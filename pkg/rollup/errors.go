@@ -0,0 +1,8 @@
+package rollup
+
+import "errors"
+
+var (
+	// ErrResolutionNotValid is returned when a resolution name is not one of 1m, 1h and 1d.
+	ErrResolutionNotValid = errors.New(`Resolution is not valid, accepted resolutions are [1m,1h,1d]`)
+)
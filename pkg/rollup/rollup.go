@@ -0,0 +1,291 @@
+// Package rollup downsamples raw responses into fixed time buckets for long-term history.
+package rollup
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/latency"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const (
+	PKG    = "rollup"
+	Minute = time.Minute
+	Hour   = time.Hour
+	Day    = 24 * time.Hour
+)
+
+// Resolutions are the bucket sizes rollups are computed at, from the finest to the coarsest.
+var Resolutions = []time.Duration{Minute, Hour, Day}
+
+// Names of the resolutions as used in flags and configuration.
+var resolutionNames = map[string]time.Duration{
+	"1m": Minute,
+	"1h": Hour,
+	"1d": Day,
+}
+
+// ParseResolution returns the resolution named 1m, 1h or 1d.
+// Returns ErrResolutionNotValid for any other name.
+func ParseResolution(name string) (time.Duration, error) {
+	resolution, ok := resolutionNames[name]
+	if !ok {
+		return 0, ErrResolutionNotValid
+	}
+	return resolution, nil
+}
+
+// DefaultRetentions maps every resolution to how long its buckets are kept by default.
+var DefaultRetentions = map[time.Duration]time.Duration{
+	Minute: 2 * Day,
+	Hour:   30 * Day,
+	Day:    365 * Day,
+}
+
+// Bucket aggregates the responses of an instance dating in [Start, Start+Resolution).
+// Response times are in seconds like in stat.Stat, their distribution is kept by a sketch and a histogram.
+type Bucket struct {
+	Start         time.Time
+	Resolution    time.Duration
+	Count         int
+	UpCount       int
+	ApdexT        float64 // Apdex target time in seconds the zones are counted against
+	Satisfied     int
+	Tolerating    int
+	MinRt         float64
+	MaxRt         float64
+	SumRt         float64
+	SumSqRt       float64
+	Latencies     latency.Sketch
+	Histogram     latency.Histogram
+	StatusCodes   map[int]int
+	ErrorClasses  map[string]int
+	LastStatus    string
+	ContentLength int64
+}
+
+// NewBucket creates an empty bucket of the given resolution holding t.
+func NewBucket(t time.Time, resolution time.Duration) Bucket {
+	return Bucket{
+		Start:        t.UTC().Truncate(resolution),
+		Resolution:   resolution,
+		ApdexT:       types.DefaultApdexT,
+		MinRt:        math.MaxFloat64,
+		MaxRt:        -1,
+		Latencies:    latency.Sketch{},
+		Histogram:    latency.NewHistogram(),
+		StatusCodes:  map[int]int{},
+		ErrorClasses: map[string]int{},
+	}
+}
+
+// End returns the end of the bucket (excluded).
+func (b Bucket) End() time.Time {
+	return b.Start.Add(b.Resolution)
+}
+
+// Holds tells whether t is in the bucket's time range.
+func (b Bucket) Holds(t time.Time) bool {
+	return !t.Before(b.Start) && t.Before(b.End())
+}
+
+// Add aggregates a response into the bucket.
+func (b *Bucket) Add(response types.Response) {
+	rt := response.ResponseTime().Seconds()
+	b.Count++
+	if response.Status() == types.Up {
+		b.UpCount++
+	}
+	if b.ApdexT == 0 {
+		b.ApdexT = types.DefaultApdexT
+	}
+	switch latency.ApdexZone(rt, response.Status() == types.Up, b.ApdexT) {
+	case latency.ApdexSatisfied:
+		b.Satisfied++
+	case latency.ApdexTolerating:
+		b.Tolerating++
+	}
+	b.SumRt += rt
+	b.SumSqRt += rt * rt
+	if b.Latencies == nil {
+		b.Latencies = latency.Sketch{}
+	}
+	b.Latencies.Add(rt)
+	if b.Histogram == nil {
+		b.Histogram = latency.NewHistogram()
+	}
+	b.Histogram.Add(rt)
+	b.MinRt = math.Min(b.MinRt, rt)
+	b.MaxRt = math.Max(b.MaxRt, rt)
+	if b.StatusCodes == nil {
+		b.StatusCodes = map[int]int{}
+	}
+	b.StatusCodes[response.HttpStatusCode()]++
+	if errorClass := response.ErrorClass(); errorClass != "" {
+		if b.ErrorClasses == nil {
+			b.ErrorClasses = map[string]int{}
+		}
+		b.ErrorClasses[errorClass]++
+	}
+	b.LastStatus = response.Status()
+	b.ContentLength = response.ContentLength()
+}
+
+// Clone returns a deep copy of the bucket, sharing no map or slice with it.
+func (b Bucket) Clone() Bucket {
+	clone := b
+	if b.Latencies != nil {
+		clone.Latencies = make(latency.Sketch, len(b.Latencies))
+		clone.Latencies.Merge(b.Latencies)
+	}
+	if b.Histogram != nil {
+		clone.Histogram = append(latency.Histogram(nil), b.Histogram...)
+	}
+	if b.StatusCodes != nil {
+		clone.StatusCodes = make(map[int]int, len(b.StatusCodes))
+		for code, count := range b.StatusCodes {
+			clone.StatusCodes[code] = count
+		}
+	}
+	if b.ErrorClasses != nil {
+		clone.ErrorClasses = make(map[string]int, len(b.ErrorClasses))
+		for errorClass, count := range b.ErrorClasses {
+			clone.ErrorClasses[errorClass] = count
+		}
+	}
+	return clone
+}
+
+// Merge aggregates another bucket of the same time range into the bucket.
+// Used when a bucket was written twice, e.g. flushed on shutdown then reopened on restart.
+func (b *Bucket) Merge(other Bucket) {
+	b.Count += other.Count
+	b.UpCount += other.UpCount
+	b.Satisfied += other.Satisfied
+	b.Tolerating += other.Tolerating
+	b.SumRt += other.SumRt
+	b.SumSqRt += other.SumSqRt
+	if b.Latencies == nil {
+		b.Latencies = latency.Sketch{}
+	}
+	b.Latencies.Merge(other.Latencies)
+	if b.Histogram == nil {
+		b.Histogram = latency.NewHistogram()
+	}
+	b.Histogram.Merge(other.Histogram)
+	b.MinRt = math.Min(b.MinRt, other.MinRt)
+	b.MaxRt = math.Max(b.MaxRt, other.MaxRt)
+	if b.StatusCodes == nil {
+		b.StatusCodes = map[int]int{}
+	}
+	for code, count := range other.StatusCodes {
+		b.StatusCodes[code] += count
+	}
+	if b.ErrorClasses == nil {
+		b.ErrorClasses = map[string]int{}
+	}
+	for errorClass, count := range other.ErrorClasses {
+		b.ErrorClasses[errorClass] += count
+	}
+	if other.Count > 0 {
+		b.LastStatus, b.ContentLength = other.LastStatus, other.ContentLength
+	}
+}
+
+// Compact sorts buckets by start and merges the ones sharing the same start.
+func Compact(buckets []Bucket) []Bucket {
+	sort.SliceStable(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+	var compacted []Bucket
+	for _, bucket := range buckets {
+		if n := len(compacted); n > 0 && compacted[n-1].Start.Equal(bucket.Start) {
+			compacted[n-1].Merge(bucket)
+			continue
+		}
+		compacted = append(compacted, bucket)
+	}
+	return compacted
+}
+
+// Rollup keeps the open bucket of every resolution for one instance.
+type Rollup struct {
+	open   map[time.Duration]*Bucket
+	apdexT float64
+}
+
+// New creates a rollup with no open bucket, Apdex zones are counted against the default target time.
+func New() *Rollup {
+	return NewWithApdexT(types.DefaultApdexT)
+}
+
+// NewWithApdexT creates a rollup with no open bucket counting Apdex zones against apdexT in seconds.
+func NewWithApdexT(apdexT float64) *Rollup {
+	return &Rollup{
+		open:   map[time.Duration]*Bucket{},
+		apdexT: apdexT,
+	}
+}
+
+// SetApdexT changes the Apdex target time in seconds of the buckets opened afterwards.
+func (r *Rollup) SetApdexT(apdexT float64) {
+	r.apdexT = apdexT
+}
+
+// Add aggregates a response in the open bucket of every resolution.
+// Returns the buckets closed by the response, they will not change anymore and can be persisted.
+func (r *Rollup) Add(response types.Response) []Bucket {
+	t := time.Unix(0, response.Timestamp())
+	var closed []Bucket
+	for _, resolution := range Resolutions {
+		bucket, ok := r.open[resolution]
+		if ok && !bucket.Holds(t) {
+			closed = append(closed, *bucket)
+			ok = false
+		}
+		if !ok {
+			newBucket := NewBucket(t, resolution)
+			newBucket.ApdexT = r.apdexT
+			bucket = &newBucket
+			r.open[resolution] = bucket
+		}
+		bucket.Add(response)
+	}
+	return closed
+}
+
+// Open returns a copy of the open bucket of a resolution, ok is false if there is none.
+// The copy is deep so it can be read while responses are added to the rollup.
+func (r *Rollup) Open(resolution time.Duration) (bucket Bucket, ok bool) {
+	open, ok := r.open[resolution]
+	if !ok {
+		return Bucket{}, false
+	}
+	return open.Clone(), true
+}
+
+// Flush closes and returns every open bucket.
+func (r *Rollup) Flush() []Bucket {
+	var closed []Bucket
+	for _, resolution := range Resolutions {
+		if bucket, ok := r.open[resolution]; ok {
+			closed = append(closed, *bucket)
+			delete(r.open, resolution)
+		}
+	}
+	return closed
+}
+
+// Resolution returns the finest resolution whose retention covers the time since from.
+// Falls back to the coarsest resolution if none does.
+func Resolution(from time.Time, retentions map[time.Duration]time.Duration) time.Duration {
+	since := time.Since(from)
+	for _, resolution := range Resolutions {
+		if retentions[resolution] >= since {
+			return resolution
+		}
+	}
+	return Resolutions[len(Resolutions)-1]
+}
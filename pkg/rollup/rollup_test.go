@@ -0,0 +1,84 @@
+package rollup_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/rollup"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+// Returns a response at t with a http status code, down with a bad status if it is not 200.
+func response(t time.Time, code int) types.Response {
+	return *website_check.NewCheckResponseAt(t, []int{http.StatusOK}, code, time.Second, 0)
+}
+
+func TestRollupAdd(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	r := rollup.New()
+	// Three responses in the first minute, one in the next minute
+	for i := 0; i < 3; i++ {
+		if closed := r.Add(response(start.Add(time.Duration(i)*10*time.Second), http.StatusOK)); len(closed) != 0 {
+			t.Errorf("r.Add() closed %d buckets; want 0", len(closed))
+		}
+	}
+	closed := r.Add(response(start.Add(time.Minute), http.StatusNotFound))
+	if len(closed) != 1 {
+		t.Fatalf("r.Add() closed %d buckets; want 1", len(closed))
+	}
+	if closed[0].Resolution != rollup.Minute || closed[0].Count != 3 || closed[0].UpCount != 3 || !closed[0].Start.Equal(start) {
+		t.Errorf("Closed bucket = %+v; want the 3 responses of %v", closed[0], start)
+	}
+	hour, ok := r.Open(rollup.Hour)
+	if !ok || hour.Count != 4 || hour.UpCount != 3 || hour.StatusCodes[http.StatusNotFound] != 1 ||
+		hour.ErrorClasses[types.ErrorClassBadStatus] != 1 || hour.LastStatus != types.Down {
+		t.Errorf("r.Open(Hour) = %+v, %t; want 4 responses, 3 up and one 404", hour, ok)
+	}
+	if flushed := r.Flush(); len(flushed) != len(rollup.Resolutions) {
+		t.Errorf("len(r.Flush()) = %d; want %d", len(flushed), len(rollup.Resolutions))
+	}
+}
+
+func TestBucketClone(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	r := rollup.New()
+	r.Add(response(start, http.StatusNotFound))
+	open, _ := r.Open(rollup.Minute)
+	r.Add(response(start.Add(time.Second), http.StatusNotFound))
+	latencies, histogram := 0, 0
+	for _, count := range open.Latencies {
+		latencies += count
+	}
+	for _, count := range open.Histogram {
+		histogram += count
+	}
+	if open.Count != 1 || open.StatusCodes[http.StatusNotFound] != 1 || open.ErrorClasses[types.ErrorClassBadStatus] != 1 ||
+		latencies != 1 || histogram != 1 {
+		t.Errorf("r.Open(Minute) = %+v; want it unchanged by the next r.Add()", open)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	first, second := rollup.NewBucket(start, rollup.Minute), rollup.NewBucket(start, rollup.Minute)
+	first.Add(response(start, http.StatusOK))
+	second.Add(response(start.Add(time.Second), http.StatusNotFound))
+	compacted := rollup.Compact([]rollup.Bucket{first, second})
+	if len(compacted) != 1 || compacted[0].Count != 2 || compacted[0].UpCount != 1 {
+		t.Errorf("rollup.Compact() = %+v; want one bucket of 2 responses", compacted)
+	}
+}
+
+func TestResolution(t *testing.T) {
+	if got := rollup.Resolution(time.Now().Add(-time.Hour), rollup.DefaultRetentions); got != rollup.Minute {
+		t.Errorf("rollup.Resolution(1h) = %v; want %v", got, rollup.Minute)
+	}
+	if got := rollup.Resolution(time.Now().Add(-7*rollup.Day), rollup.DefaultRetentions); got != rollup.Hour {
+		t.Errorf("rollup.Resolution(7d) = %v; want %v", got, rollup.Hour)
+	}
+	if got := rollup.Resolution(time.Now().Add(-90*rollup.Day), rollup.DefaultRetentions); got != rollup.Day {
+		t.Errorf("rollup.Resolution(90d) = %v; want %v", got, rollup.Day)
+	}
+}
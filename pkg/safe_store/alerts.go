@@ -0,0 +1,124 @@
+package safe_store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/slo"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+type firing map[string]map[string]bool
+
+// appendAlertEvent records an alert transition of an instance if the alert changed its state and tells the alert listeners.
+// Once an alert fires, the instance's alerts are always displayed.
+// Locks the SafeStore's write lock then unlock it.
+func (s *SafeStore) appendAlertEvent(id string, event types.AlertEvent) {
+	s.Lock()
+	if _, ok := s.firing[id]; !ok {
+		s.firing[id] = map[string]bool{}
+	}
+	if s.firing[id][event.Name] == event.Firing {
+		s.Unlock()
+		return
+	}
+	s.firing[id][event.Name] = event.Firing
+	websiteAlerts := s.alerts[id]
+	websiteAlerts.Events = append(websiteAlerts.Events, event)
+	if event.Firing {
+		websiteAlerts.Display = true
+		logger.Logger.Warnf("Alert %s of %s is firing, value=%f", event.Name, id, event.Value)
+	} else {
+		logger.Logger.Infof("Alert %s of %s is resolved, value=%f", event.Name, id, event.Value)
+	}
+	s.alerts[id] = websiteAlerts
+	s.Unlock()
+	s.alerted(id, event)
+}
+
+// pruneFiring forgets the state of the alerts an instance can not fire anymore, e.g. its rule was removed by an update.
+// Those still firing are resolved, the resolve events are returned to be told to the alert listeners once unlocked.
+// The SafeStore must be locked.
+func (s *SafeStore) pruneFiring(instance types.Instance, now time.Time) []types.AlertEvent {
+	names := alertNames(instance)
+	var stale []string
+	for name := range s.firing[instance.Id] {
+		if !names[name] {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	var resolved []types.AlertEvent
+	websiteAlerts := s.alerts[instance.Id]
+	for _, name := range stale {
+		firing := s.firing[instance.Id][name]
+		delete(s.firing[instance.Id], name)
+		if !firing {
+			continue
+		}
+		event := types.AlertEvent{Timestamp: now, Name: name}
+		for i := len(websiteAlerts.Events) - 1; i >= 0; i-- {
+			if websiteAlerts.Events[i].Name == name {
+				event.Kind = websiteAlerts.Events[i].Kind
+				break
+			}
+		}
+		websiteAlerts.Events = append(websiteAlerts.Events, event)
+		resolved = append(resolved, event)
+		logger.Logger.Infof("Alert %s of %s is resolved, it was removed", name, instance.Id)
+	}
+	if len(resolved) > 0 {
+		s.alerts[instance.Id] = websiteAlerts
+	}
+	return resolved
+}
+
+// alertNames returns the names of the alerts an instance can fire with its configuration.
+func alertNames(instance types.Instance) map[string]bool {
+	names := map[string]bool{}
+	for _, rule := range instance.Rules {
+		names[rule.String()] = true
+	}
+	if instance.Slo.Enabled() {
+		for _, alert := range slo.BurnRateAlerts {
+			names[alert.String()] = true
+		}
+	}
+	if instance.AnomalyDeviations > 0 {
+		names[anomalyAlertName(instance.AnomalyDeviations)] = true
+	}
+	if instance.Content.Hash {
+		names[contentChangedAlert] = true
+	}
+	if instance.Content.LengthDeviation > 0 {
+		names[contentLengthAlertName(instance.Content.LengthDeviation)] = true
+	}
+	return names
+}
+
+// updateRuleAlerts evaluates the registered instance's rules against its stats of two minutes ago.
+func (s *SafeStore) updateRuleAlerts(id string, time time.Time) {
+	instance, ok := s.GetInstance(id)
+	if !ok || len(instance.Rules) == 0 {
+		return
+	}
+	twoMinutesAgoStats := s.safeStat.getInstanceStatTwoMinutesAgo(id)
+	if twoMinutesAgoStats.LastStatus == "" || twoMinutesAgoStats.LastStatus == types.Unkown { // No data to evaluate on
+		return
+	}
+	for _, rule := range instance.Rules {
+		value, err := twoMinutesAgoStats.Metric(rule.Metric)
+		if err != nil {
+			logger.Logger.Warnf("Rule %s of %s can not be evaluated: %v", rule, id, err)
+			continue
+		}
+		s.appendAlertEvent(id, types.AlertEvent{
+			Timestamp: time,
+			Kind:      types.AlertKindRule,
+			Name:      rule.String(),
+			Value:     value,
+			Firing:    rule.Matches(value),
+		})
+	}
+}
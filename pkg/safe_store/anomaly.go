@@ -0,0 +1,52 @@
+package safe_store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/anomaly"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+type detectors map[string]*anomaly.Detector
+
+// updateAnomalyAlerts compares the average response time of the last two minutes of a registered instance
+// with anomaly detection to its baseline, then learns the response time into the baseline.
+// The baseline is created on the instance's first response and learns the responses kept in memory.
+// Only successful responses are learnt, failed ones have no meaningful response time.
+// Locks the SafeStore's write lock then unlock it.
+func (s *SafeStore) updateAnomalyAlerts(id string, response types.Response, now time.Time) {
+	instance, ok := s.GetInstance(id)
+	if !ok || instance.AnomalyDeviations <= 0 {
+		return
+	}
+	twoMinutesAgoStats := s.safeStat.getInstanceStatTwoMinutesAgo(id)
+	s.Lock()
+	detector, ok := s.detectors[id]
+	responses := []types.Response{response}
+	if !ok {
+		detector = anomaly.NewDetector()
+		s.detectors[id] = detector
+		responses = s.data[id] // The response is already in memory
+	}
+	// Evaluated before learning the response, the baseline would absorb part of the anomaly otherwise
+	firing := twoMinutesAgoStats.AvgRt > 0 && detector.Anomalous(twoMinutesAgoStats.AvgRt, instance.AnomalyDeviations)
+	for _, r := range responses {
+		if r.Status() == types.Up {
+			detector.Learn(r.ResponseTime().Seconds(), instance.AnomalyDeviations)
+		}
+	}
+	s.Unlock()
+	s.appendAlertEvent(id, types.AlertEvent{
+		Timestamp: now,
+		Kind:      types.AlertKindAnomaly,
+		Name:      anomalyAlertName(instance.AnomalyDeviations),
+		Value:     twoMinutesAgoStats.AvgRt,
+		Firing:    firing,
+	})
+}
+
+// Returns the name of the anomaly alert of an instance detecting anomalies above deviations.
+func anomalyAlertName(deviations float64) string {
+	return fmt.Sprintf("anomalous latency, avg_rt %g deviations above baseline", deviations)
+}
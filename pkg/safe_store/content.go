@@ -0,0 +1,117 @@
+package safe_store
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/anomaly"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const (
+	contentChangedAlert = "content changed"
+	// A changed content is adopted as the baseline once this many successful responses in a row have it, e.g. a deploy.
+	contentStableResponses = 10
+)
+
+// contentBaseline is what the content of an instance's successful responses is expected to be.
+type contentBaseline struct {
+	digest          string
+	candidate       string            // Digest of the changed content, empty while the content is the baseline's one
+	candidateStreak int               // Successful responses in a row having the candidate digest
+	length          *anomaly.Detector // Only the moving average of the content length is used
+}
+
+type contentBaselines map[string]*contentBaseline
+
+// Compares a successful response's content to the baseline, returns the alert events to record,
+// then learns the response into the baseline.
+func (baseline *contentBaseline) update(content types.Content, response types.Response, now time.Time) []types.AlertEvent {
+	var events []types.AlertEvent
+	if content.Hash && response.Digest() != "" {
+		if baseline.digest == "" {
+			baseline.digest = response.Digest()
+		} else {
+			baseline.learnDigest(response.Digest())
+			// Fires on the response changing the content, resolved once the baseline's content is back
+			// or the changed content is stable enough to be the baseline
+			events = append(events, types.AlertEvent{
+				Timestamp: now,
+				Kind:      types.AlertKindContent,
+				Name:      contentChangedAlert,
+				Value:     float64(response.ContentLength()),
+				Firing:    response.Digest() != baseline.digest,
+			})
+		}
+	}
+	if content.LengthDeviation > 0 && response.ContentLength() >= 0 {
+		length := float64(response.ContentLength())
+		if mean := baseline.length.Mean(); baseline.length.Ready() && mean > 0 {
+			deviation := math.Abs(length-mean) / mean * 100
+			events = append(events, types.AlertEvent{
+				Timestamp: now,
+				Kind:      types.AlertKindContent,
+				Name:      contentLengthAlertName(content.LengthDeviation),
+				Value:     deviation,
+				Firing:    deviation > content.LengthDeviation,
+			})
+		}
+		baseline.length.Update(length)
+	}
+	return events
+}
+
+// Counts the responses in a row having a digest other than the baseline's one,
+// the digest becomes the baseline's one after contentStableResponses.
+func (baseline *contentBaseline) learnDigest(digest string) {
+	if digest == baseline.digest {
+		baseline.candidate, baseline.candidateStreak = "", 0
+		return
+	}
+	if digest != baseline.candidate {
+		baseline.candidate, baseline.candidateStreak = digest, 0
+	}
+	baseline.candidateStreak++
+	if baseline.candidateStreak >= contentStableResponses {
+		baseline.digest = digest
+		baseline.candidate, baseline.candidateStreak = "", 0
+	}
+}
+
+// updateContentAlerts compares the content of a registered instance's successful response to its baseline:
+// alerts when the digest of the body changes or when the content length deviates from its moving average.
+// The baseline is created on the instance's first response and learns the responses kept in memory.
+// Locks the SafeStore's write lock then unlock it.
+func (s *SafeStore) updateContentAlerts(id string, response types.Response, now time.Time) {
+	instance, ok := s.GetInstance(id)
+	if !ok || (!instance.Content.Hash && instance.Content.LengthDeviation <= 0) || response.Status() != types.Up {
+		return
+	}
+	s.Lock()
+	baseline, ok := s.contents[id]
+	if !ok {
+		responses := s.data[id]
+		if len(responses) == 0 { // Removed since the response was put
+			s.Unlock()
+			return
+		}
+		baseline = &contentBaseline{length: anomaly.NewDetector()}
+		s.contents[id] = baseline
+		for _, r := range responses[:len(responses)-1] { // The response is already in memory
+			if r.Status() == types.Up {
+				baseline.update(instance.Content, r, now)
+			}
+		}
+	}
+	events := baseline.update(instance.Content, response, now)
+	s.Unlock()
+	for _, event := range events {
+		s.appendAlertEvent(id, event)
+	}
+}
+
+// Returns the name of the content length alert of an instance firing above a deviation in percent.
+func contentLengthAlertName(deviation float64) string {
+	return fmt.Sprintf("content length deviation > %g%%", deviation)
+}
@@ -0,0 +1,11 @@
+package safe_store
+
+import "errors"
+
+var (
+	// ErrSloNotDefined is returned when an error budget is asked for an instance without service level objective.
+	ErrSloNotDefined = errors.New("Instance has no service level objective")
+
+	// ErrIncidentNotFound is returned when an instance has no incident started at the given time.
+	ErrIncidentNotFound = errors.New("Incident not found")
+)
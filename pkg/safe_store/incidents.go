@@ -0,0 +1,154 @@
+package safe_store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+type incidents map[string][]types.Incident
+
+// updateIncidents opens an incident when the instance's last availability alert is a down one,
+// updates it with the response while the instance is down and closes it once the instance has resumed.
+// Incidents are saved to the storage whenever they change.
+// Should be called after updateAlerts.
+// Locks the SafeStore's write lock then unlock it.
+func (s *SafeStore) updateIncidents(id string, response types.Response, now time.Time) {
+	availabilityTwoMinutesAgo := s.safeStat.getInstanceStatTwoMinutesAgo(id).Availability
+	s.Lock()
+	defer s.Unlock()
+	websiteAlerts := s.alerts[id].Alerts
+	if len(websiteAlerts) == 0 {
+		return
+	}
+	lastAlert := websiteAlerts[len(websiteAlerts)-1]
+	log := s.incidents[id]
+	ongoing := len(log) > 0 && log[len(log)-1].Ongoing()
+	if lastAlert.Availability >= types.AvaiabilityThreshold {
+		if ongoing {
+			log[len(log)-1].End = lastAlert.Timestamp
+			logger.Logger.Infof("Incident of %s started at %v is resolved after %v", id, log[len(log)-1].Start, log[len(log)-1].Duration(now))
+			s.saveIncidents(id)
+		}
+		return
+	}
+	if !ongoing {
+		log = append(log, types.Incident{
+			Start:           lastAlert.Timestamp,
+			MinAvailability: lastAlert.Availability,
+			ErrorClasses:    map[string]int{},
+		})
+		logger.Logger.Warnf("Incident of %s started at %v", id, lastAlert.Timestamp)
+	}
+	incident := &log[len(log)-1]
+	if availabilityTwoMinutesAgo < incident.MinAvailability {
+		incident.MinAvailability = availabilityTwoMinutesAgo
+	}
+	if errorClass := response.ErrorClass(); errorClass != "" {
+		incident.ErrorClasses[errorClass]++
+	}
+	s.incidents[id] = log
+	s.saveIncidents(id)
+}
+
+// Incidents returns the incidents of an instance overlapping [from, to] sorted by start.
+// Locks the SafeStore's read lock then unlock it.
+func (s *SafeStore) Incidents(id string, from, to time.Time) []types.Incident {
+	s.RLock()
+	defer s.RUnlock()
+	log := s.incidents[id]
+	// Incidents before the first one ending after from are out of the range
+	start := sort.Search(len(log), func(i int) bool {
+		return log[i].Ongoing() || !log[i].End.Before(from)
+	})
+	var overlapping []types.Incident
+	for _, incident := range log[start:] {
+		if incident.Start.After(to) {
+			break
+		}
+		overlapping = append(overlapping, copyIncident(incident))
+	}
+	return overlapping
+}
+
+// AddIncidentNote adds an operator's note to the incident of an instance started at start, compared to the second.
+// Returns the incident with the note.
+// The note is saved to the storage with the incident.
+// Returns ErrIncidentNotFound if the instance has no incident started at start.
+// Locks the SafeStore's write lock then unlock it.
+func (s *SafeStore) AddIncidentNote(id string, start time.Time, note types.IncidentNote) (types.Incident, error) {
+	s.Lock()
+	defer s.Unlock()
+	log := s.incidents[id]
+	for i := range log {
+		if log[i].Start.Truncate(time.Second).Equal(start.Truncate(time.Second)) {
+			log[i].Notes = append(log[i].Notes, note)
+			s.saveIncidents(id)
+			return copyIncident(log[i]), nil
+		}
+	}
+	return types.Incident{}, ErrIncidentNotFound
+}
+
+// Returns a copy of the incident not sharing its error classes nor its notes, updated by the store under its lock.
+func copyIncident(incident types.Incident) types.Incident {
+	errorClasses := make(map[string]int, len(incident.ErrorClasses))
+	for errorClass, count := range incident.ErrorClasses {
+		errorClasses[errorClass] = count
+	}
+	incident.ErrorClasses = errorClasses
+	incident.Notes = append([]types.IncidentNote(nil), incident.Notes...)
+	return incident
+}
+
+// Drops the resolved incidents that ended before the given time.
+// The SafeStore must be locked.
+func (s *SafeStore) pruneIncidents(before time.Time) {
+	for id, log := range s.incidents {
+		start := sort.Search(len(log), func(i int) bool {
+			return log[i].Ongoing() || !log[i].End.Before(before)
+		})
+		if start > 0 {
+			s.incidents[id] = log[start:]
+			s.saveIncidents(id)
+		}
+	}
+}
+
+// Saves the incidents of an instance to the storage, errors are logged.
+// The SafeStore must be locked.
+func (s *SafeStore) saveIncidents(id string) {
+	log := make([]types.Incident, len(s.incidents[id]))
+	for i, incident := range s.incidents[id] {
+		log[i] = copyIncident(incident)
+	}
+	if err := s.storage.SaveIncidents(id, log); err != nil {
+		logger.Logger.Errorf("Failed to persist the incidents of %s: %v", id, err)
+	}
+}
+
+// Loads the incidents of an instance saved to the storage.
+// An incident ongoing when the store was closed is resolved at the last response kept,
+// a new one is opened if the instance is still down.
+// The SafeStore must be locked.
+func (s *SafeStore) loadIncidents(id string) error {
+	log, err := s.storage.Incidents(id)
+	if err != nil || len(log) == 0 {
+		return err
+	}
+	if last := &log[len(log)-1]; last.Ongoing() {
+		responses, err := s.storage.Range(id, last.Start, time.Now())
+		if err != nil {
+			return err
+		}
+		last.End = last.Start
+		if len(responses) > 0 {
+			last.End = time.Unix(0, responses[len(responses)-1].Timestamp())
+		}
+		logger.Logger.Infof("Incident of %s started at %v was ongoing when the store was closed, resolved at %v", id, last.Start, last.End)
+	}
+	s.incidents[id] = log
+	return nil
+}
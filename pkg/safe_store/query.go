@@ -0,0 +1,97 @@
+package safe_store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/rollup"
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+// Raw history read from the storage for windows in the past up to this length, longer windows read rollups.
+const maxRawQueryWindow = 6 * time.Hour
+
+// Returns the responses dating between from and to.
+// O(log(n)) since responses are sorted by timestamp.
+func getResponsesBetween(responses []types.Response, from, to time.Time) []types.Response {
+	start := sort.Search(len(responses), func(i int) bool {
+		return responses[i].Timestamp() >= from.UnixNano()
+	})
+	end := sort.Search(len(responses), func(i int) bool {
+		return responses[i].Timestamp() > to.UnixNano()
+	})
+	if start >= end {
+		return nil
+	}
+	return responses[start:end]
+}
+
+// Stats computes an instance's stats over any time range [from, to]:
+// - The last two minutes, ten minutes and hour ending now are read from the instance's windows in O(1).
+// - Other ranges within the last hour are computed from the responses kept in memory.
+// - Ranges up to six hours still in the raw retention are computed from the storage's history.
+// - Longer or older ranges are computed from the finest rollups retained at from,
+// thus the range is widened to the buckets holding from and to.
+// The reliability of the stat is computed from the instance's incidents overlapping the range.
+// Returns stat.ErrDataSizeInvalid with an UNKOWN stat if there is no data in the range.
+func (s *SafeStore) Stats(id string, from, to time.Time) (stat.Stat, error) {
+	instanceStat, err := s.stats(id, from, to)
+	instanceStat.Reliability = stat.NewReliability(s.Incidents(id, from, to), from, to)
+	return instanceStat, err
+}
+
+// Computes an instance's stats over [from, to] from the memory, the storage's history or the rollups.
+func (s *SafeStore) stats(id string, from, to time.Time) (stat.Stat, error) {
+	// Rounded to not miss the memory for a range computed as time.Now() minus one hour a few instants ago
+	age := time.Since(from).Round(time.Second)
+	if windowStat, ok, err := s.safeStat.windowStat(id, from, to, time.Now()); ok {
+		return windowStat, err
+	}
+	s.RLock()
+	apdexT := s.apdexT(id)
+	s.RUnlock()
+	if age <= hotWindow {
+		return stat.NewStatWithApdexT(getResponsesBetween(s.Get(id), from, to), apdexT)
+	}
+	if to.Sub(from) <= maxRawQueryWindow && age <= s.retention.Raw {
+		responses, err := s.History(id, from, to)
+		if err != nil {
+			return stat.Stat{}, err
+		}
+		return stat.NewStatWithApdexT(responses, apdexT)
+	}
+	resolution := rollup.Resolution(from, s.retention.Rollups)
+	buckets, err := s.Rollups(id, resolution, from.Truncate(resolution), to)
+	if err != nil {
+		return stat.Stat{}, err
+	}
+	return stat.NewStatFromBuckets(buckets)
+}
+
+// StatsAll computes the stats over [from, to] of every instance having data or registered.
+// Instances without data in the range are mapped to an UNKOWN stat.
+// Returns a map mapping each instance id with a Stat.
+func (s *SafeStore) StatsAll(from, to time.Time) map[string]stat.Stat {
+	s.RLock()
+	ids := make(map[string]bool)
+	for id := range s.data {
+		ids[id] = true
+	}
+	for id := range s.instances {
+		ids[id] = true
+	}
+	s.RUnlock()
+
+	mapAllStats := make(map[string]stat.Stat)
+	for id := range ids {
+		instanceStat, err := s.Stats(id, from, to)
+		if err != nil && err != stat.ErrDataSizeInvalid {
+			logger.Logger.Errorf("Could not compute stats of %s: %v", id, err)
+			continue
+		}
+		mapAllStats[id] = instanceStat
+	}
+	return mapAllStats
+}
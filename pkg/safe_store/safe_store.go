@@ -4,14 +4,66 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Dainerx/wpam/pkg/anomaly"
 	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/rollup"
 	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/storage"
 	"github.com/Dainerx/wpam/pkg/types"
 )
 
+const (
+	// Data kept in memory to compute stats and alerts, older data is only kept by the storage.
+	hotWindow = 1 * time.Hour
+	// Default retention of the storage's raw history.
+	DefaultRawRetention = 1 * time.Hour
+)
+
 type alerts map[string]types.Alerts
 type store map[string][]types.Response
 type statStore map[string]TupleStat
+type instances map[string]types.Instance
+type rollups map[string]*rollup.Rollup
+
+// ResponseListener is called with every response put in the store, once its stats and alerts are updated.
+type ResponseListener func(id string, response types.Response)
+
+// AlertListener is called with every alert transition of an instance: an alert started firing or got resolved.
+// Availability alerts are told as events of kind types.AlertKindAvailability firing while the instance is down.
+type AlertListener func(id string, event types.AlertEvent)
+
+// Retention tells how long the raw history and the rollups of every resolution are kept by the storage.
+type Retention struct {
+	Raw     time.Duration
+	Rollups map[time.Duration]time.Duration
+}
+
+// DefaultRetention returns the retention used by New.
+func DefaultRetention() Retention {
+	retention := Retention{
+		Raw:     DefaultRawRetention,
+		Rollups: map[time.Duration]time.Duration{},
+	}
+	for resolution, rollupRetention := range rollup.DefaultRetentions {
+		retention.Rollups[resolution] = rollupRetention
+	}
+	return retention
+}
+
+// tupleWindow holds the sliding windows the TupleStat of an instance is computed from.
+type tupleWindow struct {
+	twoMinutes *stat.Window
+	tenMinutes *stat.Window
+	oneHour    *stat.Window
+}
+
+func newTupleWindow(apdexT float64) *tupleWindow {
+	return &tupleWindow{
+		twoMinutes: stat.NewWindowWithApdexT(2*time.Minute, apdexT),
+		tenMinutes: stat.NewWindowWithApdexT(10*time.Minute, apdexT),
+		oneHour:    stat.NewWindowWithApdexT(1*time.Hour, apdexT),
+	}
+}
 
 type TupleStat struct {
 	twoMinutesAgoStats stat.Stat
@@ -22,107 +74,120 @@ type TupleStat struct {
 type SafeStat struct {
 	sync.RWMutex //embedded field
 	stats        statStore
+	windows      map[string]*tupleWindow
 }
 type SafeStore struct {
-	sync.RWMutex //embedded field
-	data         store
-	safeStat     *SafeStat
-	alerts       alerts
+	sync.RWMutex   //embedded field
+	data           store
+	safeStat       *SafeStat
+	alerts         alerts
+	instances      instances
+	rollups        rollups
+	firing         firing
+	burnWindows    burnWindows
+	incidents      incidents
+	detectors      detectors
+	contents       contentBaselines
+	listeners      []ResponseListener
+	alertListeners []AlertListener
+	storage        storage.Storage
+	rawHistory     bool // The storage keeps the raw history, otherwise the data in memory is the only copy of it
+	retention      Retention
 }
 
 // Creates a new SafeStat.
 func newSafeStat() *SafeStat {
 	ss := &SafeStat{
-		stats: make(map[string]TupleStat),
+		stats:   make(map[string]TupleStat),
+		windows: make(map[string]*tupleWindow),
 	}
 	return ss
 }
 
-// Fetches an url stat from the store.
+// Fetches an instance stat from the store.
 // Locks then unlocks the safeStat on read.
 // Returns an instance of TupleStat (two minutes, ten minutes and one hour ago).
-func (safeStat *SafeStat) getUrlStat(url string) TupleStat {
+func (safeStat *SafeStat) getInstanceStat(id string) TupleStat {
 	safeStat.RLock()
 	defer safeStat.RUnlock()
-	return safeStat.stats[url]
+	return safeStat.stats[id]
 }
 
-// Fetches an url stat from two minutes ago.
+// Fetches an instance stat from two minutes ago.
 // Locks then unlocks the safeStat on read.
 // Returns stat.Stat instance.
-func (safeStat *SafeStat) getUrlStatTwoMinutesAgo(url string) stat.Stat {
+func (safeStat *SafeStat) getInstanceStatTwoMinutesAgo(id string) stat.Stat {
 	safeStat.RLock()
 	defer safeStat.RUnlock()
-	return safeStat.stats[url].twoMinutesAgoStats
+	return safeStat.stats[id].twoMinutesAgoStats
 }
 
-// Fetches all stats of two minutes ago for all urls.
+// Fetches all stats of two minutes ago for all instances.
 // Locks then unlocks the safeStat on read.
-// Returns a map mapping each url with a Stat.
+// Returns a map mapping each instance id with a Stat.
 func (safeStat *SafeStat) getAllStatTwoMinutesAgo() map[string]stat.Stat {
 	safeStat.RLock()
 	defer safeStat.RUnlock()
 	mapAllStatsTwoMinutesAgo := make(map[string]stat.Stat)
-	for url, stat := range safeStat.stats {
-		mapAllStatsTwoMinutesAgo[url] = stat.twoMinutesAgoStats
+	for id, stat := range safeStat.stats {
+		mapAllStatsTwoMinutesAgo[id] = stat.twoMinutesAgoStats
 	}
 	return mapAllStatsTwoMinutesAgo
 }
 
-// Fetches an url stat from ten minutes ago.
+// Fetches an instance stat from ten minutes ago.
 // Locks then unlocks the safeStat on read.
 // Returns stat.Stat instance.
-func (safeStat *SafeStat) getUrlStatTenMinutesAgo(url string) stat.Stat {
+func (safeStat *SafeStat) getInstanceStatTenMinutesAgo(id string) stat.Stat {
 	safeStat.RLock()
 	defer safeStat.RUnlock()
-	return safeStat.stats[url].tenMinutesAgoStats
+	return safeStat.stats[id].tenMinutesAgoStats
 }
 
-// Fetches all stats of ten minutes ago for all urls.
+// Fetches all stats of ten minutes ago for all instances.
 // Locks then unlocks the safeStat on read.
-// Returns a map mapping each url with a Stat.
+// Returns a map mapping each instance id with a Stat.
 func (safeStat *SafeStat) getAllStatTenMinutesAgo() map[string]stat.Stat {
 	safeStat.RLock()
 	defer safeStat.RUnlock()
 	mapAllStatsTenMinutesAgo := make(map[string]stat.Stat)
-	for url, stat := range safeStat.stats {
-		mapAllStatsTenMinutesAgo[url] = stat.tenMinutesAgoStats
+	for id, stat := range safeStat.stats {
+		mapAllStatsTenMinutesAgo[id] = stat.tenMinutesAgoStats
 	}
 	return mapAllStatsTenMinutesAgo
 }
 
-// Fetches an url stat from one hour ago.
+// Fetches an instance stat from one hour ago.
 // Locks then unlocks the safeStat on read.
 // Returns stat.Stat instance.
-func (safeStat *SafeStat) getUrlStatOneHourAgo(url string) stat.Stat {
+func (safeStat *SafeStat) getInstanceStatOneHourAgo(id string) stat.Stat {
 	safeStat.RLock()
 	defer safeStat.RUnlock()
-	return safeStat.stats[url].oneHourAgoStats
+	return safeStat.stats[id].oneHourAgoStats
 }
 
-// Fetches all stats of one hour ago for all urls.
+// Fetches all stats of one hour ago for all instances.
 // Locks then unlocks the safeStat on read.
-// Returns a map mapping each url with a Stat.
+// Returns a map mapping each instance id with a Stat.
 func (safeStat *SafeStat) getAllStatOneHourAgo() map[string]stat.Stat {
 	safeStat.RLock()
 	defer safeStat.RUnlock()
 	mapAllStatsOneHourAgo := make(map[string]stat.Stat)
-	for url, stat := range safeStat.stats {
-		mapAllStatsOneHourAgo[url] = stat.oneHourAgoStats
+	for id, stat := range safeStat.stats {
+		mapAllStatsOneHourAgo[id] = stat.oneHourAgoStats
 	}
 	return mapAllStatsOneHourAgo
 }
 
-// updateAlerts, takes an url and a time as param then proceeds to update alerts if the url changed the state.
+// updateAlerts, takes an instance id and a time as param then proceeds to update alerts if the instance changed the state.
 // Locks and unlocks the safestore on Read and Write.
-func (safeStore *SafeStore) updateAlerts(url string, time time.Time) {
-	availabilityTwoMinutesAgo := safeStore.safeStat.getUrlStatTwoMinutesAgo(url).Availability
+func (safeStore *SafeStore) updateAlerts(id string, time time.Time) {
+	availabilityTwoMinutesAgo := safeStore.safeStat.getInstanceStatTwoMinutesAgo(id).Availability
 	safeStore.RLock()
-	websiteAlerts := safeStore.alerts[url]
-	data := safeStore.data[url]
+	websiteAlerts := safeStore.alerts[id]
 	safeStore.RUnlock()
 
-	if len(data) == 1 { // Is this the first check?
+	if len(websiteAlerts.Alerts) == 0 { // Is this the first check?
 		if availabilityTwoMinutesAgo < types.AvaiabilityThreshold { // It went down
 			websiteAlerts.Display = true // If a website goes down once always display its alerts
 			websiteAlerts.Alerts = append(websiteAlerts.Alerts,
@@ -151,61 +216,243 @@ func (safeStore *SafeStore) updateAlerts(url string, time time.Time) {
 		}
 	}
 	safeStore.Lock()
-	safeStore.alerts[url] = websiteAlerts // Resassign it
+	previous := len(safeStore.alerts[id].Alerts)
+	safeStore.alerts[id] = websiteAlerts // Resassign it
 	safeStore.Unlock()
+	// The first alert is a transition only if the website is down
+	if n := len(websiteAlerts.Alerts); n > previous && (n > 1 || websiteAlerts.Alerts[0].Availability < types.AvaiabilityThreshold) {
+		alert := websiteAlerts.Alerts[n-1]
+		safeStore.alerted(id, types.AlertEvent{
+			Timestamp: alert.Timestamp,
+			Kind:      types.AlertKindAvailability,
+			Name:      types.AlertNameDown,
+			Value:     alert.Availability,
+			Firing:    alert.Availability < types.AvaiabilityThreshold,
+		})
+	}
 }
 
-// updateStateStore locks the safeStat update entries and unlock it.
+// updateStatStore locks the safeStat, adds the response to the instance's windows and updates its entry then unlock it.
+// Windows are created computing Apdex against apdexT in seconds.
+// O(1) amortized since windows update their stats incrementally.
 // This should be called after every put of data in the SafeStore.
-func (safeStat *SafeStat) updateStatStore(url string, responsesTwoMinuteAgo, responsesTenMinuteAgo, responsesOneHourAgo []types.Response) {
+func (safeStat *SafeStat) updateStatStore(id string, response types.Response, apdexT float64, now time.Time) {
+	safeStat.Lock()
+	defer safeStat.Unlock()
+	windows, ok := safeStat.windows[id]
+	if !ok {
+		windows = newTupleWindow(apdexT)
+		safeStat.windows[id] = windows
+	}
+	safeStat.addToWindows(id, windows, response, now)
+}
+
+// rebuild locks the safeStat, replaces the instance's windows by ones computing Apdex against apdexT in seconds
+// and adds the responses to them then unlock it.
+// Does nothing if the instance has no windows or they already use apdexT.
+func (safeStat *SafeStat) rebuild(id string, responses []types.Response, apdexT float64, now time.Time) {
+	safeStat.Lock()
+	defer safeStat.Unlock()
+	windows, ok := safeStat.windows[id]
+	if !ok || windows.oneHour.ApdexT() == apdexT {
+		return
+	}
+	windows = newTupleWindow(apdexT)
+	safeStat.windows[id] = windows
+	for _, response := range responses {
+		safeStat.addToWindows(id, windows, response, now)
+	}
+}
+
+// Adds the response to the instance's windows and updates its entry, the safeStat must be locked.
+func (safeStat *SafeStat) addToWindows(id string, windows *tupleWindow, response types.Response, now time.Time) {
+	windows.twoMinutes.Add(response)
+	windows.tenMinutes.Add(response)
+	windows.oneHour.Add(response)
+
 	tupleStat := TupleStat{}
-	twoMinutesAgoStats, err := stat.NewStat(responsesTwoMinuteAgo)
+	twoMinutesAgoStats, err := windows.twoMinutes.Stat(now)
 	if err != nil {
 		logger.Logger.Warnf("Could not generate stats of two minutes ago: %v", err)
 	} else {
 		tupleStat.twoMinutesAgoStats = twoMinutesAgoStats
 	}
-	tenMinutesAgoStats, err := stat.NewStat(responsesTenMinuteAgo)
+	tenMinutesAgoStats, err := windows.tenMinutes.Stat(now)
 	if err != nil {
 		logger.Logger.Warnf("Could not generate stats of ten minutes ago: %v", err)
 	} else {
 		tupleStat.tenMinutesAgoStats = tenMinutesAgoStats
 	}
-	oneHourAgoStats, err := stat.NewStat(responsesOneHourAgo)
+	oneHourAgoStats, err := windows.oneHour.Stat(now)
 	if err != nil {
 		logger.Logger.Warnf("Could not generate stats of one hour ago: %v", err)
 	} else {
 		tupleStat.oneHourAgoStats = oneHourAgoStats
 	}
+	safeStat.stats[id] = tupleStat
+}
+
+// windowStat locks the safeStat, computes the stats of the instance's window matching [from, to] then unlock it.
+// The range matches a window if it ends now and lasts the window's duration, to the second.
+// ok is false if no window matches, err is stat.ErrDataSizeInvalid if the window is empty.
+func (safeStat *SafeStat) windowStat(id string, from, to, now time.Time) (windowStat stat.Stat, ok bool, err error) {
+	if now.Sub(to).Round(time.Second) != 0 {
+		return windowStat, false, nil
+	}
 	safeStat.Lock()
-	safeStat.stats[url] = tupleStat
-	safeStat.Unlock()
+	defer safeStat.Unlock()
+	windows, ok := safeStat.windows[id]
+	if !ok {
+		return windowStat, false, nil
+	}
+	var window *stat.Window
+	switch to.Sub(from).Round(time.Second) {
+	case 2 * time.Minute:
+		window = windows.twoMinutes
+	case 10 * time.Minute:
+		window = windows.tenMinutes
+	case time.Hour:
+		window = windows.oneHour
+	default:
+		return windowStat, false, nil
+	}
+	windowStat, err = window.Stat(to)
+	return windowStat, true, err
 }
 
-// New creates a new SafeStore.
+// Drops the stats and windows of an instance.
+func (safeStat *SafeStat) remove(id string) {
+	safeStat.Lock()
+	defer safeStat.Unlock()
+	delete(safeStat.stats, id)
+	delete(safeStat.windows, id)
+}
+
+// New creates a new SafeStore keeping its history in memory for the default retention.
+// The raw history is the data kept in memory, only the rollups are kept by a memory storage.
 func New() *SafeStore {
 	return &SafeStore{
-		data:     map[string][]types.Response{},
-		alerts:   map[string]types.Alerts{},
-		safeStat: newSafeStat(),
+		data:        map[string][]types.Response{},
+		alerts:      map[string]types.Alerts{},
+		safeStat:    newSafeStat(),
+		instances:   map[string]types.Instance{},
+		rollups:     map[string]*rollup.Rollup{},
+		firing:      map[string]map[string]bool{},
+		burnWindows: map[string]map[time.Duration]*stat.Window{},
+		incidents:   map[string][]types.Incident{},
+		detectors:   map[string]*anomaly.Detector{},
+		contents:    map[string]*contentBaseline{},
+		storage:     storage.NewMemory(),
+		retention:   DefaultRetention(),
 	}
 }
 
-// Get Responses from X minutes ago, where x of type time.Duration is passed in argument.
-// Locks the SafeStore's read lock then unlock it
-func getResponsesXMinutesAgo(responses []types.Response, x time.Duration) []types.Response {
-	xMinutesAgo := time.Now().Add(-1 * x * time.Minute)
-	sep := 0
-	for _, response := range responses {
-		if response.Timestamp() < xMinutesAgo.UnixNano() {
-			sep++
-		} else {
-			// Since they are sorted by timestamp if the current element
-			// is not from x minutes ago, the rest won't be
-			break
+// NewWithRetention creates a new SafeStore keeping its history in memory for retention, at least one hour.
+func NewWithRetention(retention Retention) *SafeStore {
+	s := New()
+	s.retention = retention
+	return s
+}
+
+// NewWithStorage creates a new SafeStore keeping its history, rollups and incidents in the given storage for retention.
+// The last hour of every stored instance is loaded back in memory and its stats are computed, its incidents are loaded too.
+// Returns error if the storage could not be read.
+func NewWithStorage(st storage.Storage, retention Retention) (*SafeStore, error) {
+	s := New()
+	s.storage = st
+	s.rawHistory = true
+	s.retention = retention
+	ids, err := st.Ids()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, id := range ids {
+		responses, err := st.Range(id, now.Add(-hotWindow), now)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.loadIncidents(id); err != nil {
+			return nil, err
+		}
+		if len(responses) == 0 {
+			continue
+		}
+		s.data[id] = responses
+		// Instances are not registered yet, their windows are rebuilt on registration if their Apdex target differs
+		for _, response := range responses {
+			s.safeStat.updateStatStore(id, response, types.DefaultApdexT, now)
 		}
+		logger.Logger.Infof("Loaded %d responses of %s from the storage", len(responses), id)
 	}
-	return responses[sep:]
+	return s, nil
+}
+
+// Register keeps the instance as metadata (url, http method...) of the data mapped by its id.
+// Registering an already known id replaces its metadata, its stats are recomputed if its Apdex target changed
+// and its burn rate windows are dropped if its objective changed, they are filled again on its next response.
+// The alerts it can not fire anymore, e.g. of a removed rule, are resolved.
+// Locks the SafeStore's write lock then unlock it
+func (s *SafeStore) Register(instance types.Instance) {
+	s.Lock()
+	if previous, ok := s.instances[instance.Id]; ok && previous.Slo != instance.Slo {
+		delete(s.burnWindows, instance.Id)
+	}
+	s.instances[instance.Id] = instance
+	apdexT := s.apdexT(instance.Id)
+	if r, ok := s.rollups[instance.Id]; ok {
+		r.SetApdexT(apdexT)
+	}
+	now := time.Now()
+	s.safeStat.rebuild(instance.Id, s.data[instance.Id], apdexT, now)
+	resolved := s.pruneFiring(instance, now)
+	s.Unlock()
+	for _, event := range resolved {
+		s.alerted(instance.Id, event)
+	}
+}
+
+// Returns the Apdex target time in seconds of an instance, the default one if it is not registered or has none.
+// The SafeStore must be locked.
+func (s *SafeStore) apdexT(id string) float64 {
+	if instance, ok := s.instances[id]; ok && instance.ApdexT > 0 {
+		return instance.ApdexT
+	}
+	return types.DefaultApdexT
+}
+
+// Get the instance registered under an id, ok is false if the id was never registered.
+// O(1)
+// Locks the SafeStore's read lock then unlock it
+func (s *SafeStore) GetInstance(id string) (instance types.Instance, ok bool) {
+	s.RLock()
+	defer s.RUnlock()
+	instance, ok = s.instances[id]
+	return instance, ok
+}
+
+// Get the url of every registered instance as map mapping every instance id to its url.
+// Locks the SafeStore read lock then unlock it.
+func (s *SafeStore) GetAllUrls() map[string]string {
+	s.RLock()
+	defer s.RUnlock()
+	mapAllUrls := make(map[string]string)
+	for id, instance := range s.instances {
+		mapAllUrls[id] = instance.Url
+	}
+	return mapAllUrls
+}
+
+// Get every registered instance as map mapping every instance id to its instance.
+// Locks the SafeStore read lock then unlock it.
+func (s *SafeStore) GetAllInstances() map[string]types.Instance {
+	s.RLock()
+	defer s.RUnlock()
+	mapAllInstances := make(map[string]types.Instance)
+	for id, instance := range s.instances {
+		mapAllInstances[id] = instance
+	}
+	return mapAllInstances
 }
 
 // Get Responses from X hours ago, where x of type time.Duration is passed in argument.
@@ -226,27 +473,101 @@ func getResponsesXHoursAgo(responses []types.Response, x time.Duration) []types.
 	return responses[sep:]
 }
 
-// Put will add a response to the url's data (responses) in the store.
-// Not linear due to the update of statStore <- look more into this
+// Put will add a response to the instance's data (responses) in the store.
+// O(1) amortized, stats are updated incrementally by the instance's windows.
 // Locks the SafeStore's write lock then unlock it
-func (s *SafeStore) Put(url string, response types.Response) {
+func (s *SafeStore) Put(id string, response types.Response) {
+	if s.rawHistory {
+		if err := s.storage.Append(id, response); err != nil {
+			logger.Logger.Errorf("Failed to persist response of %s: %v", id, err)
+		}
+	}
+	s.Lock()
+	s.data[id] = append(s.data[id], response)
+	apdexT := s.apdexT(id)
+	if _, ok := s.rollups[id]; !ok {
+		s.rollups[id] = rollup.NewWithApdexT(apdexT)
+	}
+	closedBuckets := s.rollups[id].Add(response)
+	s.Unlock()
+	for _, bucket := range closedBuckets {
+		if err := s.storage.AppendBucket(id, bucket); err != nil {
+			logger.Logger.Errorf("Failed to persist %v bucket of %s: %v", bucket.Resolution, id, err)
+		}
+	}
+	now := time.Now()
+	s.safeStat.updateStatStore(id, response, apdexT, now)
+	s.updateAlerts(id, now)
+	s.updateIncidents(id, response, now)
+	s.updateRuleAlerts(id, now)
+	s.updateBurnRateAlerts(id, response, now)
+	s.updateAnomalyAlerts(id, response, now)
+	s.updateContentAlerts(id, response, now)
 	s.RLock()
-	s.data[url] = append(s.data[url], response)
-	currentResponses := s.data[url]
+	listeners := s.listeners
 	s.RUnlock()
-	//can be optimized
-	s.safeStat.updateStatStore(url, getResponsesXMinutesAgo(currentResponses, 2), getResponsesXMinutesAgo(currentResponses, 10), getResponsesXMinutesAgo(currentResponses, 60))
-	s.updateAlerts(url, time.Now())
+	for _, listener := range listeners {
+		listener(id, response)
+	}
 }
 
-// Remove data (responses) of an url from the store.
+// OnResponse registers a listener called with every response put in the store afterwards.
+// Listeners are called synchronously by Put, they must not block.
 // Locks the SafeStore's write lock then unlock it
-func (s *SafeStore) Remove(url string) {
+func (s *SafeStore) OnResponse(listener ResponseListener) {
+	s.Lock()
+	defer s.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// OnAlert registers a listener called with every alert transition of the instances afterwards.
+// Listeners are called synchronously by Put, they must not block.
+// Locks the SafeStore's write lock then unlock it
+func (s *SafeStore) OnAlert(listener AlertListener) {
+	s.Lock()
+	defer s.Unlock()
+	s.alertListeners = append(s.alertListeners, listener)
+}
+
+// Calls the alert listeners with the alert transition.
+// Locks the SafeStore's read lock then unlock it
+func (s *SafeStore) alerted(id string, event types.AlertEvent) {
+	s.RLock()
+	listeners := s.alertListeners
+	s.RUnlock()
+	for _, listener := range listeners {
+		listener(id, event)
+	}
+}
+
+// Remove data (responses) of an instance from the store.
+// Locks the SafeStore's write lock then unlock it
+func (s *SafeStore) Remove(id string) {
 	s.Lock()
 	defer s.Unlock()
 	// If key does not exist delete is no-op.
-	delete(s.data, url)
-	logger.Logger.Infof("%s 's data was removed from the store", url)
+	delete(s.data, id)
+	delete(s.rollups, id)
+	delete(s.burnWindows, id)
+	delete(s.incidents, id)
+	delete(s.detectors, id)
+	delete(s.contents, id)
+	s.safeStat.remove(id)
+	if err := s.storage.Remove(id); err != nil {
+		logger.Logger.Errorf("Failed to remove %s 's history from the storage: %v", id, err)
+	}
+	logger.Logger.Infof("%s 's data was removed from the store", id)
+}
+
+// Unregister forgets an instance: its metadata, alerts and data are removed from the store.
+// Locks the SafeStore's write lock then unlock it
+func (s *SafeStore) Unregister(id string) {
+	s.Lock()
+	delete(s.instances, id)
+	delete(s.alerts, id)
+	delete(s.firing, id)
+	s.Unlock()
+	s.Remove(id)
 }
 
 // Len will return the number of entries in the store's data.
@@ -257,70 +578,99 @@ func (s *SafeStore) Len() int {
 	return len(s.data)
 }
 
-// Get an array of responses from the store mapped by an url.
+// Get an array of responses from the store mapped by an instance id.
 // O(1)
 // Locks the SafeStore's read lock then unlock it
-func (s *SafeStore) Get(url string) []types.Response {
+func (s *SafeStore) Get(id string) []types.Response {
 	s.RLock()
 	defer s.RUnlock()
-	return s.data[url]
+	return s.data[id]
 }
 
-// Get an url's stats as Alerts.
+// History returns the responses of an instance dating between from and to, read from the storage.
+// Unlike Get, the history is not limited to the last hour but to the store's retention.
+// The history of a store created by New is the data in memory.
+func (s *SafeStore) History(id string, from, to time.Time) ([]types.Response, error) {
+	if !s.rawHistory {
+		s.RLock()
+		defer s.RUnlock()
+		return append([]types.Response(nil), getResponsesBetween(s.data[id], from, to)...), nil
+	}
+	return s.storage.Range(id, from, to)
+}
+
+// Rollups returns the buckets of an instance at a resolution starting between from and to.
+// Closed buckets are read from the storage, the open bucket is added if it is in the range.
+func (s *SafeStore) Rollups(id string, resolution time.Duration, from, to time.Time) ([]rollup.Bucket, error) {
+	buckets, err := s.storage.Buckets(id, resolution, from, to)
+	if err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if r, ok := s.rollups[id]; ok {
+		if open, ok := r.Open(resolution); ok && !open.Start.Before(from) && !open.Start.After(to) {
+			buckets = rollup.Compact(append(buckets, open))
+		}
+	}
+	return buckets, nil
+}
+
+// Get an instance's stats as Alerts.
 // O(1)
 // Locks the SafeStore read lock then unlock it.
-func (s *SafeStore) GetUrlAlerts(url string) types.Alerts {
+func (s *SafeStore) GetInstanceAlerts(id string) types.Alerts {
 	s.RLock()
 	defer s.RUnlock()
-	return s.alerts[url]
+	return s.alerts[id]
 }
 
-// Get an all alerts as map mapping every url to its Alerts.
+// Get an all alerts as map mapping every instance id to its Alerts.
 // Locks the SafeStore read lock then unlock it.
 func (s *SafeStore) GetAllAlerts() map[string]types.Alerts {
 	s.RLock()
 	defer s.RUnlock()
 	mapAllAlert := make(map[string]types.Alerts)
-	for url, alerts := range s.alerts {
-		mapAllAlert[url] = alerts
+	for id, alerts := range s.alerts {
+		mapAllAlert[id] = alerts
 	}
 	return mapAllAlert
 }
 
-// Get an url's stats as a TupleStat.
+// Get an instance's stats as a TupleStat.
 // O(1)
 // Locks the SafeStore.safeStat's read lock then unlock it.
-func (s *SafeStore) GetUrlStats(url string) TupleStat {
-	return s.safeStat.getUrlStat(url)
+func (s *SafeStore) GetInstanceStats(id string) TupleStat {
+	return s.safeStat.getInstanceStat(id)
 }
 
-// Get an url's stats from 10 minutes ago.
+// Get an instance's stats from 10 minutes ago.
 // O(1)
 // Locks the SafeStore.safeStat's read lock then unlock it.
-func (s *SafeStore) GetUrlStatsTwoMinutesAgo(url string) stat.Stat {
-	return s.safeStat.getUrlStatTwoMinutesAgo(url)
+func (s *SafeStore) GetInstanceStatsTwoMinutesAgo(id string) stat.Stat {
+	return s.safeStat.getInstanceStatTwoMinutesAgo(id)
 }
 
 func (s *SafeStore) GetAllStatsTwoMinutesAgo() map[string]stat.Stat {
 	return s.safeStat.getAllStatTwoMinutesAgo()
 }
 
-// Get an url's stats from 10 minutes ago.
+// Get an instance's stats from 10 minutes ago.
 // O(1)
 // Locks the SafeStore.safeStat's read lock then unlock it.
-func (s *SafeStore) GetUrlStatsTenMinutesAgo(url string) stat.Stat {
-	return s.safeStat.getUrlStatTenMinutesAgo(url)
+func (s *SafeStore) GetInstanceStatsTenMinutesAgo(id string) stat.Stat {
+	return s.safeStat.getInstanceStatTenMinutesAgo(id)
 }
 
 func (s *SafeStore) GetAllStatsTenMinutesAgo() map[string]stat.Stat {
 	return s.safeStat.getAllStatTenMinutesAgo()
 }
 
-// Get an url's stats from 1 hour ago.
+// Get an instance's stats from 1 hour ago.
 // O(1)
 // Locks the SafeStore.safeStat's read lock then unlock it.
-func (s *SafeStore) GetUrlStatsOneHourAgo(url string) stat.Stat {
-	return s.safeStat.getUrlStatOneHourAgo(url)
+func (s *SafeStore) GetInstanceStatsOneHourAgo(id string) stat.Stat {
+	return s.safeStat.getInstanceStatOneHourAgo(id)
 }
 
 func (s *SafeStore) GetAllStatsOneHourAgo() map[string]stat.Stat {
@@ -328,17 +678,62 @@ func (s *SafeStore) GetAllStatsOneHourAgo() map[string]stat.Stat {
 }
 
 func (s *SafeStore) CleanDataFromXHoursAgo(x int) {
+	s.cleanDataBefore(time.Now().Add(-time.Duration(x) * time.Hour))
+}
+
+// Removes the responses dating before t from the memory.
+// Locks the SafeStore then unlock it.
+func (s *SafeStore) cleanDataBefore(t time.Time) {
 	s.Lock()
 	defer s.Unlock()
-	for url, responses := range s.data {
-		s.data[url] = getResponsesXHoursAgo(responses, time.Duration(x)*time.Hour) //keep only data from one hour ago
+	for id, responses := range s.data {
+		s.data[id] = getResponsesXHoursAgo(responses, time.Since(t)) //keep only data from t
 	}
 }
 
-// CleanData cleans the store and remove responses dating more than one hour ago
+// CleanData cleans the store and remove responses dating more than one hour ago, or more than the raw retention ago
+// if longer and the memory is the only copy of the history.
+// Then prunes the storage's history dating more than the retention ago.
 func (s *SafeStore) CleanData() {
-	logger.Logger.Info("Started data cleaning process. Dropping data dating more than one hour ago.")
-	s.CleanDataFromXHoursAgo(1)
+	kept := hotWindow
+	if !s.rawHistory && s.retention.Raw > kept {
+		kept = s.retention.Raw
+	}
+	logger.Logger.Infof("Started data cleaning process. Dropping data dating more than %v ago.", kept)
+	s.cleanDataBefore(time.Now().Add(-kept))
+	if err := s.storage.Prune(time.Now().Add(-s.retention.Raw)); err != nil {
+		logger.Logger.Errorf("Failed to prune the storage: %v", err)
+	}
+	for resolution, retention := range s.retention.Rollups {
+		if err := s.storage.PruneBuckets(resolution, time.Now().Add(-retention)); err != nil {
+			logger.Logger.Errorf("Failed to prune the %v rollups: %v", resolution, err)
+		}
+	}
+	// Incidents are kept as long as the coarsest rollups, reliability can be computed over the same windows
+	var incidentsRetention time.Duration
+	for _, retention := range s.retention.Rollups {
+		if retention > incidentsRetention {
+			incidentsRetention = retention
+		}
+	}
+	s.Lock()
+	s.pruneIncidents(time.Now().Add(-incidentsRetention))
+	s.Unlock()
 	logger.Logger.Info("Data cleaning process has finished.")
 	// That's all cause stats are always updated and alerts are always kept for historical reasons
 }
+
+// Close persists the open rollup buckets and closes the storage behind the store.
+// The store must not be used afterwards.
+func (s *SafeStore) Close() error {
+	s.Lock()
+	for id, r := range s.rollups {
+		for _, bucket := range r.Flush() {
+			if err := s.storage.AppendBucket(id, bucket); err != nil {
+				logger.Logger.Errorf("Failed to persist %v bucket of %s: %v", bucket.Resolution, id, err)
+			}
+		}
+	}
+	s.Unlock()
+	return s.storage.Close()
+}
@@ -1,21 +1,29 @@
 package safe_store_test
 
 import (
+	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/storage"
 	"github.com/Dainerx/wpam/pkg/types"
 	"github.com/Dainerx/wpam/pkg/website_check"
 )
 
 const (
-	keyFirst     = "first"
-	KeySecond    = "second"
-	TenResponses = 10
+	keyFirst      = "first"
+	KeySecond     = "second"
+	TenResponses  = 10
+	checkInterval = 10 * time.Second
+	// Responses of an hour of history, one every checkInterval
+	hourResponses = int(time.Hour / checkInterval)
 )
 
 // This file tests the store creation and different methods.
@@ -70,6 +78,39 @@ func TestStoreRemove(t *testing.T) {
 	}
 }
 
+func TestStoreRegister(t *testing.T) {
+	s := safe_store.New()
+	// Same url checked by two instances with different methods
+	s.Register(types.Instance{Id: keyFirst, Url: "http://example.com", HttpMethod: types.HTTPGet})
+	s.Register(types.Instance{Id: KeySecond, Url: "http://example.com", HttpMethod: types.HTTPPost})
+	s.Put(keyFirst, website_check.CheckResponse{})
+	s.Put(KeySecond, website_check.CheckResponse{})
+	s.Put(KeySecond, website_check.CheckResponse{})
+	if got := len(s.Get(keyFirst)); got != 1 {
+		t.Errorf("len(s.Get(%s)) = %d, want 1.", keyFirst, got)
+	}
+	if got := len(s.Get(KeySecond)); got != 2 {
+		t.Errorf("len(s.Get(%s)) = %d, want 2.", KeySecond, got)
+	}
+	instance, ok := s.GetInstance(KeySecond)
+	if !ok || instance.HttpMethod != types.HTTPPost {
+		t.Errorf("s.GetInstance(%s) = %v, %t, want method %s.", KeySecond, instance, ok, types.HTTPPost)
+	}
+	if got := len(s.GetAllUrls()); got != 2 {
+		t.Errorf("len(s.GetAllUrls()) = %d, want 2.", got)
+	}
+	s.Unregister(KeySecond)
+	if _, ok := s.GetInstance(KeySecond); ok {
+		t.Errorf("s.GetInstance(%s) is still registered after s.Unregister(%s).", KeySecond, KeySecond)
+	}
+	if got := len(s.Get(KeySecond)); got != 0 {
+		t.Errorf("len(s.Get(%s)) = %d after s.Unregister(%s), want 0.", KeySecond, got, KeySecond)
+	}
+	if _, ok := s.GetAllAlerts()[KeySecond]; ok {
+		t.Errorf("s.GetAllAlerts() still has alerts of %s after s.Unregister(%s).", KeySecond, KeySecond)
+	}
+}
+
 func TestStoreGet(t *testing.T) {
 	ts := httptest.NewServer(
 		http.HandlerFunc(getHandler),
@@ -91,7 +132,10 @@ func TestStoreGet(t *testing.T) {
 	if got := s.Get(keyFirst); got[0].Status() != types.Up {
 		t.Errorf("s.Get(%s).Status = %s, want %s.", keyFirst, got[0].Status(), types.Up)
 	}
-
+	// Without a storage the history is the data in memory
+	if history, err := s.History(keyFirst, time.Now().Add(-time.Hour), time.Now()); err != nil || len(history) != 1 {
+		t.Errorf("s.History(%s) = %d responses, %v, want 1.", keyFirst, len(history), err)
+	}
 }
 
 func TestCleanUpData(t *testing.T) {
@@ -114,15 +158,181 @@ func TestCleanUpData(t *testing.T) {
 		t.Fatalf("%v", err)
 	}
 	checkRequest.RunForXSeconds(time.Second * 3)
-	if len(s.Get(url)) == 0 {
+	if len(s.Get(instance.Id)) == 0 {
 		t.Error("No request were performed.")
 	}
 	s.CleanDataFromXHoursAgo(-1) // Go to the future and clean the data
-	if len(s.Get(url)) != 0 {
+	if len(s.Get(instance.Id)) != 0 {
 		t.Error("Data cleaning process failed.")
 	}
 }
 
+// The memory keeps an hour of history, or the raw retention if longer when it is the only copy of the history.
+func TestCleanDataRetention(t *testing.T) {
+	retention := safe_store.DefaultRetention()
+	retention.Raw = 24 * time.Hour
+	for _, test := range []struct {
+		store *safe_store.SafeStore
+		want  int
+	}{
+		{safe_store.New(), 1},
+		{safe_store.NewWithRetention(retention), 2},
+	} {
+		test.store.Put(keyFirst, *website_check.NewCheckResponseAt(time.Now().Add(-2*time.Hour), []int{http.StatusOK}, http.StatusOK, time.Second, 0))
+		test.store.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+		test.store.CleanData()
+		if got := len(test.store.Get(keyFirst)); got != test.want {
+			t.Errorf("len(s.Get(%s)) after cleaning = %d, want %d.", keyFirst, got, test.want)
+		}
+	}
+}
+
+// History kept on disk must survive a restart of the store.
+func TestStoreWithDiskStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	retention := safe_store.DefaultRetention()
+	retention.Raw = 24 * time.Hour
+	s, err := safe_store.NewWithStorage(st, retention)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	s.Close()
+
+	st, err = storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s, err = safe_store.NewWithStorage(st, retention)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer s.Close()
+	if got := len(s.Get(keyFirst)); got != 2 {
+		t.Errorf("len(s.Get(%s)) after restart = %d, want 2.", keyFirst, got)
+	}
+	if got := s.GetInstanceStatsTenMinutesAgo(keyFirst).Availability; got != 100 {
+		t.Errorf("Availability after restart = %f, want 100.", got)
+	}
+	history, err := s.History(keyFirst, time.Now().Add(-time.Hour), time.Now())
+	if err != nil || len(history) != 2 {
+		t.Errorf("s.History(%s) = %d responses, %v, want 2.", keyFirst, len(history), err)
+	}
+	// Open buckets were flushed on Close and are read back from the storage
+	buckets, err := s.Rollups(keyFirst, time.Minute, time.Now().Add(-time.Hour), time.Now())
+	if err != nil || len(buckets) != 1 || buckets[0].Count != 2 {
+		t.Errorf("s.Rollups(%s) = %v, %v, want one bucket of 2 responses.", keyFirst, buckets, err)
+	}
+}
+
+// Stats over any range, ranges older than an hour are computed from rollups.
+// Ranges of a window ending now are the window's stats.
+func TestStats(t *testing.T) {
+	s := safe_store.New()
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusNotFound, 3*time.Second, 0))
+	// Read from the windows, the memory and the rollups
+	for _, since := range []time.Duration{10 * time.Minute, 20 * time.Minute, 72 * time.Hour} {
+		got, err := s.Stats(keyFirst, time.Now().Add(-since), time.Now())
+		if err != nil {
+			t.Fatalf("s.Stats(%s, %v) failed: %v", keyFirst, since, err)
+		}
+		if got.Availability != 50 || got.FailuresCount != 1 || got.MaxRt != 3 || got.AvgRt != 2 {
+			t.Errorf("s.Stats(%s, %v) = %+v, want availability 50, 1 failure, max 3s, avg 2s.", keyFirst, since, got)
+		}
+	}
+	// Nothing in a range of the past
+	if got, err := s.Stats(keyFirst, time.Now().Add(-20*time.Minute), time.Now().Add(-10*time.Minute)); err != stat.ErrDataSizeInvalid || got.LastStatus != types.Unkown {
+		t.Errorf("s.Stats(%s) of an empty range = %+v, %v, want %s and %v.", keyFirst, got, err, types.Unkown, stat.ErrDataSizeInvalid)
+	}
+
+	// Registered instances without data are mapped to an UNKOWN stat
+	s.Register(types.Instance{Id: KeySecond, Url: "http://example.com"})
+	all := s.StatsAll(time.Now().Add(-10*time.Minute), time.Now())
+	if len(all) != 2 || all[keyFirst].Availability != 50 || all[KeySecond].LastStatus != types.Unkown {
+		t.Errorf("s.StatsAll() = %+v, want 2 stats, %s being %s.", all, KeySecond, types.Unkown)
+	}
+}
+
+// Apdex is computed against the instance's target time, stats are recomputed when it changes.
+func TestApdex(t *testing.T) {
+	s := safe_store.New()
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 100*time.Millisecond, 0))
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	// Default target of 0.5s: one satisfied and one tolerating
+	if got := s.GetInstanceStatsTwoMinutesAgo(keyFirst).Apdex; got != 0.75 {
+		t.Errorf("s.GetInstanceStatsTwoMinutesAgo(%s).Apdex = %f, want 0.75.", keyFirst, got)
+	}
+	s.Register(types.Instance{Id: keyFirst, ApdexT: 1})
+	if got := s.GetInstanceStatsTwoMinutesAgo(keyFirst).Apdex; got != 1 {
+		t.Errorf("s.GetInstanceStatsTwoMinutesAgo(%s).Apdex after registration = %f, want 1.", keyFirst, got)
+	}
+	if got, err := s.Stats(keyFirst, time.Now().Add(-10*time.Minute), time.Now()); err != nil || got.Apdex != 1 {
+		t.Errorf("s.Stats(%s).Apdex = %f, %v, want 1.", keyFirst, got.Apdex, err)
+	}
+	// Rollups keep the target time they were aggregated with
+	if got, err := s.Stats(keyFirst, time.Now().Add(-72*time.Hour), time.Now()); err != nil || got.Apdex != 0.75 {
+		t.Errorf("s.Stats(%s).Apdex from rollups = %f, %v, want 0.75.", keyFirst, got.Apdex, err)
+	}
+}
+
+// Rules of a registered instance raise an alert event when they start firing.
+func TestRuleAlerts(t *testing.T) {
+	s := safe_store.New()
+	s.Register(types.Instance{Id: keyFirst, Rules: []types.Rule{{Metric: "max_rt", Operator: types.OperatorAbove, Threshold: 2}}})
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	if got := s.GetInstanceAlerts(keyFirst); len(got.Events) != 0 {
+		t.Errorf("len(s.GetInstanceAlerts(%s).Events) = %d, want 0.", keyFirst, len(got.Events))
+	}
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 3*time.Second, 0))
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	got := s.GetInstanceAlerts(keyFirst)
+	if len(got.Events) != 1 || !got.Events[0].Firing || got.Events[0].Value != 3 || got.Events[0].Kind != types.AlertKindRule {
+		t.Errorf("s.GetInstanceAlerts(%s).Events = %+v, want one firing rule event of value 3.", keyFirst, got.Events)
+	}
+	if !got.Display {
+		t.Errorf("s.GetInstanceAlerts(%s).Display = false, want true.", keyFirst)
+	}
+}
+
+// A firing alert is resolved once its rule is removed from the instance.
+func TestRemovedRuleAlertResolved(t *testing.T) {
+	s := safe_store.New()
+	rule := types.Rule{Metric: "max_rt", Operator: types.OperatorAbove, Threshold: 2}
+	s.Register(types.Instance{Id: keyFirst, Rules: []types.Rule{rule}})
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 3*time.Second, 0))
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	if got := s.GetInstanceAlerts(keyFirst).Firing(); len(got) != 1 {
+		t.Fatalf("s.GetInstanceAlerts(%s).Firing() = %+v, want the rule firing.", keyFirst, got)
+	}
+	var told []types.AlertEvent
+	s.OnAlert(func(id string, event types.AlertEvent) {
+		told = append(told, event)
+	})
+	s.Register(types.Instance{Id: keyFirst})
+	if got := s.GetInstanceAlerts(keyFirst).Firing(); len(got) != 0 {
+		t.Errorf("s.GetInstanceAlerts(%s).Firing() = %+v, want none once the rule is removed.", keyFirst, got)
+	}
+	if len(told) != 1 || told[0].Firing || told[0].Name != rule.String() || told[0].Kind != types.AlertKindRule {
+		t.Errorf("Alert listeners were told %+v, want the rule resolved.", told)
+	}
+	// Adding the rule back fires it again
+	s.Register(types.Instance{Id: keyFirst, Rules: []types.Rule{rule}})
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	if got := s.GetInstanceAlerts(keyFirst).Firing(); len(got) != 1 {
+		t.Errorf("s.GetInstanceAlerts(%s).Firing() = %+v, want the rule firing again.", keyFirst, got)
+	}
+}
+
 func BenchmarkRead(b *testing.B) {
 	s := safe_store.New()
 	nbr := b.N
@@ -155,3 +365,283 @@ func BenchmarkReadWrite(b *testing.B) {
 		}
 	}
 }
+
+// Fills a store with instancesCount instances each having an hour of history, one response every 10 seconds.
+func newStoreWithHistory(instancesCount int) (*safe_store.SafeStore, []string) {
+	s := safe_store.New()
+	now := time.Now()
+	ids := make([]string, instancesCount)
+	for i := range ids {
+		ids[i] = strconv.FormatInt(int64(i), 10)
+		for j := hourResponses; j > 0; j-- {
+			s.Put(ids[i], *website_check.NewCheckResponseAt(now.Add(-time.Duration(j)*checkInterval), []int{http.StatusOK}, http.StatusOK, time.Second, 0))
+		}
+	}
+	return s, ids
+}
+
+// Put with thousands of instances each having an hour of history.
+// Stats of every window are updated incrementally so the cost of a Put does not grow with the history.
+func benchmarkPutInstances(b *testing.B, instancesCount int) {
+	s, ids := newStoreWithHistory(instancesCount)
+	response := *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Put(ids[i%instancesCount], response)
+	}
+}
+
+// Baseline of benchmarkPutInstances: Put then recompute the stats of the instance's hour of history,
+// as the store used to do on every response.
+func benchmarkPutRecomputeInstances(b *testing.B, instancesCount int) {
+	s, ids := newStoreWithHistory(instancesCount)
+	response := *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := ids[i%instancesCount]
+		s.Put(id, response)
+		_, _ = stat.NewStat(s.Get(id))
+	}
+}
+
+func BenchmarkPutThousandInstances(b *testing.B) {
+	benchmarkPutInstances(b, 1000)
+}
+
+func BenchmarkPutRecomputeThousandInstances(b *testing.B) {
+	benchmarkPutRecomputeInstances(b, 1000)
+}
+
+func BenchmarkPutFiveThousandInstances(b *testing.B) {
+	benchmarkPutInstances(b, 5000)
+}
+
+func BenchmarkPutRecomputeFiveThousandInstances(b *testing.B) {
+	benchmarkPutRecomputeInstances(b, 5000)
+}
+
+// Failures of an instance with an objective burn its error budget and raise burn rate alerts.
+func TestSlo(t *testing.T) {
+	s := safe_store.New()
+	s.Register(types.Instance{Id: keyFirst, Slo: types.Slo{Target: 99.9, WindowDays: 30}})
+	if _, err := s.ErrorBudget(keyFirst, time.Now()); err != stat.ErrDataSizeInvalid {
+		t.Errorf("s.ErrorBudget(%s) without data = %v, want %v.", keyFirst, err, stat.ErrDataSizeInvalid)
+	}
+	if _, err := s.ErrorBudget(KeySecond, time.Now()); err != safe_store.ErrSloNotDefined {
+		t.Errorf("s.ErrorBudget(%s) = %v, want %v.", KeySecond, err, safe_store.ErrSloNotDefined)
+	}
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	if got := s.GetInstanceAlerts(keyFirst); len(got.Events) != 0 {
+		t.Errorf("len(s.GetInstanceAlerts(%s).Events) = %d, want 0.", keyFirst, len(got.Events))
+	}
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusNotFound, time.Second, 0))
+	// Not evaluated before slo.MinResponses responses
+	if got := s.GetInstanceAlerts(keyFirst); len(got.Events) != 0 {
+		t.Errorf("s.GetInstanceAlerts(%s).Events = %+v, want none with two responses.", keyFirst, got.Events)
+	}
+	for i := 0; i < 8; i++ {
+		s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	}
+	got := s.GetInstanceAlerts(keyFirst)
+	if len(got.Events) != 2 || !got.Events[0].Firing || got.Events[0].Kind != types.AlertKindBurnRate || math.Round(got.Events[0].Value) != 100 {
+		t.Errorf("s.GetInstanceAlerts(%s).Events = %+v, want two firing burn rate events of value 100.", keyFirst, got.Events)
+	}
+	budget, err := s.ErrorBudget(keyFirst, time.Now())
+	if err != nil || budget.Availability != 90 || !budget.Exhausted() {
+		t.Errorf("s.ErrorBudget(%s) = %+v, %v, want an exhausted budget at 90%% availability.", keyFirst, budget, err)
+	}
+	if all := s.ErrorBudgetsAll(time.Now()); len(all) != 1 {
+		t.Errorf("len(s.ErrorBudgetsAll()) = %d, want 1.", len(all))
+	}
+}
+
+// Burn rate windows are filled with the stored history after a restart, not only the hour kept in memory.
+func TestSloWithDiskStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	retention := safe_store.DefaultRetention()
+	retention.Raw = 24 * time.Hour
+	instance := types.Instance{Id: keyFirst, Slo: types.Slo{Target: 99, WindowDays: 30}}
+	st, err := storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s, err := safe_store.NewWithStorage(st, retention)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s.Register(instance)
+	// A hundred responses up two to three hours ago
+	start := time.Now().Add(-3 * time.Hour)
+	for i := 0; i < 100; i++ {
+		s.Put(keyFirst, *website_check.NewCheckResponseAt(start.Add(time.Duration(i)*36*time.Second), []int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	}
+	s.Close()
+
+	st, err = storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s, err = safe_store.NewWithStorage(st, retention)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer s.Close()
+	s.Register(instance)
+	// One failure out of 10 burns the budget 10 times faster over 30 minutes, not over 6 hours with the history
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusNotFound, time.Second, 0))
+	for i := 0; i < 9; i++ {
+		s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	}
+	for _, event := range s.GetInstanceAlerts(keyFirst).Events {
+		if event.Kind == types.AlertKindBurnRate && event.Firing {
+			t.Errorf("Burn rate event %+v, want none with the 6h window filled with the history.", event)
+		}
+	}
+}
+
+// An incident is opened by a down alert and closed by the resume alert.
+func TestIncidents(t *testing.T) {
+	s := safe_store.New()
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusNotFound, time.Second, 0))
+	got := s.Incidents(keyFirst, time.Now().Add(-time.Hour), time.Now())
+	if len(got) != 1 || !got[0].Ongoing() || got[0].MinAvailability != 0 || got[0].ErrorClasses[types.ErrorClassBadStatus] != 1 {
+		t.Fatalf("s.Incidents(%s) = %+v, want one ongoing incident with one bad status.", keyFirst, got)
+	}
+	// Incidents returned are copies, the store keeps counting its error classes under its lock
+	got[0].ErrorClasses[types.ErrorClassBadStatus] = 10
+	if again := s.Incidents(keyFirst, time.Now().Add(-time.Hour), time.Now()); again[0].ErrorClasses[types.ErrorClassBadStatus] != 1 {
+		t.Errorf("s.Incidents(%s) shares its error classes with a previous result, got %+v.", keyFirst, again[0].ErrorClasses)
+	}
+	// Availability over two minutes reaches 80% after four responses up
+	for i := 0; i < 4; i++ {
+		s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	}
+	got = s.Incidents(keyFirst, time.Now().Add(-time.Hour), time.Now())
+	if len(got) != 1 || got[0].Ongoing() {
+		t.Fatalf("s.Incidents(%s) = %+v, want one resolved incident.", keyFirst, got)
+	}
+	note := types.IncidentNote{Timestamp: time.Now(), Text: "Database failover"}
+	if incident, err := s.AddIncidentNote(keyFirst, got[0].Start.Truncate(time.Second), note); err != nil || len(incident.Notes) != 1 {
+		t.Errorf("s.AddIncidentNote(%s) = %+v, %v, want the incident with the note.", keyFirst, incident, err)
+	}
+	if _, err := s.AddIncidentNote(keyFirst, got[0].Start.Add(-time.Hour), note); err != safe_store.ErrIncidentNotFound {
+		t.Errorf("s.AddIncidentNote(%s) before the incident = %v, want %v.", keyFirst, err, safe_store.ErrIncidentNotFound)
+	}
+	if got := s.Incidents(keyFirst, time.Now().Add(time.Minute), time.Now().Add(time.Hour)); len(got) != 0 {
+		t.Errorf("s.Incidents(%s) in the future = %+v, want none.", keyFirst, got)
+	}
+	stats, err := s.Stats(keyFirst, time.Now().Add(-10*time.Minute), time.Now())
+	if err != nil || stats.Reliability.IncidentsCount != 1 || stats.Reliability.Mttr < 0 || stats.Reliability.Mtbf <= 0 {
+		t.Errorf("s.Stats(%s).Reliability = %+v, %v, want one incident.", keyFirst, stats.Reliability, err)
+	}
+}
+
+// Incidents and their notes kept on disk must survive a restart of the store, the ongoing one is resolved.
+func TestIncidentsWithDiskStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s, err := safe_store.NewWithStorage(st, safe_store.DefaultRetention())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusNotFound, time.Second, 0))
+	for i := 0; i < 4; i++ {
+		s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	}
+	resolved := s.Incidents(keyFirst, time.Now().Add(-time.Hour), time.Now())
+	if len(resolved) != 1 {
+		t.Fatalf("s.Incidents(%s) = %+v, want one incident.", keyFirst, resolved)
+	}
+	s.AddIncidentNote(keyFirst, resolved[0].Start, types.IncidentNote{Timestamp: time.Now(), Text: "Database failover"})
+	for i := 0; i < 10; i++ {
+		s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusNotFound, time.Second, 0))
+	}
+	s.Close()
+
+	st, err = storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s, err = safe_store.NewWithStorage(st, safe_store.DefaultRetention())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer s.Close()
+	got := s.Incidents(keyFirst, time.Now().Add(-time.Hour), time.Now())
+	if len(got) != 2 || len(got[0].Notes) != 1 || got[0].Notes[0].Text != "Database failover" {
+		t.Fatalf("s.Incidents(%s) after restart = %+v, want 2 incidents, the first one with the note.", keyFirst, got)
+	}
+	if got[1].Ongoing() || got[1].ErrorClasses[types.ErrorClassBadStatus] == 0 {
+		t.Errorf("Incident ongoing before the restart = %+v, want it resolved at its last response.", got[1])
+	}
+}
+
+// A latency far above the baseline of an instance with anomaly detection raises an anomaly alert.
+func TestAnomalyAlerts(t *testing.T) {
+	s := safe_store.New()
+	s.Register(types.Instance{Id: keyFirst, AnomalyDeviations: 3})
+	for i := 0; i < 40; i++ {
+		s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 100*time.Millisecond, 0))
+	}
+	if got := s.GetInstanceAlerts(keyFirst); len(got.Events) != 0 {
+		t.Errorf("len(s.GetInstanceAlerts(%s).Events) = %d, want 0.", keyFirst, len(got.Events))
+	}
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 2*time.Second, 0))
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, 2*time.Second, 0))
+	got := s.GetInstanceAlerts(keyFirst)
+	if len(got.Events) != 1 || !got.Events[0].Firing || got.Events[0].Kind != types.AlertKindAnomaly {
+		t.Errorf("s.GetInstanceAlerts(%s).Events = %+v, want one firing anomaly event.", keyFirst, got.Events)
+	}
+}
+
+// A content length far from its moving average raises a content alert.
+func TestContentLengthAlerts(t *testing.T) {
+	s := safe_store.New()
+	s.Register(types.Instance{Id: keyFirst, Content: types.Content{LengthDeviation: 20}})
+	for i := 0; i < 30; i++ {
+		s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 1000))
+	}
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 1100))
+	if got := s.GetInstanceAlerts(keyFirst); len(got.Events) != 0 {
+		t.Errorf("s.GetInstanceAlerts(%s).Events = %+v, want none for a 10%% deviation.", keyFirst, got.Events)
+	}
+	s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 500))
+	got := s.GetInstanceAlerts(keyFirst)
+	if len(got.Events) != 1 || !got.Events[0].Firing || got.Events[0].Kind != types.AlertKindContent {
+		t.Errorf("s.GetInstanceAlerts(%s).Events = %+v, want one firing content event.", keyFirst, got.Events)
+	}
+}
+
+// Unregistering an instance while its responses are put must not panic.
+func TestUnregisterWhilePut(t *testing.T) {
+	s := safe_store.New()
+	instance := types.Instance{Id: keyFirst, Content: types.Content{LengthDeviation: 20}}
+	s.Register(instance)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			s.Put(keyFirst, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Millisecond, 1000))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			s.Unregister(keyFirst)
+			s.Register(instance)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package safe_store
+
+import (
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/slo"
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+type burnWindows map[string]map[time.Duration]*stat.Window
+
+// updateBurnRateAlerts adds the response to the burn rate windows of a registered instance with an objective
+// then evaluates its burn rate alerts, windows with less than slo.MinResponses responses do not fire.
+// Windows are created on the instance's first response or once its objective changed, and filled with its history
+// over the longest window: after a restart the stored history is used, as far as the raw retention keeps it.
+// Locks the SafeStore's write lock then unlock it.
+func (s *SafeStore) updateBurnRateAlerts(id string, response types.Response, now time.Time) {
+	instance, ok := s.GetInstance(id)
+	if !ok || !instance.Slo.Enabled() {
+		return
+	}
+	s.RLock()
+	_, ok = s.burnWindows[id]
+	s.RUnlock()
+	var history []types.Response
+	if !ok {
+		history = s.burnHistory(id, response, now)
+	}
+	s.Lock()
+	windows, ok := s.burnWindows[id]
+	responses := []types.Response{response}
+	if !ok {
+		windows = make(map[time.Duration]*stat.Window)
+		for _, duration := range slo.Windows() {
+			windows[duration] = stat.NewWindow(duration)
+		}
+		s.burnWindows[id] = windows
+		responses = history
+	}
+	burnRates := make(map[time.Duration]float64)
+	for duration, window := range windows {
+		for _, r := range responses {
+			window.Add(r)
+		}
+		if windowStat, err := window.Stat(now); err == nil && window.Len() >= slo.MinResponses {
+			burnRates[duration] = slo.BurnRate(windowStat.Availability, instance.Slo.Target)
+		}
+	}
+	s.Unlock()
+	for _, alert := range slo.BurnRateAlerts {
+		s.appendAlertEvent(id, types.AlertEvent{
+			Timestamp: now,
+			Kind:      types.AlertKindBurnRate,
+			Name:      alert.String(),
+			Value:     burnRates[alert.Long],
+			Firing:    alert.Firing(burnRates[alert.Long], burnRates[alert.Short]),
+		})
+	}
+}
+
+// Returns the history of an instance over the longest burn rate window, ending with the response just put.
+// Falls back on the responses in memory if the history can not be read.
+// Locks the SafeStore's read lock then unlock it.
+func (s *SafeStore) burnHistory(id string, response types.Response, now time.Time) []types.Response {
+	var longest time.Duration
+	for _, duration := range slo.Windows() {
+		if duration > longest {
+			longest = duration
+		}
+	}
+	history, err := s.History(id, now.Add(-longest), now)
+	if err != nil {
+		logger.Logger.Errorf("Failed to read the history of %s, burn rates are computed from memory: %v", id, err)
+		s.RLock()
+		history = append([]types.Response(nil), s.data[id]...)
+		s.RUnlock()
+	}
+	// The response may not be persisted or be timestamped after now
+	if len(history) == 0 || history[len(history)-1].Timestamp() < response.Timestamp() {
+		history = append(history, response)
+	}
+	return history
+}
+
+// ErrorBudget computes the error budget left by an instance over its objective's window ending at now.
+// Availability over the window is computed from the rollups.
+// Returns ErrSloNotDefined if the instance is not registered with an objective,
+// stat.ErrDataSizeInvalid if there is no data in the window.
+func (s *SafeStore) ErrorBudget(id string, now time.Time) (slo.Budget, error) {
+	instance, ok := s.GetInstance(id)
+	if !ok || !instance.Slo.Enabled() {
+		return slo.Budget{}, ErrSloNotDefined
+	}
+	windowStat, err := s.Stats(id, now.Add(-instance.Slo.Window()), now)
+	if err != nil {
+		return slo.Budget{}, err
+	}
+	return slo.NewBudget(instance.Slo, windowStat), nil
+}
+
+// ErrorBudgetsAll computes the error budget of every registered instance with an objective and data.
+// Returns a map mapping each instance id with its Budget.
+func (s *SafeStore) ErrorBudgetsAll(now time.Time) map[string]slo.Budget {
+	s.RLock()
+	var ids []string
+	for id, instance := range s.instances {
+		if instance.Slo.Enabled() {
+			ids = append(ids, id)
+		}
+	}
+	s.RUnlock()
+
+	mapAllBudgets := make(map[string]slo.Budget)
+	for _, id := range ids {
+		budget, err := s.ErrorBudget(id, now)
+		if err != nil {
+			if err != stat.ErrDataSizeInvalid {
+				logger.Logger.Errorf("Could not compute the error budget of %s: %v", id, err)
+			}
+			continue
+		}
+		mapAllBudgets[id] = budget
+	}
+	return mapAllBudgets
+}
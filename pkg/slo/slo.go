@@ -0,0 +1,99 @@
+// Package slo tracks the service level objectives of instances: error budgets and burn rates.
+package slo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const (
+	PKG = "slo"
+	// Burn rates are evaluated over windows having at least this many responses, a failure out of two is not a burn.
+	MinResponses = 10
+)
+
+// BurnRateAlert fires when the error budget is consumed at least Factor times faster than the objective allows
+// over both the Long and the Short window, the short window resolves the alert quickly once the burn stops.
+type BurnRateAlert struct {
+	Long   time.Duration
+	Short  time.Duration
+	Factor float64
+}
+
+// BurnRateAlerts are the multi-window multi-burn-rate alerts evaluated for every instance with an objective,
+// they fire when 2% of a 30 days budget is consumed in an hour or 5% in six hours.
+var BurnRateAlerts = []BurnRateAlert{
+	{Long: time.Hour, Short: 5 * time.Minute, Factor: 14.4},
+	{Long: 6 * time.Hour, Short: 30 * time.Minute, Factor: 6},
+}
+
+// String returns the alert's name, e.g. burn rate 14.4x over 1h/5m.
+func (alert BurnRateAlert) String() string {
+	return fmt.Sprintf("burn rate %gx over %s/%s", alert.Factor, formatDuration(alert.Long), formatDuration(alert.Short))
+}
+
+// Firing tells whether the burn rates over the long and short windows both reach the alert's factor.
+func (alert BurnRateAlert) Firing(long, short float64) bool {
+	return long >= alert.Factor && short >= alert.Factor
+}
+
+// Windows returns the sorted durations burn rates are computed over.
+func Windows() []time.Duration {
+	seen := make(map[time.Duration]bool)
+	var windows []time.Duration
+	for _, alert := range BurnRateAlerts {
+		for _, window := range []time.Duration{alert.Long, alert.Short} {
+			if !seen[window] {
+				seen[window] = true
+				windows = append(windows, window)
+			}
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+	return windows
+}
+
+// BurnRate returns how many times faster than the target allows the error budget is consumed at availability.
+// Both are percentages, a burn rate of 1 consumes the whole budget exactly over the objective's window.
+func BurnRate(availability, target float64) float64 {
+	return (100 - availability) / (100 - target)
+}
+
+// Budget is the state of an instance's error budget over the objective's window.
+type Budget struct {
+	Target       float64
+	Window       time.Duration
+	Availability float64
+	Remaining    float64 // Fraction of the budget left, negative once overspent
+}
+
+// NewBudget computes the error budget left by the stats of the objective's window.
+func NewBudget(slo types.Slo, s stat.Stat) Budget {
+	return Budget{
+		Target:       slo.Target,
+		Window:       slo.Window(),
+		Availability: s.Availability,
+		Remaining:    1 - BurnRate(s.Availability, slo.Target),
+	}
+}
+
+// Exhausted tells whether the whole error budget has been consumed.
+func (budget Budget) Exhausted() bool {
+	return budget.Remaining <= 0
+}
+
+// Formats a duration without its zero units, e.g. 1h rather than 1h0m0s.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
@@ -0,0 +1,59 @@
+package slo_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/slo"
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const float64EqualityThreshold = 1e-9
+
+func TestBudget(t *testing.T) {
+	objective := types.Slo{Target: 99.9, WindowDays: 30}
+	tests := []struct {
+		availability float64
+		remaining    float64
+		exhausted    bool
+	}{
+		{100, 1, false},
+		{99.95, 0.5, false},
+		{99.9, 0, true},
+		{99.8, -1, true},
+	}
+	for _, test := range tests {
+		got := slo.NewBudget(objective, stat.Stat{Availability: test.availability})
+		if math.Abs(got.Remaining-test.remaining) > float64EqualityThreshold || got.Exhausted() != test.exhausted || got.Window != 30*24*time.Hour {
+			t.Errorf("slo.NewBudget(%v, %.2f%%) = %+v, exhausted %t; want %f remaining, exhausted %t",
+				objective, test.availability, got, got.Exhausted(), test.remaining, test.exhausted)
+		}
+	}
+}
+
+func TestBurnRateAlerts(t *testing.T) {
+	fast := slo.BurnRateAlerts[0]
+	if got := fast.String(); got != "burn rate 14.4x over 1h/5m" {
+		t.Errorf("fast.String() = %s; want burn rate 14.4x over 1h/5m", got)
+	}
+	// 99.9% objective: 2% of failures burns the budget 20 times too fast
+	burnRate := slo.BurnRate(98, 99.9)
+	if math.Abs(burnRate-20) > float64EqualityThreshold {
+		t.Errorf("slo.BurnRate(98, 99.9) = %f; want 20", burnRate)
+	}
+	if !fast.Firing(burnRate, burnRate) || fast.Firing(burnRate, 0) {
+		t.Errorf("fast.Firing() must need both windows to reach %g", fast.Factor)
+	}
+	want := []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+	got := slo.Windows()
+	if len(got) != len(want) {
+		t.Fatalf("slo.Windows() = %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("slo.Windows() = %v; want %v", got, want)
+		}
+	}
+}
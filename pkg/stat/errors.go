@@ -5,4 +5,7 @@ import "errors"
 var (
 	// ErrDataSizeInvalid is returned data size is not valid to run stats on it.
 	ErrDataSizeInvalid = errors.New(`Data size is invalid`)
+
+	// ErrMetricNotValid is returned when a metric name is not known.
+	ErrMetricNotValid = errors.New(`Metric is not valid`)
 )
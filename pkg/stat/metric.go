@@ -0,0 +1,52 @@
+package stat
+
+import "sort"
+
+// Names of the metrics of a Stat usable in alert rules.
+const (
+	MetricAvailability  = "availability"
+	MetricApdex         = "apdex"
+	MetricFailuresCount = "failures_count"
+	MetricAvgRt         = "avg_rt"
+	MetricMinRt         = "min_rt"
+	MetricMaxRt         = "max_rt"
+	MetricP50Rt         = "p50_rt"
+	MetricP90Rt         = "p90_rt"
+	MetricP95Rt         = "p95_rt"
+	MetricP99Rt         = "p99_rt"
+	MetricStdDevRt      = "stddev_rt"
+)
+
+var metrics = map[string]func(s Stat) float64{
+	MetricAvailability:  func(s Stat) float64 { return s.Availability },
+	MetricApdex:         func(s Stat) float64 { return s.Apdex },
+	MetricFailuresCount: func(s Stat) float64 { return float64(s.FailuresCount) },
+	MetricAvgRt:         func(s Stat) float64 { return s.AvgRt },
+	MetricMinRt:         func(s Stat) float64 { return s.MinRt },
+	MetricMaxRt:         func(s Stat) float64 { return s.MaxRt },
+	MetricP50Rt:         func(s Stat) float64 { return s.P50Rt },
+	MetricP90Rt:         func(s Stat) float64 { return s.P90Rt },
+	MetricP95Rt:         func(s Stat) float64 { return s.P95Rt },
+	MetricP99Rt:         func(s Stat) float64 { return s.P99Rt },
+	MetricStdDevRt:      func(s Stat) float64 { return s.StdDevRt },
+}
+
+// Metrics returns the sorted names of the metrics usable in alert rules.
+func Metrics() []string {
+	var names []string
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Metric returns the value of a metric by its name, response times are in seconds.
+// Returns ErrMetricNotValid if the name is not one of Metrics().
+func (s Stat) Metric(name string) (float64, error) {
+	metric, ok := metrics[name]
+	if !ok {
+		return 0, ErrMetricNotValid
+	}
+	return metric(s), nil
+}
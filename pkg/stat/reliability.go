@@ -0,0 +1,48 @@
+package stat
+
+import (
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+// Reliability sums up the incidents of an instance over a window [from, to].
+// Mttr and Mtbf are in seconds like response times, -1 when there is no incident to compute them from.
+type Reliability struct {
+	IncidentsCount int
+	Mttr           float64 // Mean time to recover: mean duration of the incidents resolved in the window
+	Mtbf           float64 // Mean time between failures: time up in the window divided by the incidents count
+}
+
+// NewReliability computes the reliability of an instance from its incidents sorted by start.
+// Incidents overlapping the window are counted, their durations are clipped to the window.
+func NewReliability(incidents []types.Incident, from, to time.Time) Reliability {
+	r := Reliability{Mttr: -1, Mtbf: -1}
+	var down, recovering time.Duration
+	resolved := 0
+	for _, incident := range incidents {
+		if incident.Start.After(to) || (!incident.Ongoing() && incident.End.Before(from)) {
+			continue // Out of the window
+		}
+		start, end := incident.Start, incident.End
+		if start.Before(from) {
+			start = from
+		}
+		if incident.Ongoing() || end.After(to) {
+			end = to
+		}
+		r.IncidentsCount++
+		down += end.Sub(start)
+		if !incident.Ongoing() && !incident.End.After(to) {
+			resolved++
+			recovering += end.Sub(start)
+		}
+	}
+	if resolved > 0 {
+		r.Mttr = (recovering / time.Duration(resolved)).Seconds()
+	}
+	if r.IncidentsCount > 0 {
+		r.Mtbf = ((to.Sub(from) - down) / time.Duration(r.IncidentsCount)).Seconds()
+	}
+	return r
+}
@@ -0,0 +1,29 @@
+package stat_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+func TestNewReliability(t *testing.T) {
+	from := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	incidents := []types.Incident{
+		{Start: from.Add(-time.Hour), End: from.Add(-30 * time.Minute)},     // Before the window
+		{Start: from.Add(-5 * time.Minute), End: from.Add(5 * time.Minute)}, // Clipped to 5 minutes
+		{Start: from.Add(20 * time.Minute), End: from.Add(30 * time.Minute)},
+		{Start: from.Add(50 * time.Minute)}, // Ongoing, 10 minutes in the window
+	}
+	got := stat.NewReliability(incidents, from, to)
+	// 25 minutes down, 35 minutes up between 3 incidents, 2 of them resolved in 7m30s on average
+	want := stat.Reliability{IncidentsCount: 3, Mttr: (7*time.Minute + 30*time.Second).Seconds(), Mtbf: (35 * time.Minute / 3).Seconds()}
+	if got != want {
+		t.Errorf("stat.NewReliability() = %+v; want %+v", got, want)
+	}
+	if got := stat.NewReliability(nil, from, to); got.IncidentsCount != 0 || got.Mttr != -1 || got.Mtbf != -1 {
+		t.Errorf("stat.NewReliability() without incidents = %+v; want no incident, -1 mttr and mtbf", got)
+	}
+}
@@ -3,23 +3,41 @@ package stat
 import (
 	"math"
 
+	"github.com/Dainerx/wpam/pkg/latency"
+	"github.com/Dainerx/wpam/pkg/rollup"
 	"github.com/Dainerx/wpam/pkg/types"
 )
 
 type Stat struct {
 	LastStatus    string
 	Availability  float64
+	Apdex         float64 // Between 0 (all frustrated) and 1 (all satisfied)
 	FailuresCount int
 	MaxRt         float64
 	MinRt         float64
 	SumRt         float64
 	AvgRt         float64
+	P50Rt         float64
+	P90Rt         float64
+	P95Rt         float64
+	P99Rt         float64
+	StdDevRt      float64
+	Histogram     []latency.HistogramBucket
+	StatusCodes   map[int]int    // Responses count per http status code, -1 when the request failed
+	ErrorClasses  map[string]int // Failed responses count per error class
 	ContentLength int64
+	Reliability   Reliability // Set by the store from the instance's incidents
 }
 
-// Create a new stat and returns it.
+// Create a new stat and returns it, Apdex is computed against the default target time.
 // Returns error not nil if failed to compute one of the stats.
 func NewStat(responses []types.Response) (Stat, error) {
+	return NewStatWithApdexT(responses, types.DefaultApdexT)
+}
+
+// Create a new stat computing Apdex against the target time apdexT in seconds and returns it.
+// Returns error not nil if failed to compute one of the stats.
+func NewStatWithApdexT(responses []types.Response, apdexT float64) (Stat, error) {
 	s := Stat{}
 	s.LastStatus = types.Unkown
 	err := s.statMaxMinAvgResponsesTime(responses)
@@ -30,6 +48,18 @@ func NewStat(responses []types.Response) (Stat, error) {
 	if err != nil {
 		return s, err
 	}
+	err = s.statApdex(responses, apdexT)
+	if err != nil {
+		return s, err
+	}
+	err = s.statDistributionResponsesTime(responses)
+	if err != nil {
+		return s, err
+	}
+	err = s.statCodesAndErrorClasses(responses)
+	if err != nil {
+		return s, err
+	}
 	err = s.statContentLength(responses)
 	if err != nil {
 		return s, err
@@ -62,6 +92,40 @@ func (s *Stat) statMaxMinAvgResponsesTime(responses []types.Response) error {
 	}
 }
 
+// Computes the website's response time percentiles, standard deviation and histogram.
+// Percentiles are estimated by a sketch the same way windows and rollups do.
+// Returns error if failed to compute.
+func (s *Stat) statDistributionResponsesTime(responses []types.Response) error {
+	if len(responses) > 0 {
+		sketch, histogram := latency.Sketch{}, latency.NewHistogram()
+		var sum, sumSq float64 = 0, 0
+		for _, response := range responses {
+			rt := response.ResponseTime().Seconds()
+			sketch.Add(rt)
+			histogram.Add(rt)
+			sum += rt
+			sumSq += rt * rt
+		}
+		s.setDistribution(sketch, histogram, len(responses), sum, sumSq)
+		return nil
+	} else {
+		s.P50Rt, s.P90Rt, s.P95Rt, s.P99Rt, s.StdDevRt = -1, -1, -1, -1, -1
+		return ErrDataSizeInvalid
+	}
+}
+
+// Sets the percentiles, standard deviation and histogram from aggregated response times.
+// Percentiles are clamped to the exact min and max response times.
+func (s *Stat) setDistribution(sketch latency.Sketch, histogram latency.Histogram, count int, sum, sumSq float64) {
+	clamp := func(v float64) float64 {
+		return math.Min(math.Max(v, s.MinRt), s.MaxRt)
+	}
+	s.P50Rt, s.P90Rt = clamp(sketch.Quantile(0.5)), clamp(sketch.Quantile(0.9))
+	s.P95Rt, s.P99Rt = clamp(sketch.Quantile(0.95)), clamp(sketch.Quantile(0.99))
+	s.StdDevRt = latency.StdDev(count, sum, sumSq)
+	s.Histogram = histogram.Buckets()
+}
+
 // Computes the website's availability as percentage and failures count
 // Returns error if failed to compute.
 func (s *Stat) statAvailability(responses []types.Response) error {
@@ -80,6 +144,44 @@ func (s *Stat) statAvailability(responses []types.Response) error {
 	}
 }
 
+// Computes the website's Apdex score against the target time apdexT in seconds.
+// Returns error if failed to compute.
+func (s *Stat) statApdex(responses []types.Response, apdexT float64) error {
+	if len(responses) > 0 {
+		satisfied, tolerating := 0, 0
+		for _, response := range responses {
+			switch latency.ApdexZone(response.ResponseTime().Seconds(), response.Status() == types.Up, apdexT) {
+			case latency.ApdexSatisfied:
+				satisfied++
+			case latency.ApdexTolerating:
+				tolerating++
+			}
+		}
+		s.Apdex = latency.Apdex(satisfied, tolerating, len(responses))
+		return nil
+	} else {
+		s.Apdex = -1
+		return ErrDataSizeInvalid
+	}
+}
+
+// Counts the responses per http status code and the failed ones per error class.
+// Returns error if failed to compute.
+func (s *Stat) statCodesAndErrorClasses(responses []types.Response) error {
+	if len(responses) > 0 {
+		s.StatusCodes, s.ErrorClasses = map[int]int{}, map[string]int{}
+		for _, response := range responses {
+			s.StatusCodes[response.HttpStatusCode()]++
+			if errorClass := response.ErrorClass(); errorClass != "" {
+				s.ErrorClasses[errorClass]++
+			}
+		}
+		return nil
+	} else {
+		return ErrDataSizeInvalid
+	}
+}
+
 // Compute content length of the response (given in header)
 // Returns error if failed to compute.
 func (s *Stat) statContentLength(responses []types.Response) error {
@@ -92,3 +194,53 @@ func (s *Stat) statContentLength(responses []types.Response) error {
 		return ErrDataSizeInvalid
 	}
 }
+
+// Create a new stat from rollup buckets sorted by start and returns it.
+// Apdex is computed against the target time the buckets were aggregated with.
+// Used for long windows where raw responses are not kept, response times are aggregated the same way.
+// Returns error not nil if buckets hold no response.
+func NewStatFromBuckets(buckets []rollup.Bucket) (Stat, error) {
+	s := Stat{}
+	s.LastStatus = types.Unkown
+	count, upCount, satisfied, tolerating := 0, 0, 0, 0
+	sketch, histogram := latency.Sketch{}, latency.NewHistogram()
+	var sum, sumSq float64 = 0, 0
+	var min float64 = math.MaxFloat64
+	var max float64 = -1
+	statusCodes, errorClasses := map[int]int{}, map[string]int{}
+	for _, bucket := range buckets {
+		if bucket.Count == 0 {
+			continue
+		}
+		for code, n := range bucket.StatusCodes {
+			statusCodes[code] += n
+		}
+		for errorClass, n := range bucket.ErrorClasses {
+			errorClasses[errorClass] += n
+		}
+		count += bucket.Count
+		upCount += bucket.UpCount
+		satisfied += bucket.Satisfied
+		tolerating += bucket.Tolerating
+		sum += bucket.SumRt
+		sumSq += bucket.SumSqRt
+		sketch.Merge(bucket.Latencies)
+		histogram.Merge(bucket.Histogram)
+		min = math.Min(min, bucket.MinRt)
+		max = math.Max(max, bucket.MaxRt)
+		s.LastStatus, s.ContentLength = bucket.LastStatus, bucket.ContentLength
+	}
+	if count == 0 {
+		s.MaxRt, s.MinRt, s.AvgRt = -1, -1, -1
+		s.P50Rt, s.P90Rt, s.P95Rt, s.P99Rt, s.StdDevRt = -1, -1, -1, -1, -1
+		s.Availability, s.Apdex, s.FailuresCount = -1, -1, -1
+		s.ContentLength = -1
+		return s, ErrDataSizeInvalid
+	}
+	s.MaxRt, s.MinRt, s.SumRt, s.AvgRt = max, min, sum, sum/float64(count)
+	s.Apdex = latency.Apdex(satisfied, tolerating, count)
+	s.setDistribution(sketch, histogram, count, sum, sumSq)
+	s.Availability, s.FailuresCount = (float64(upCount)/float64(count))*100, count-upCount
+	s.StatusCodes, s.ErrorClasses = statusCodes, errorClasses
+	return s, nil
+}
@@ -0,0 +1,233 @@
+package stat
+
+import (
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/latency"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+// sample is what a Window keeps of a response.
+type sample struct {
+	seq        uint64 // Identifies the sample in the min/max deques
+	ts         int64
+	rt         float64
+	up         bool
+	apdexZone  int
+	code       int
+	errorClass string
+}
+
+// ring is a growable ring buffer of samples used as a double ended queue.
+type ring struct {
+	buf  []sample
+	head int
+	size int
+}
+
+func (r *ring) len() int {
+	return r.size
+}
+
+func (r *ring) at(i int) sample {
+	return r.buf[(r.head+i)%len(r.buf)]
+}
+
+func (r *ring) front() sample {
+	return r.at(0)
+}
+
+func (r *ring) back() sample {
+	return r.at(r.size - 1)
+}
+
+// Doubles the capacity when full, amortized O(1).
+func (r *ring) pushBack(s sample) {
+	if r.size == len(r.buf) {
+		grown := make([]sample, 2*len(r.buf)+1)
+		for i := 0; i < r.size; i++ {
+			grown[i] = r.at(i)
+		}
+		r.buf, r.head = grown, 0
+	}
+	r.buf[(r.head+r.size)%len(r.buf)] = s
+	r.size++
+}
+
+func (r *ring) popFront() sample {
+	s := r.front()
+	r.head = (r.head + 1) % len(r.buf)
+	r.size--
+	return s
+}
+
+func (r *ring) popBack() sample {
+	s := r.back()
+	r.size--
+	return s
+}
+
+// Window keeps the stats of the responses of the last duration.
+// Stats are updated in O(1) amortized per response instead of being recomputed over the whole window:
+// sums, counts, the latency sketch and histogram are updated on add and eviction,
+// min/max are kept by monotonic deques.
+// A Window is not safe for concurrent use.
+type Window struct {
+	duration     time.Duration
+	samples      ring
+	minRts       ring // Increasing response times, front is the min of the window
+	maxRts       ring // Decreasing response times, front is the max of the window
+	seq          uint64
+	upCount      int
+	apdexT       float64
+	satisfied    int
+	tolerating   int
+	sumRt        float64
+	sumSqRt      float64
+	sketch       latency.Sketch
+	histogram    latency.Histogram
+	statusCodes  map[int]int
+	errorClasses map[string]int
+	last         types.Response
+}
+
+// NewWindow creates an empty window over the given duration, Apdex is computed against the default target time.
+func NewWindow(duration time.Duration) *Window {
+	return NewWindowWithApdexT(duration, types.DefaultApdexT)
+}
+
+// NewWindowWithApdexT creates an empty window over the given duration computing Apdex against apdexT in seconds.
+func NewWindowWithApdexT(duration time.Duration, apdexT float64) *Window {
+	return &Window{
+		duration:     duration,
+		apdexT:       apdexT,
+		sketch:       latency.Sketch{},
+		histogram:    latency.NewHistogram(),
+		statusCodes:  map[int]int{},
+		errorClasses: map[string]int{},
+	}
+}
+
+// Add adds a response to the window and evicts the responses out of the window.
+// Responses must be added in timestamp order.
+func (w *Window) Add(response types.Response) {
+	s := sample{
+		seq:        w.seq,
+		ts:         response.Timestamp(),
+		rt:         response.ResponseTime().Seconds(),
+		up:         response.Status() == types.Up,
+		code:       response.HttpStatusCode(),
+		errorClass: response.ErrorClass(),
+	}
+	s.apdexZone = latency.ApdexZone(s.rt, s.up, w.apdexT)
+	w.seq++
+	w.samples.pushBack(s)
+	if s.up {
+		w.upCount++
+	}
+	w.countApdexZone(s.apdexZone, 1)
+	w.sumRt += s.rt
+	w.sumSqRt += s.rt * s.rt
+	w.sketch.Add(s.rt)
+	w.histogram.Add(s.rt)
+	w.statusCodes[s.code]++
+	if s.errorClass != "" {
+		w.errorClasses[s.errorClass]++
+	}
+	for w.minRts.len() > 0 && w.minRts.back().rt >= s.rt {
+		w.minRts.popBack()
+	}
+	w.minRts.pushBack(s)
+	for w.maxRts.len() > 0 && w.maxRts.back().rt <= s.rt {
+		w.maxRts.popBack()
+	}
+	w.maxRts.pushBack(s)
+	w.last = response
+	w.evict(time.Unix(0, s.ts))
+}
+
+// Drops the samples dating before now minus the window's duration.
+func (w *Window) evict(now time.Time) {
+	start := now.Add(-w.duration).UnixNano()
+	for w.samples.len() > 0 && w.samples.front().ts < start {
+		s := w.samples.popFront()
+		if s.up {
+			w.upCount--
+		}
+		w.countApdexZone(s.apdexZone, -1)
+		w.sumRt -= s.rt
+		w.sumSqRt -= s.rt * s.rt
+		w.sketch.Remove(s.rt)
+		w.histogram.Remove(s.rt)
+		// Drop zero counts so that the window's maps only hold what it has seen
+		if w.statusCodes[s.code]--; w.statusCodes[s.code] == 0 {
+			delete(w.statusCodes, s.code)
+		}
+		if s.errorClass != "" {
+			if w.errorClasses[s.errorClass]--; w.errorClasses[s.errorClass] == 0 {
+				delete(w.errorClasses, s.errorClass)
+			}
+		}
+		if w.minRts.len() > 0 && w.minRts.front().seq == s.seq {
+			w.minRts.popFront()
+		}
+		if w.maxRts.len() > 0 && w.maxRts.front().seq == s.seq {
+			w.maxRts.popFront()
+		}
+	}
+	if w.samples.len() == 0 {
+		w.sumRt, w.sumSqRt = 0, 0 // Avoid accumulating float errors on an empty window
+	}
+}
+
+// Adds delta to the count of the Apdex zone, frustrated responses are not counted.
+func (w *Window) countApdexZone(zone int, delta int) {
+	switch zone {
+	case latency.ApdexSatisfied:
+		w.satisfied += delta
+	case latency.ApdexTolerating:
+		w.tolerating += delta
+	}
+}
+
+// ApdexT returns the Apdex target time in seconds the window computes Apdex against.
+func (w *Window) ApdexT() float64 {
+	return w.apdexT
+}
+
+// Len returns the number of responses in the window.
+func (w *Window) Len() int {
+	return w.samples.len()
+}
+
+// Stat evicts the responses out of the window at now and returns the stats of the remaining ones.
+// Returns ErrDataSizeInvalid if the window is empty, like NewStat.
+func (w *Window) Stat(now time.Time) (Stat, error) {
+	w.evict(now)
+	s := Stat{}
+	s.LastStatus = types.Unkown
+	count := w.samples.len()
+	if count == 0 {
+		s.MaxRt, s.MinRt, s.AvgRt = -1, -1, -1
+		s.P50Rt, s.P90Rt, s.P95Rt, s.P99Rt, s.StdDevRt = -1, -1, -1, -1, -1
+		s.Availability, s.Apdex, s.FailuresCount = -1, -1, -1
+		s.ContentLength = -1
+		return s, ErrDataSizeInvalid
+	}
+	s.MaxRt, s.MinRt = w.maxRts.front().rt, w.minRts.front().rt
+	s.SumRt, s.AvgRt = w.sumRt, w.sumRt/float64(count)
+	s.setDistribution(w.sketch, w.histogram, count, w.sumRt, w.sumSqRt)
+	s.Availability, s.FailuresCount = (float64(w.upCount)/float64(count))*100, count-w.upCount
+	s.Apdex = latency.Apdex(w.satisfied, w.tolerating, count)
+	// Copied since the stat outlives the window's next updates
+	s.StatusCodes, s.ErrorClasses = make(map[int]int, len(w.statusCodes)), make(map[string]int, len(w.errorClasses))
+	for code, n := range w.statusCodes {
+		s.StatusCodes[code] = n
+	}
+	for errorClass, n := range w.errorClasses {
+		s.ErrorClasses[errorClass] = n
+	}
+	s.ContentLength = w.last.ContentLength()
+	s.LastStatus = w.last.Status()
+	return s, nil
+}
@@ -0,0 +1,90 @@
+package stat_test
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/stat"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+const checkInterval = 10 * time.Second
+
+// Generates n responses one check interval apart, ending now.
+func feedRandomResponses(n int) []types.Response {
+	rand.Seed(42)
+	now := time.Now()
+	var responses []types.Response
+	for i := 0; i < n; i++ {
+		code := http.StatusOK
+		if rand.Intn(5) == 0 {
+			code = http.StatusInternalServerError
+		}
+		responseTime := time.Duration(rand.Intn(3000)) * time.Millisecond
+		responses = append(responses, *website_check.NewCheckResponseAt(now.Add(-time.Duration(n-1-i)*checkInterval), []int{http.StatusOK}, code, responseTime, 0))
+	}
+	return responses
+}
+
+// The window must compute the same stats as NewStat over the responses of the window.
+func TestWindowMatchesNewStat(t *testing.T) {
+	responses := feedRandomResponses(1000)
+	window := stat.NewWindow(10 * time.Minute)
+	for i, r := range responses {
+		window.Add(r)
+		now := time.Unix(0, r.Timestamp())
+		// Responses of the last 10 minutes, the way the store used to compute them
+		start := i
+		for start > 0 && responses[start-1].Timestamp() >= now.Add(-10*time.Minute).UnixNano() {
+			start--
+		}
+		want, err := stat.NewStat(responses[start : i+1])
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		got, err := window.Stat(now)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if got.Availability != want.Availability || got.Apdex != want.Apdex || got.FailuresCount != want.FailuresCount ||
+			got.MaxRt != want.MaxRt || got.MinRt != want.MinRt || math.Abs(got.AvgRt-want.AvgRt) > float64EqualityThreshold ||
+			got.P50Rt != want.P50Rt || got.P95Rt != want.P95Rt || got.P99Rt != want.P99Rt ||
+			math.Abs(got.StdDevRt-want.StdDevRt) > float64EqualityThreshold || got.LastStatus != want.LastStatus ||
+			!reflect.DeepEqual(got.StatusCodes, want.StatusCodes) || !reflect.DeepEqual(got.ErrorClasses, want.ErrorClasses) {
+			t.Fatalf("window.Stat() after %d responses = %+v; want %+v", i+1, got, want)
+		}
+	}
+	// Nothing left once the window has elapsed
+	if _, err := window.Stat(time.Now().Add(time.Hour)); err != stat.ErrDataSizeInvalid {
+		t.Errorf("window.Stat() of an elapsed window = %v; want %v", err, stat.ErrDataSizeInvalid)
+	}
+}
+
+// Recomputing the stats of one hour of responses on every new response, as the store used to do.
+func BenchmarkRecomputeOneHour(b *testing.B) {
+	responses := feedRandomResponses(int(time.Hour/checkInterval) + b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = stat.NewStat(responses[i : i+int(time.Hour/checkInterval)])
+	}
+}
+
+// Updating a one hour window on every new response.
+func BenchmarkWindowOneHour(b *testing.B) {
+	responses := feedRandomResponses(int(time.Hour/checkInterval) + b.N)
+	window := stat.NewWindow(time.Hour)
+	for _, r := range responses[:int(time.Hour/checkInterval)] {
+		window.Add(r)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := responses[i+int(time.Hour/checkInterval)]
+		window.Add(r)
+		_, _ = window.Stat(time.Unix(0, r.Timestamp()))
+	}
+}
@@ -0,0 +1,253 @@
+// Package status_page renders a status page of the instances: their current state, 90 days of uptime and recent incidents.
+// The page is server-rendered HTML without external assets nor scripts.
+package status_page
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/rollup"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const (
+	PKG = "status_page"
+	// Days of uptime shown per instance, computed from the day rollups.
+	Days = 90
+	// Incidents shown are the last ones started in this window.
+	recentIncidentsWindow = 30 * rollup.Day
+	maxRecentIncidents    = 20
+	dateFormat            = "2006-01-02"
+	timeFormat            = "02 Jan 2006 15:04 MST"
+)
+
+// States of an instance, a group or the whole page from the best to the worst.
+const (
+	StateOperational = "operational"
+	StatePaused      = "paused"
+	StateUnknown     = "unknown"
+	StateDegraded    = "degraded"
+	StateDown        = "down"
+)
+
+var (
+	severities = map[string]int{StateOperational: 0, StatePaused: 0, StateUnknown: 1, StateDegraded: 2, StateDown: 3}
+	labels     = map[string]string{
+		StateOperational: "Operational",
+		StatePaused:      "Paused",
+		StateUnknown:     "No data",
+		StateDegraded:    "Degraded",
+		StateDown:        "Down",
+	}
+	summaries = map[string]string{
+		StateOperational: "All systems operational",
+		StateUnknown:     "Waiting for the first checks",
+		StateDegraded:    "Some systems are degraded",
+		StateDown:        "Some systems are down",
+	}
+	page = template.Must(template.New(PKG).Parse(pageTemplate))
+)
+
+// StatusPage serves the status page of the instances registered in the store.
+type StatusPage struct {
+	store *safe_store.SafeStore
+}
+
+// New creates a status page reading from the store.
+func New(store *safe_store.SafeStore) *StatusPage {
+	return &StatusPage{store: store}
+}
+
+// ServeHTTP renders the status page, it is computed on every request.
+func (p *StatusPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := page.Execute(w, p.Page(time.Now())); err != nil {
+		logger.Logger.Errorf("Failed to render the status page: %v", err)
+	}
+}
+
+// Page is the content of the status page.
+type Page struct {
+	State     string
+	Summary   string
+	Generated string
+	Groups    []Group
+	Incidents []Incident
+	Days      int
+}
+
+// Group is a group of instances, instances without group are in a group without name.
+type Group struct {
+	Name      string
+	State     string
+	Label     string
+	Instances []Instance
+}
+
+// Instance is the current state of an instance and its uptime per day, the oldest day first.
+type Instance struct {
+	Id     string
+	State  string
+	Label  string
+	Uptime string
+	Days   []Day
+}
+
+// Day is the uptime of an instance for a day, State is unknown without data.
+type Day struct {
+	State string
+	Title string
+}
+
+// Incident is an incident of an instance, most recent first.
+type Incident struct {
+	Id       string
+	Group    string
+	Start    string
+	End      string // Empty while ongoing
+	Duration string
+	Notes    []Note
+	start    time.Time
+}
+
+// Note is an operator's note on an incident.
+type Note struct {
+	Time string
+	Text string
+}
+
+// Page computes the content of the status page at now.
+func (p *StatusPage) Page(now time.Time) Page {
+	instances := p.store.GetAllInstances()
+	mapAllAlerts := p.store.GetAllAlerts()
+	content := Page{State: StateOperational, Generated: now.Format(timeFormat), Days: Days}
+	groups := make(map[string]*Group)
+	for id, instance := range instances {
+		state := p.state(instance, mapAllAlerts[id])
+		view := Instance{Id: id, State: state, Label: labels[state]}
+		view.Uptime, view.Days = p.days(id, now)
+		group, ok := groups[instance.Group]
+		if !ok {
+			group = &Group{Name: instance.Group, State: StateOperational}
+			groups[instance.Group] = group
+		}
+		group.Instances = append(group.Instances, view)
+		group.State = worst(group.State, state)
+		content.State = worst(content.State, state)
+		for _, incident := range p.store.Incidents(id, now.Add(-recentIncidentsWindow), now) {
+			content.Incidents = append(content.Incidents, newIncident(id, instance.Group, incident, now))
+		}
+	}
+	for _, group := range groups {
+		group.Label = labels[group.State]
+		sort.Slice(group.Instances, func(i, j int) bool { return group.Instances[i].Id < group.Instances[j].Id })
+		content.Groups = append(content.Groups, *group)
+	}
+	// Instances without group first
+	sort.Slice(content.Groups, func(i, j int) bool { return content.Groups[i].Name < content.Groups[j].Name })
+	sort.SliceStable(content.Incidents, func(i, j int) bool { return content.Incidents[i].start.After(content.Incidents[j].start) })
+	if len(content.Incidents) > maxRecentIncidents {
+		content.Incidents = content.Incidents[:maxRecentIncidents]
+	}
+	content.Summary = summaries[content.State]
+	if content.Summary == "" {
+		content.Summary = summaries[StateOperational]
+	}
+	return content
+}
+
+// Returns the state of an instance from its alerts and last check.
+func (p *StatusPage) state(instance types.Instance, alerts types.Alerts) string {
+	if instance.Paused {
+		return StatePaused
+	}
+	responses := p.store.Get(instance.Id)
+	switch {
+	case len(responses) == 0:
+		return StateUnknown
+	case alerts.Down():
+		return StateDown
+	case len(alerts.Firing()) > 0 || responses[len(responses)-1].Status() != types.Up:
+		return StateDegraded
+	default:
+		return StateOperational
+	}
+}
+
+// Returns the uptime of an instance over the last days and the uptime of every day, the oldest first.
+func (p *StatusPage) days(id string, now time.Time) (string, []Day) {
+	first := now.UTC().Truncate(rollup.Day).Add(-(Days - 1) * rollup.Day)
+	buckets, err := p.store.Rollups(id, rollup.Day, first, now)
+	if err != nil {
+		logger.Logger.Errorf("Could not read the day rollups of %s: %v", id, err)
+	}
+	byDay := make(map[time.Time]rollup.Bucket)
+	for _, bucket := range buckets {
+		byDay[bucket.Start] = bucket
+	}
+	days := make([]Day, 0, Days)
+	var count, upCount int
+	for i := 0; i < Days; i++ {
+		start := first.Add(time.Duration(i) * rollup.Day)
+		bucket, ok := byDay[start]
+		if !ok || bucket.Count == 0 {
+			days = append(days, Day{State: StateUnknown, Title: start.Format(dateFormat) + ": no data"})
+			continue
+		}
+		count += bucket.Count
+		upCount += bucket.UpCount
+		availability := float64(bucket.UpCount) / float64(bucket.Count) * 100
+		days = append(days, Day{State: dayState(availability), Title: fmt.Sprintf("%s: %.2f%% uptime", start.Format(dateFormat), availability)})
+	}
+	if count == 0 {
+		return "No data", days
+	}
+	return fmt.Sprintf("%.2f%% uptime", float64(upCount)/float64(count)*100), days
+}
+
+// A day is down below the availability threshold, degraded below 99.9%.
+func dayState(availability float64) string {
+	switch {
+	case availability < types.AvaiabilityThreshold:
+		return StateDown
+	case availability < 99.9:
+		return StateDegraded
+	default:
+		return StateOperational
+	}
+}
+
+func newIncident(id, group string, incident types.Incident, now time.Time) Incident {
+	view := Incident{
+		Id:       id,
+		Group:    group,
+		Start:    incident.Start.Format(timeFormat),
+		Duration: incident.Duration(now).Round(time.Second).String(),
+		start:    incident.Start,
+	}
+	if !incident.Ongoing() {
+		view.End = incident.End.Format(timeFormat)
+	}
+	for _, note := range incident.Notes {
+		view.Notes = append(view.Notes, Note{Time: note.Timestamp.Format(timeFormat), Text: note.Text})
+	}
+	return view
+}
+
+func worst(a, b string) string {
+	if severities[b] > severities[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,73 @@
+package status_page_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/status_page"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+func TestStatusPage(t *testing.T) {
+	store := safe_store.New()
+	p := status_page.New(store)
+	store.Register(types.Instance{Id: "api", Url: "http://example.com/api", Group: "Backend"})
+	store.Register(types.Instance{Id: "db", Url: "http://example.com/db", Group: "Backend"})
+	store.Register(types.Instance{Id: "www", Url: "http://example.com"})
+	store.Register(types.Instance{Id: "old", Url: "http://example.com/old", Paused: true})
+	store.Put("api", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	store.Put("db", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusInternalServerError, time.Second, 0))
+	store.Put("www", *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, http.StatusOK, time.Second, 0))
+	incidents := store.Incidents("db", time.Now().Add(-time.Hour), time.Now())
+	if len(incidents) != 1 {
+		t.Fatalf("store.Incidents(db) = %+v; want one incident", incidents)
+	}
+	store.AddIncidentNote("db", incidents[0].Start, types.IncidentNote{Timestamp: time.Now(), Text: "<b>Failover</b>"})
+
+	page := p.Page(time.Now())
+	if page.State != status_page.StateDown {
+		t.Errorf("page.State = %s; want %s", page.State, status_page.StateDown)
+	}
+	// Instances without group first
+	if len(page.Groups) != 2 || page.Groups[0].Name != "" || page.Groups[1].Name != "Backend" {
+		t.Fatalf("page.Groups = %+v; want the instances without group then Backend", page.Groups)
+	}
+	if got := page.Groups[1]; got.State != status_page.StateDown || len(got.Instances) != 2 || got.Instances[0].State != status_page.StateOperational {
+		t.Errorf("Backend group = %+v; want down with api operational", got)
+	}
+	if got := page.Groups[0].Instances[0]; got.Id != "old" || got.State != status_page.StatePaused {
+		t.Errorf("First instance = %+v; want old paused", got)
+	}
+	www := page.Groups[0].Instances[1]
+	if len(www.Days) != status_page.Days || www.Days[status_page.Days-1].State != status_page.StateOperational || www.Days[0].State != status_page.StateUnknown {
+		t.Errorf("www days = %+v; want %d days, only today operational", www.Days, status_page.Days)
+	}
+	if www.Uptime != "100.00% uptime" {
+		t.Errorf("www uptime = %s; want 100.00%% uptime", www.Uptime)
+	}
+	if len(page.Incidents) != 1 || page.Incidents[0].Id != "db" || page.Incidents[0].End != "" || len(page.Incidents[0].Notes) != 1 {
+		t.Errorf("page.Incidents = %+v; want the ongoing incident of db with its note", page.Incidents)
+	}
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	body := rec.Body.String()
+	for _, want := range []string{"Some systems are down", "Backend", "&lt;b&gt;Failover&lt;/b&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Status page does not contain %s", want)
+		}
+	}
+	if strings.Contains(body, "<b>Failover") {
+		t.Errorf("Status page does not escape the notes")
+	}
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /status = %d; want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,70 @@
+package status_page
+
+// The page refreshes itself every minute, its style is inlined so it can be served from a private network.
+const pageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>Status</title>
+<style>
+body { margin: 0; background: #f6f7f9; color: #24292e; font: 15px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; }
+main { max-width: 860px; margin: 0 auto; padding: 24px 16px; }
+h1 { font-size: 24px; margin: 0 0 16px; }
+h2 { font-size: 18px; margin: 32px 0 8px; }
+section, .banner { background: #fff; border: 1px solid #e1e4e8; border-radius: 6px; margin-bottom: 16px; }
+.banner { padding: 16px; font-size: 18px; font-weight: 600; color: #fff; }
+.banner.operational, .banner.paused { background: #2ea44f; }
+.banner.unknown { background: #959da5; }
+.banner.degraded { background: #e3a008; }
+.banner.down { background: #d73a49; }
+.group { padding: 12px 16px; border-bottom: 1px solid #e1e4e8; font-weight: 600; display: flex; justify-content: space-between; }
+.instance { padding: 12px 16px; border-bottom: 1px solid #e1e4e8; }
+.instance:last-child { border-bottom: 0; }
+.header { display: flex; justify-content: space-between; }
+.state.operational { color: #2ea44f; }
+.state.paused, .state.unknown { color: #959da5; }
+.state.degraded { color: #b08800; }
+.state.down { color: #d73a49; }
+.bars { display: flex; gap: 2px; height: 28px; margin: 8px 0 4px; }
+.bars span { flex: 1; border-radius: 2px; }
+.bars .operational { background: #2ea44f; }
+.bars .unknown { background: #d1d5da; }
+.bars .degraded { background: #e3a008; }
+.bars .down { background: #d73a49; }
+.legend { display: flex; justify-content: space-between; color: #6a737d; font-size: 12px; }
+.incident { padding: 12px 16px; border-bottom: 1px solid #e1e4e8; }
+.incident:last-child { border-bottom: 0; }
+.incident .meta, footer { color: #6a737d; font-size: 13px; }
+.note { margin: 8px 0 0; padding-left: 12px; border-left: 3px solid #e1e4e8; }
+footer { text-align: center; }
+</style>
+</head>
+<body>
+<main>
+<h1>Status</h1>
+<div class="banner {{.State}}">{{.Summary}}</div>
+{{range .Groups}}<section>
+{{if .Name}}<div class="group"><span>{{.Name}}</span><span class="state {{.State}}">{{.Label}}</span></div>
+{{end}}{{range .Instances}}<div class="instance">
+<div class="header"><strong>{{.Id}}</strong><span class="state {{.State}}">{{.Label}}</span></div>
+<div class="bars">{{range .Days}}<span class="{{.State}}" title="{{.Title}}"></span>{{end}}</div>
+<div class="legend"><span>{{$.Days}} days ago</span><span>{{.Uptime}}</span><span>Today</span></div>
+</div>
+{{end}}</section>
+{{else}}<section><div class="instance">No instance is monitored.</div></section>
+{{end}}<h2>Recent incidents</h2>
+<section>
+{{range .Incidents}}<div class="incident">
+<strong>{{.Id}}{{if .Group}} ({{.Group}}){{end}} {{if .End}}was down{{else}}is down{{end}}</strong>
+<div class="meta">{{.Start}}{{if .End}} to {{.End}}{{else}}, ongoing{{end}}, {{.Duration}}</div>
+{{range .Notes}}<p class="note">{{.Text}} <span class="meta">{{.Time}}</span></p>
+{{end}}</div>
+{{else}}<div class="incident">No incident in the last 30 days.</div>
+{{end}}</section>
+<footer>Updated {{.Generated}}</footer>
+</main>
+</body>
+</html>
+`
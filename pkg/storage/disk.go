@@ -0,0 +1,474 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/rollup"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const (
+	segmentExt    = ".seg"
+	segmentLayout = "20060102" // One segment per instance per UTC day
+	segmentSpan   = 24 * time.Hour
+	rollupExt     = ".rollup"
+	incidentsName = "incidents.json"
+)
+
+// Disk is a Storage persisting the history in append-only segment files.
+// Every instance has its own directory holding one segment per UTC day,
+// every line of a segment is a json encoded response.
+// Pruning drops whole segments, thus the history is kept with a day granularity.
+// Rollup buckets of every resolution are appended to one file per instance,
+// those are small enough to be rewritten when pruned.
+// Incidents of an instance are rewritten as a whole in a json file whenever they change.
+type Disk struct {
+	sync.Mutex //embedded field
+	dir        string
+	segments   map[string]*os.File // Open segment per instance id
+	closed     bool
+}
+
+// NewDisk creates a disk storage under dir, the directory is created if it does not exist.
+// Returns error if dir can not be created or is not a directory.
+func NewDisk(dir string) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, ErrDirNotValid
+	}
+	return &Disk{
+		dir:      dir,
+		segments: map[string]*os.File{},
+	}, nil
+}
+
+// Ids are escaped to be used as directory names, dots are escaped too in . and .. which would be the
+// storage directory itself or its parent.
+func (d *Disk) instanceDir(id string) string {
+	name := url.PathEscape(id)
+	if name == "." || name == ".." {
+		name = strings.Replace(name, ".", "%2E", -1)
+	}
+	return filepath.Join(d.dir, name)
+}
+
+func segmentName(t time.Time) string {
+	return t.UTC().Format(segmentLayout) + segmentExt
+}
+
+// Parses a segment file name and returns the start of the day it holds.
+func segmentStart(name string) (time.Time, bool) {
+	if !strings.HasSuffix(name, segmentExt) {
+		return time.Time{}, false
+	}
+	start, err := time.Parse(segmentLayout, strings.TrimSuffix(name, segmentExt))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return start, true
+}
+
+// Lists the segments of an instance sorted from the oldest to the newest.
+func (d *Disk) listSegments(id string) ([]string, error) {
+	files, err := ioutil.ReadDir(d.instanceDir(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if _, ok := segmentStart(file.Name()); ok && !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Returns the segment the response has to be appended to, opening it if needed.
+// Must be called with the lock held.
+func (d *Disk) segment(id string, t time.Time) (*os.File, error) {
+	name := filepath.Join(d.instanceDir(id), segmentName(t))
+	if f, ok := d.segments[id]; ok {
+		if f.Name() == name {
+			return f, nil
+		}
+		// Day has changed, roll to a new segment
+		f.Close()
+		delete(d.segments, id)
+	}
+	if err := os.MkdirAll(d.instanceDir(id), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	d.segments[id] = f
+	return f, nil
+}
+
+// Append writes the response at the end of the id's current segment.
+// Locks the Disk's lock then unlock it.
+func (d *Disk) Append(id string, response types.Response) error {
+	line, err := json.Marshal(newRecord(response))
+	if err != nil {
+		return err
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	f, err := d.segment(id, time.Unix(0, response.Timestamp()))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Returns the path of the file holding the id's buckets of a resolution.
+func (d *Disk) rollupPath(id string, resolution time.Duration) string {
+	return filepath.Join(d.instanceDir(id), fmt.Sprintf("rollup-%ds%s", int64(resolution.Seconds()), rollupExt))
+}
+
+// Reads every bucket of a rollup file, a missing file has no buckets.
+func readBuckets(path string) ([]rollup.Bucket, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buckets []rollup.Bucket
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var bucket rollup.Bucket
+		if err := json.Unmarshal(scanner.Bytes(), &bucket); err != nil {
+			logger.Logger.Warnf("Skipping corrupted bucket in %s: %v", path, err)
+			continue
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, scanner.Err()
+}
+
+// AppendBucket writes the bucket at the end of the id's rollup file of the bucket's resolution.
+// Locks the Disk's lock then unlock it.
+func (d *Disk) AppendBucket(id string, bucket rollup.Bucket) error {
+	line, err := json.Marshal(bucket)
+	if err != nil {
+		return err
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	if err := os.MkdirAll(d.instanceDir(id), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(d.rollupPath(id, bucket.Resolution), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Buckets reads the id's rollup file of a resolution and returns the buckets starting between from and to.
+// Locks the Disk's lock then unlock it.
+func (d *Disk) Buckets(id string, resolution time.Duration, from, to time.Time) ([]rollup.Bucket, error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+	buckets, err := readBuckets(d.rollupPath(id, resolution))
+	if err != nil {
+		return nil, err
+	}
+	var rangeBuckets []rollup.Bucket
+	for _, bucket := range buckets {
+		if !bucket.Start.Before(from) && !bucket.Start.After(to) {
+			rangeBuckets = append(rangeBuckets, bucket)
+		}
+	}
+	return rollup.Compact(rangeBuckets), nil
+}
+
+// PruneBuckets rewrites the rollup files of a resolution without the buckets starting before the given time.
+// Locks the Disk's lock then unlock it.
+func (d *Disk) PruneBuckets(resolution time.Duration, before time.Time) error {
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		id, err := url.PathUnescape(file.Name())
+		if !file.IsDir() || err != nil {
+			continue
+		}
+		path := d.rollupPath(id, resolution)
+		buckets, err := readBuckets(path)
+		if err != nil {
+			return err
+		}
+		var kept []byte
+		pruned := 0
+		for _, bucket := range buckets {
+			if bucket.Start.Before(before) {
+				pruned++
+				continue
+			}
+			line, err := json.Marshal(bucket)
+			if err != nil {
+				return err
+			}
+			kept = append(append(kept, line...), '\n')
+		}
+		if pruned == 0 {
+			continue
+		}
+		if err := writeFileAtomic(path, kept); err != nil {
+			return err
+		}
+		logger.Logger.Infof("%d buckets were pruned from %s", pruned, path)
+	}
+	return nil
+}
+
+// Writes data to path through a temporary file, to never leave a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// SaveIncidents rewrites the id's incidents file, the file is removed if there are no incidents.
+// Locks the Disk's lock then unlock it.
+func (d *Disk) SaveIncidents(id string, incidents []types.Incident) error {
+	data, err := json.Marshal(incidents)
+	if err != nil {
+		return err
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	path := filepath.Join(d.instanceDir(id), incidentsName)
+	if len(incidents) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(d.instanceDir(id), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Incidents reads the id's incidents file, a missing file has no incidents.
+// Locks the Disk's lock then unlock it.
+func (d *Disk) Incidents(id string) ([]types.Incident, error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+	data, err := ioutil.ReadFile(filepath.Join(d.instanceDir(id), incidentsName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var incidents []types.Incident
+	if err := json.Unmarshal(data, &incidents); err != nil {
+		return nil, err
+	}
+	return incidents, nil
+}
+
+// Reads the records of a segment dating between from and to.
+func readSegment(path string, from, to time.Time) ([]types.Response, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var responses []types.Response
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A partially written line (crash while appending) is skipped
+			logger.Logger.Warnf("Skipping corrupted record in segment %s: %v", path, err)
+			continue
+		}
+		if r.Ts >= from.UnixNano() && r.Ts <= to.UnixNano() {
+			responses = append(responses, r)
+		}
+	}
+	return responses, scanner.Err()
+}
+
+// Range reads the id's segments overlapping [from, to] and returns the matching responses.
+// Locks the Disk's lock then unlock it.
+func (d *Disk) Range(id string, from, to time.Time) ([]types.Response, error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+	names, err := d.listSegments(id)
+	if err != nil {
+		return nil, err
+	}
+	var responses []types.Response
+	for _, name := range names {
+		start, _ := segmentStart(name)
+		if start.Add(segmentSpan).Before(from) || start.After(to) {
+			continue
+		}
+		segmentResponses, err := readSegment(filepath.Join(d.instanceDir(id), name), from, to)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, segmentResponses...)
+	}
+	return responses, nil
+}
+
+// Ids returns the ids having a directory under the storage directory.
+func (d *Disk) Ids() ([]string, error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		id, err := url.PathUnescape(file.Name())
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Remove deletes the id's directory and all of its segments.
+// Locks the Disk's lock then unlock it.
+func (d *Disk) Remove(id string) error {
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	if f, ok := d.segments[id]; ok {
+		f.Close()
+		delete(d.segments, id)
+	}
+	return os.RemoveAll(d.instanceDir(id))
+}
+
+// Prune deletes the segments ending before the given time.
+// Locks the Disk's lock then unlock it.
+func (d *Disk) Prune(before time.Time) error {
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		id, err := url.PathUnescape(file.Name())
+		if err != nil {
+			continue
+		}
+		names, err := d.listSegments(id)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			start, _ := segmentStart(name)
+			if !start.Add(segmentSpan).Before(before) {
+				break // Segments are sorted, the next ones are more recent
+			}
+			path := filepath.Join(d.instanceDir(id), name)
+			if f, ok := d.segments[id]; ok && f.Name() == path {
+				f.Close()
+				delete(d.segments, id)
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			logger.Logger.Infof("Segment %s was pruned from the storage", path)
+		}
+	}
+	return nil
+}
+
+// Close closes every open segment, the storage can not be used afterwards.
+func (d *Disk) Close() error {
+	d.Lock()
+	defer d.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	var firstErr error
+	for id, f := range d.segments {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(d.segments, id)
+	}
+	return firstErr
+}
@@ -0,0 +1,11 @@
+package storage
+
+import "errors"
+
+var (
+	// ErrClosed is returned when a storage is used after being closed.
+	ErrClosed = errors.New(`Storage is closed`)
+
+	// ErrDirNotValid is returned when the storage directory path is not a directory.
+	ErrDirNotValid = errors.New(`Storage path is not a directory`)
+)
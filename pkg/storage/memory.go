@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/rollup"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+// Memory is a Storage keeping the history in a map, the history vanishes with the process.
+type Memory struct {
+	sync.RWMutex //embedded field
+	data         map[string][]types.Response
+	buckets      map[string]map[time.Duration][]rollup.Bucket
+	incidents    map[string][]types.Incident
+}
+
+// NewMemory creates a new in memory storage.
+func NewMemory() *Memory {
+	return &Memory{
+		data:      map[string][]types.Response{},
+		buckets:   map[string]map[time.Duration][]rollup.Bucket{},
+		incidents: map[string][]types.Incident{},
+	}
+}
+
+// Append adds the response to the id's history.
+// Locks the Memory's write lock then unlock it.
+func (m *Memory) Append(id string, response types.Response) error {
+	m.Lock()
+	defer m.Unlock()
+	m.data[id] = append(m.data[id], response)
+	return nil
+}
+
+// Range returns the id's responses dating between from and to.
+// O(log(n)) since responses are sorted by timestamp.
+// Locks the Memory's read lock then unlock it.
+func (m *Memory) Range(id string, from, to time.Time) ([]types.Response, error) {
+	m.RLock()
+	defer m.RUnlock()
+	responses := m.data[id]
+	start := sort.Search(len(responses), func(i int) bool {
+		return responses[i].Timestamp() >= from.UnixNano()
+	})
+	end := sort.Search(len(responses), func(i int) bool {
+		return responses[i].Timestamp() > to.UnixNano()
+	})
+	if start >= end {
+		return nil, nil
+	}
+	rangeResponses := make([]types.Response, end-start)
+	copy(rangeResponses, responses[start:end])
+	return rangeResponses, nil
+}
+
+// Ids returns the ids having a history or incidents.
+// Locks the Memory's read lock then unlock it.
+func (m *Memory) Ids() ([]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+	var ids []string
+	for id := range m.data {
+		ids = append(ids, id)
+	}
+	for id := range m.incidents {
+		if _, ok := m.data[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Remove drops the id's history.
+// Locks the Memory's write lock then unlock it.
+func (m *Memory) Remove(id string) error {
+	m.Lock()
+	defer m.Unlock()
+	// If key does not exist delete is no-op.
+	delete(m.data, id)
+	delete(m.buckets, id)
+	delete(m.incidents, id)
+	return nil
+}
+
+// Prune drops the responses dating before the given time.
+// Locks the Memory's write lock then unlock it.
+func (m *Memory) Prune(before time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	for id, responses := range m.data {
+		sep := sort.Search(len(responses), func(i int) bool {
+			return responses[i].Timestamp() >= before.UnixNano()
+		})
+		// Copy to let the dropped responses be garbage collected
+		m.data[id] = append([]types.Response(nil), responses[sep:]...)
+	}
+	return nil
+}
+
+// AppendBucket adds the bucket to the id's rollups.
+// Locks the Memory's write lock then unlock it.
+func (m *Memory) AppendBucket(id string, bucket rollup.Bucket) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.buckets[id]; !ok {
+		m.buckets[id] = map[time.Duration][]rollup.Bucket{}
+	}
+	m.buckets[id][bucket.Resolution] = append(m.buckets[id][bucket.Resolution], bucket)
+	return nil
+}
+
+// Buckets returns the id's buckets of a resolution starting between from and to.
+// Locks the Memory's read lock then unlock it.
+func (m *Memory) Buckets(id string, resolution time.Duration, from, to time.Time) ([]rollup.Bucket, error) {
+	m.RLock()
+	defer m.RUnlock()
+	var buckets []rollup.Bucket
+	for _, bucket := range m.buckets[id][resolution] {
+		if !bucket.Start.Before(from) && !bucket.Start.After(to) {
+			buckets = append(buckets, bucket)
+		}
+	}
+	return rollup.Compact(buckets), nil
+}
+
+// PruneBuckets drops the buckets of a resolution starting before the given time.
+// Locks the Memory's write lock then unlock it.
+func (m *Memory) PruneBuckets(resolution time.Duration, before time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, rollups := range m.buckets {
+		var kept []rollup.Bucket
+		for _, bucket := range rollups[resolution] {
+			if !bucket.Start.Before(before) {
+				kept = append(kept, bucket)
+			}
+		}
+		rollups[resolution] = kept
+	}
+	return nil
+}
+
+// SaveIncidents replaces the id's incidents.
+// Locks the Memory's write lock then unlock it.
+func (m *Memory) SaveIncidents(id string, incidents []types.Incident) error {
+	m.Lock()
+	defer m.Unlock()
+	if len(incidents) == 0 {
+		delete(m.incidents, id)
+		return nil
+	}
+	m.incidents[id] = append([]types.Incident(nil), incidents...)
+	return nil
+}
+
+// Incidents returns the id's incidents.
+// Locks the Memory's read lock then unlock it.
+func (m *Memory) Incidents(id string) ([]types.Incident, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return append([]types.Incident(nil), m.incidents[id]...), nil
+}
+
+// Close is a no-op for the in memory storage.
+func (m *Memory) Close() error {
+	return nil
+}
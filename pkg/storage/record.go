@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+// record is the persisted form of a types.Response, it implements types.Response once decoded.
+type record struct {
+	Ts   int64         `json:"ts"`
+	Code int           `json:"code"`
+	Rt   time.Duration `json:"rt"`
+	Cl   int64         `json:"cl"`
+	St   string        `json:"st"`
+	Ec   string        `json:"ec,omitempty"`
+	Dg   string        `json:"dg,omitempty"`
+}
+
+func newRecord(response types.Response) record {
+	return record{
+		Ts:   response.Timestamp(),
+		Code: response.HttpStatusCode(),
+		Rt:   response.ResponseTime(),
+		Cl:   response.ContentLength(),
+		St:   response.Status(),
+		Ec:   response.ErrorClass(),
+		Dg:   response.Digest(),
+	}
+}
+
+func (r record) Timestamp() int64 {
+	return r.Ts
+}
+
+func (r record) HttpStatusCode() int {
+	return r.Code
+}
+
+func (r record) ResponseTime() time.Duration {
+	return r.Rt
+}
+
+func (r record) ContentLength() int64 {
+	return r.Cl
+}
+
+func (r record) Status() string {
+	return r.St
+}
+
+func (r record) ErrorClass() string {
+	return r.Ec
+}
+
+func (r record) Digest() string {
+	return r.Dg
+}
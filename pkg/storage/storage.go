@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/rollup"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const PKG = "storage"
+
+// Storage is the backend keeping the check history (responses) of every instance id.
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Append adds a response at the end of the instance's history.
+	// Responses of an instance are appended in timestamp order.
+	Append(id string, response types.Response) error
+	// Range returns the instance's responses with a timestamp in [from, to], sorted by timestamp.
+	Range(id string, from, to time.Time) ([]types.Response, error)
+	// Ids returns every instance id having a history.
+	Ids() ([]string, error)
+	// Remove drops the whole history of an instance, no-op if the id is unknown.
+	Remove(id string) error
+	// Prune drops the responses dating before the given time.
+	Prune(before time.Time) error
+	// AppendBucket adds a closed rollup bucket to the instance's rollups of the bucket's resolution.
+	AppendBucket(id string, bucket rollup.Bucket) error
+	// Buckets returns the instance's buckets of a resolution starting in [from, to], sorted by start.
+	// Buckets written twice for the same start are merged.
+	Buckets(id string, resolution time.Duration, from, to time.Time) ([]rollup.Bucket, error)
+	// PruneBuckets drops the buckets of a resolution starting before the given time.
+	PruneBuckets(resolution time.Duration, before time.Time) error
+	// SaveIncidents replaces the instance's incidents, sorted by start. No incidents removes them.
+	SaveIncidents(id string, incidents []types.Incident) error
+	// Incidents returns the instance's incidents saved last, sorted by start.
+	Incidents(id string) ([]types.Incident, error)
+	// Close releases the resources held by the storage.
+	Close() error
+}
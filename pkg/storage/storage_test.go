@@ -0,0 +1,221 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/rollup"
+	"github.com/Dainerx/wpam/pkg/storage"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+const idFirst = "/first" // Slash must be escaped by the disk storage
+
+// Returns a response at t, up with a 200 or down with a 500.
+func response(t time.Time, status string) types.Response {
+	code := http.StatusOK
+	if status == types.Down {
+		code = http.StatusInternalServerError
+	}
+	return *website_check.NewCheckResponseAt(t, []int{http.StatusOK}, code, 100*time.Millisecond, 42)
+}
+
+// Appends one response a day for the past three days then checks ranges and pruning.
+// Responses are appended at noon UTC so the disk storage prunes the same days as the memory.
+func testStorage(t *testing.T, st storage.Storage) {
+	now := time.Now().UTC().Truncate(24 * time.Hour).Add(12 * time.Hour)
+	for days := 3; days >= 0; days-- {
+		if err := st.Append(idFirst, response(now.Add(time.Duration(-days)*24*time.Hour), types.Up)); err != nil {
+			t.Fatalf("st.Append() failed: %v", err)
+		}
+	}
+	ids, err := st.Ids()
+	if err != nil || len(ids) != 1 || ids[0] != idFirst {
+		t.Fatalf("st.Ids() = %v, %v; want [%s]", ids, err, idFirst)
+	}
+	got, err := st.Range(idFirst, now.Add(-36*time.Hour), now)
+	if err != nil {
+		t.Fatalf("st.Range() failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("len(st.Range()) = %d; want 2", len(got))
+	}
+	if len(got) > 0 && (got[len(got)-1].Timestamp() != now.UnixNano() || got[len(got)-1].Status() != types.Up || got[len(got)-1].ContentLength() != 42) {
+		t.Errorf("st.Range() last response = %v; want the one appended at %v", got[len(got)-1], now)
+	}
+	// One hour after the end of the day of the oldest response
+	if err := st.Prune(now.Add(-59 * time.Hour)); err != nil {
+		t.Fatalf("st.Prune() failed: %v", err)
+	}
+	got, _ = st.Range(idFirst, time.Time{}, now)
+	if len(got) != 3 {
+		t.Fatalf("len(st.Range()) after pruning = %d; want 3", len(got))
+	}
+	for i, days := range []int{2, 1, 0} {
+		if want := now.Add(time.Duration(-days) * 24 * time.Hour).UnixNano(); got[i].Timestamp() != want {
+			t.Errorf("st.Range()[%d] after pruning dates at %v; want %v", i, time.Unix(0, got[i].Timestamp()), time.Unix(0, want))
+		}
+	}
+	if err := st.Remove(idFirst); err != nil {
+		t.Fatalf("st.Remove() failed: %v", err)
+	}
+	if got, _ = st.Range(idFirst, time.Time{}, now); len(got) != 0 {
+		t.Errorf("len(st.Range()) after removal = %d; want 0", len(got))
+	}
+}
+
+// Appends an hour bucket a day for the past three days, a bucket twice, then checks ranges and pruning.
+func testStorageBuckets(t *testing.T, st storage.Storage) {
+	now := time.Now()
+	for days := 3; days >= 0; days-- {
+		bucket := rollup.NewBucket(now.Add(time.Duration(-days)*24*time.Hour), rollup.Hour)
+		bucket.Add(response(now, types.Up))
+		if err := st.AppendBucket(idFirst, bucket); err != nil {
+			t.Fatalf("st.AppendBucket() failed: %v", err)
+		}
+	}
+	// Same bucket written again, e.g. flushed on shutdown and reopened on restart
+	bucket := rollup.NewBucket(now, rollup.Hour)
+	bucket.Add(response(now, types.Down))
+	st.AppendBucket(idFirst, bucket)
+
+	buckets, err := st.Buckets(idFirst, rollup.Hour, now.Add(-36*time.Hour), now)
+	if err != nil {
+		t.Fatalf("st.Buckets() failed: %v", err)
+	}
+	if len(buckets) != 2 || buckets[1].Count != 2 || buckets[1].UpCount != 1 {
+		t.Errorf("st.Buckets() = %+v; want 2 buckets, the last one merged", buckets)
+	}
+	if buckets, _ = st.Buckets(idFirst, rollup.Minute, time.Time{}, now); len(buckets) != 0 {
+		t.Errorf("len(st.Buckets(Minute)) = %d; want 0", len(buckets))
+	}
+	if err := st.PruneBuckets(rollup.Hour, now.Add(-50*time.Hour)); err != nil {
+		t.Fatalf("st.PruneBuckets() failed: %v", err)
+	}
+	if buckets, _ = st.Buckets(idFirst, rollup.Hour, time.Time{}, now); len(buckets) != 3 {
+		t.Errorf("len(st.Buckets()) after pruning = %d; want 3", len(buckets))
+	}
+}
+
+// Saves an instance's incidents with a note, replaces them then removes them.
+func testStorageIncidents(t *testing.T, st storage.Storage) {
+	start := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	incidents := []types.Incident{{
+		Start:           start,
+		End:             start.Add(10 * time.Minute),
+		MinAvailability: 40,
+		ErrorClasses:    map[string]int{types.ErrorClassTimeout: 3},
+		Notes:           []types.IncidentNote{{Timestamp: start.Add(time.Minute), Text: "Database failover"}},
+	}}
+	if err := st.SaveIncidents(idFirst, incidents); err != nil {
+		t.Fatalf("st.SaveIncidents() failed: %v", err)
+	}
+	got, err := st.Incidents(idFirst)
+	if err != nil || len(got) != 1 || !got[0].Start.Equal(start) || got[0].ErrorClasses[types.ErrorClassTimeout] != 3 ||
+		len(got[0].Notes) != 1 || got[0].Notes[0].Text != "Database failover" {
+		t.Fatalf("st.Incidents() = %+v, %v; want the saved incident", got, err)
+	}
+	if ids, _ := st.Ids(); len(ids) != 1 || ids[0] != idFirst {
+		t.Errorf("st.Ids() = %v; want [%s] having incidents", ids, idFirst)
+	}
+	incidents = append(incidents, types.Incident{Start: start.Add(30 * time.Minute)})
+	st.SaveIncidents(idFirst, incidents)
+	if got, _ := st.Incidents(idFirst); len(got) != 2 || !got[1].Ongoing() {
+		t.Errorf("st.Incidents() = %+v; want the 2 incidents saved last", got)
+	}
+	if err := st.Remove(idFirst); err != nil {
+		t.Fatalf("st.Remove() failed: %v", err)
+	}
+	if got, err := st.Incidents(idFirst); err != nil || len(got) != 0 {
+		t.Errorf("st.Incidents() after removal = %+v, %v; want none", got, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStorage(t, storage.NewMemory())
+	testStorageBuckets(t, storage.NewMemory())
+	testStorageIncidents(t, storage.NewMemory())
+}
+
+func TestDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer st.Close()
+	testStorage(t, st)
+	testStorageBuckets(t, st)
+	testStorageIncidents(t, st)
+}
+
+// History written by a disk storage must be read back after a restart.
+func TestDiskReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wpam")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	now := time.Now()
+	st.Append(idFirst, response(now, types.Down))
+	st.Close()
+	if err := st.Append(idFirst, response(now, types.Down)); err != storage.ErrClosed {
+		t.Errorf("st.Append() after Close() = %v; want %v", err, storage.ErrClosed)
+	}
+
+	st, err = storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer st.Close()
+	got, err := st.Range(idFirst, now.Add(-time.Minute), now)
+	if err != nil || len(got) != 1 || got[0].Status() != types.Down {
+		t.Errorf("st.Range() after reopening = %v, %v; want one %s response", got, err, types.Down)
+	}
+}
+
+// Ids . and .. are kept under the storage directory, removing them does not remove it.
+func TestDiskDotIds(t *testing.T) {
+	parent, err := ioutil.TempDir("", "wpam")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "data")
+	st, err := storage.NewDisk(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer st.Close()
+	for _, id := range []string{".", ".."} {
+		if err := st.Append(id, response(time.Now(), types.Up)); err != nil {
+			t.Fatalf("st.Append(%q) failed: %v", id, err)
+		}
+	}
+	if files, _ := ioutil.ReadDir(parent); len(files) != 1 {
+		t.Errorf("Storage wrote %d files next to its directory; want none", len(files)-1)
+	}
+	ids, err := st.Ids()
+	if err != nil || len(ids) != 2 {
+		t.Errorf("st.Ids() = %q, %v; want . and ..", ids, err)
+	}
+	if err := st.Remove("."); err != nil {
+		t.Fatalf("st.Remove(.) failed: %v", err)
+	}
+	if got, _ := st.Range("..", time.Time{}, time.Now()); len(got) != 1 {
+		t.Errorf("len(st.Range(..)) after removing . = %d; want 1", len(got))
+	}
+}
@@ -0,0 +1,17 @@
+package stream
+
+import "errors"
+
+var (
+	// ErrLastEventIdNotValid is returned when the last event id is not {epoch}-{number}.
+	ErrLastEventIdNotValid = errors.New("Last event id must be {epoch}-{number}, as sent by the stream")
+
+	// ErrLastEventIdExpired is returned when the last event id was sent before wpam restarted, its events are lost.
+	ErrLastEventIdExpired = errors.New("Last event id is from a previous run, its events are lost")
+
+	// ErrStreamingNotSupported is returned when the connection can not be flushed after every event.
+	ErrStreamingNotSupported = errors.New("Streaming not supported")
+
+	// ErrMethodNotAllowed is returned when the stream is requested with another method than GET.
+	ErrMethodNotAllowed = errors.New("Method not allowed")
+)
@@ -0,0 +1,29 @@
+package stream
+
+// filter selects the events of a client by instance id and tags, an empty filter matches every event.
+type filter struct {
+	ids  []string // The instance must be one of them
+	tags []string // The instance must have all of them
+}
+
+// matches tells whether the event is of an instance selected by the filter.
+func (f filter) matches(event Event) bool {
+	if len(f.ids) > 0 && !contains(f.ids, event.InstanceId) {
+		return false
+	}
+	for _, tag := range f.tags {
+		if !contains(event.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
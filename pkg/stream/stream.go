@@ -0,0 +1,275 @@
+// Package stream pushes the check results and the alert transitions of the instances as Server-Sent Events.
+// Events are numbered, the last ones are kept so a client reconnecting with its last event id misses none of them.
+// Event ids are written {epoch}-{number}, the epoch is the start of the stream so the ids of a restarted wpam
+// are not taken for the ones of the previous process: such clients get a reset event and the events from now.
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+const (
+	PKG         = "stream"
+	contentType = "text/event-stream"
+	// Events kept to be replayed to the clients resuming from their last event id.
+	bufferSize = 1024
+	// Events queued per client, a client falling further behind is disconnected and resumes on reconnect.
+	queueSize = 256
+	// Comments are written to idle clients so proxies do not close the connection.
+	keepAliveInterval = 15 * time.Second
+)
+
+// Types of the events.
+const (
+	EventCheck = "check"
+	EventAlert = "alert"
+	// Sent first to a client resuming from an id of a previous process, the events it missed are lost.
+	EventReset = "reset"
+)
+
+// Event is a check result or an alert transition of an instance, Data is its JSON view.
+type Event struct {
+	Id         uint64
+	Type       string
+	InstanceId string
+	Tags       []string // Tags of the instance when the event occurred, used for filtering
+	Data       []byte
+}
+
+// Check is the JSON view of a check result: response times are in seconds, times are RFC3339.
+type Check struct {
+	Id             string    `json:"id"`
+	Timestamp      time.Time `json:"timestamp"`
+	Status         string    `json:"status"`
+	HttpStatusCode int       `json:"httpStatusCode"`
+	ResponseTime   float64   `json:"responseTime"`
+	ContentLength  int64     `json:"contentLength"`
+	ErrorClass     string    `json:"errorClass,omitempty"`
+}
+
+// Alert is the JSON view of an alert transition, availability alerts are of kind availability.
+type Alert struct {
+	Id        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Value     float64   `json:"value"`
+	Firing    bool      `json:"firing"`
+}
+
+// subscriber is a client of the stream with the filter of its request.
+type subscriber struct {
+	events chan Event
+	filter filter
+}
+
+// Stream serves the events of the instances registered in the store on GET:
+// - ?id= only the events of these instances, repeat it for several instances.
+// - ?tag= only the events of the instances having all these tags, e.g. env:prod.
+// - the Last-Event-ID header or ?lastEventId= replays the events kept after this one first,
+// an id of another epoch gets a reset event instead since the events of a previous process are lost.
+// Without an id, only the events from now are streamed.
+type Stream struct {
+	sync.Mutex  //embedded field
+	store       *safe_store.SafeStore
+	epoch       int64 // Unix nanoseconds the stream started at
+	lastId      uint64
+	buffer      []Event // Ring of the last events, buffer[lastId%bufferSize] is the last one
+	subscribers map[*subscriber]bool
+}
+
+// New creates a stream fed by every response put in the store and every alert transition afterwards.
+func New(store *safe_store.SafeStore) *Stream {
+	s := &Stream{
+		store:       store,
+		epoch:       time.Now().UnixNano(),
+		buffer:      make([]Event, bufferSize),
+		subscribers: map[*subscriber]bool{},
+	}
+	store.OnResponse(s.onResponse)
+	store.OnAlert(s.onAlert)
+	return s
+}
+
+func (s *Stream) onResponse(id string, response types.Response) {
+	s.publish(id, EventCheck, Check{
+		Id:             id,
+		Timestamp:      time.Unix(0, response.Timestamp()),
+		Status:         response.Status(),
+		HttpStatusCode: response.HttpStatusCode(),
+		ResponseTime:   response.ResponseTime().Seconds(),
+		ContentLength:  response.ContentLength(),
+		ErrorClass:     response.ErrorClass(),
+	})
+}
+
+func (s *Stream) onAlert(id string, event types.AlertEvent) {
+	s.publish(id, EventAlert, Alert{
+		Id:        id,
+		Timestamp: event.Timestamp,
+		Kind:      event.Kind,
+		Name:      event.Name,
+		Value:     event.Value,
+		Firing:    event.Firing,
+	})
+}
+
+// publish numbers the event, keeps it and sends it to the subscribers it matches.
+// Subscribers too slow to take it are disconnected rather than blocking the store.
+// Locks the Stream then unlock it.
+func (s *Stream) publish(id string, eventType string, view interface{}) {
+	data, err := json.Marshal(view)
+	if err != nil {
+		logger.Logger.Errorf("Failed to marshal %s event of %s: %v", eventType, id, err)
+		return
+	}
+	instance, _ := s.store.GetInstance(id)
+	s.Lock()
+	defer s.Unlock()
+	s.lastId++
+	event := Event{Id: s.lastId, Type: eventType, InstanceId: id, Tags: instance.Tags, Data: data}
+	s.buffer[event.Id%bufferSize] = event
+	for sub := range s.subscribers {
+		if !sub.filter.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			logger.Logger.Warnf("Stream client too slow, disconnected at event %d", event.Id)
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// subscribe registers a subscriber and returns the id of the last event published.
+// If resume is true, also returns the kept events after lastId it matches, oldest first.
+// Locks the Stream then unlock it.
+func (s *Stream) subscribe(f filter, lastId uint64, resume bool) (*subscriber, []Event, uint64) {
+	s.Lock()
+	defer s.Unlock()
+	var replay []Event
+	if resume && lastId < s.lastId {
+		from := lastId + 1
+		if s.lastId-lastId > bufferSize { // The older events are not kept anymore
+			from = s.lastId - bufferSize + 1
+		}
+		for id := from; id <= s.lastId; id++ {
+			if event := s.buffer[id%bufferSize]; f.matches(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+	sub := &subscriber{events: make(chan Event, queueSize), filter: f}
+	s.subscribers[sub] = true
+	return sub, replay, s.lastId
+}
+
+// unsubscribe removes the subscriber if it was not disconnected already.
+// Locks the Stream then unlock it.
+func (s *Stream) unsubscribe(sub *subscriber) {
+	s.Lock()
+	defer s.Unlock()
+	if s.subscribers[sub] {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// ServeHTTP streams the events matching the request's filter until the client disconnects.
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, ErrStreamingNotSupported.Error(), http.StatusInternalServerError)
+		return
+	}
+	lastId, resume, err := s.parseLastEventId(r)
+	expired := err == ErrLastEventIdExpired
+	if err != nil && !expired {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	sub, replay, currentId := s.subscribe(filter{ids: query["id"], tags: query["tag"]}, lastId, resume)
+	defer s.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if expired { // Not an error for EventSource, which never reconnects after one
+		s.writeEvent(w, Event{Id: currentId, Type: EventReset, Data: []byte("{}")})
+	}
+	for _, event := range replay {
+		s.writeEvent(w, event)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.events:
+			if !ok { // Disconnected by publish
+				return
+			}
+			s.writeEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// Writes the event in the text/event-stream format, JSON has no new line so it fits a single data field.
+func (s *Stream) writeEvent(w http.ResponseWriter, event Event) {
+	fmt.Fprintf(w, "id: %d-%d\nevent: %s\ndata: %s\n\n", s.epoch, event.Id, event.Type, event.Data)
+}
+
+// Parses the id of the last event the client got, from the Last-Event-ID header EventSource sends on reconnect
+// or the lastEventId query parameter. resume is false if none is given.
+// Returns error if it is not {epoch}-{number} or its epoch is not the stream's one.
+func (s *Stream) parseLastEventId(r *http.Request) (lastId uint64, resume bool, err error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return 0, false, ErrLastEventIdNotValid
+	}
+	epoch, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, false, ErrLastEventIdNotValid
+	}
+	lastId, err = strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, false, ErrLastEventIdNotValid
+	}
+	if epoch != s.epoch {
+		return 0, false, ErrLastEventIdExpired
+	}
+	return lastId, true, nil
+}
@@ -0,0 +1,198 @@
+package stream_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/stream"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+type event struct {
+	id        string
+	eventType string
+	data      string
+}
+
+// Connects to the stream and returns the events it reads, the connection is closed when the test ends.
+func connect(t *testing.T, server *httptest.Server, query string, lastEventId string) <-chan event {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream"+query, nil)
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /stream%s: %v", query, err)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Content-Type = %s; want text/event-stream", contentType)
+	}
+	events := make(chan event, 64)
+	go func() {
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		var e event
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if e.id != "" {
+					events <- e
+				}
+				e = event{}
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.eventType = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events
+}
+
+// Returns the next check event, alert events are skipped.
+func nextCheck(t *testing.T, events <-chan event) (event, stream.Check) {
+	for {
+		select {
+		case e := <-events:
+			if e.eventType != stream.EventCheck {
+				continue
+			}
+			var check stream.Check
+			if err := json.Unmarshal([]byte(e.data), &check); err != nil {
+				t.Fatalf("check event data %s: %v", e.data, err)
+			}
+			return e, check
+		case <-time.After(2 * time.Second):
+			t.Fatal("No check event received")
+		}
+	}
+}
+
+func put(store *safe_store.SafeStore, id string, httpStatusCode int) {
+	store.Put(id, *website_check.NewCheckResponseWithStatus([]int{http.StatusOK}, httpStatusCode, 20*time.Millisecond, 0))
+}
+
+func TestStreamFilter(t *testing.T) {
+	store := safe_store.New()
+	server := httptest.NewServer(stream.New(store))
+	t.Cleanup(server.Close) // After the clients disconnect
+	store.Register(types.Instance{Id: "first", Url: "http://example.com", Tags: []string{"env:prod"}})
+	store.Register(types.Instance{Id: "second", Url: "http://example.org", Tags: []string{"env:dev"}})
+
+	all := connect(t, server, "", "")
+	prod := connect(t, server, "?tag=env:prod", "")
+	second := connect(t, server, "?id=second", "")
+	put(store, "second", http.StatusOK)
+	put(store, "first", http.StatusNotFound)
+
+	if _, check := nextCheck(t, all); check.Id != "second" {
+		t.Errorf("first check of ?all = %s; want second", check.Id)
+	}
+	if _, check := nextCheck(t, all); check.Id != "first" || check.HttpStatusCode != http.StatusNotFound || check.Status != types.Down {
+		t.Errorf("second check of ?all = %+v; want the 404 of first", check)
+	}
+	if _, check := nextCheck(t, prod); check.Id != "first" {
+		t.Errorf("first check of ?tag=env:prod = %s; want first", check.Id)
+	}
+	if _, check := nextCheck(t, second); check.Id != "second" {
+		t.Errorf("first check of ?id=second = %s; want second", check.Id)
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	store := safe_store.New()
+	server := httptest.NewServer(stream.New(store))
+	t.Cleanup(server.Close) // After the clients disconnect
+	store.Register(types.Instance{Id: "first", Url: "http://example.com"})
+
+	events := connect(t, server, "", "")
+	put(store, "first", http.StatusOK)
+	e, _ := nextCheck(t, events)
+	put(store, "first", http.StatusNotFound)
+
+	// Reconnecting replays the events after the last one received
+	resumed := connect(t, server, "", e.id)
+	if _, check := nextCheck(t, resumed); check.HttpStatusCode != http.StatusNotFound {
+		t.Errorf("first check resumed after event %s = %+v; want the 404", e.id, check)
+	}
+
+	for _, lastEventId := range []string{"abc", "1"} {
+		rec := httptest.NewRecorder()
+		stream.New(store).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream?lastEventId="+lastEventId, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /stream?lastEventId=%s = %d; want %d", lastEventId, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	// An id of a previous process is reset, the stream goes on from now
+	reset := connect(t, server, "", "1-1")
+	select {
+	case e := <-reset:
+		if e.eventType != stream.EventReset || strings.HasPrefix(e.id, "1-") {
+			t.Errorf("first event resumed after 1-1 = %+v; want a reset with an id of this run", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No reset event received")
+	}
+	put(store, "first", http.StatusInternalServerError)
+	if _, check := nextCheck(t, reset); check.HttpStatusCode != http.StatusInternalServerError {
+		t.Errorf("first check after the reset = %+v; want the 500", check)
+	}
+}
+
+// A client connecting without a last event id gets only the events from now.
+func TestStreamFromNow(t *testing.T) {
+	store := safe_store.New()
+	server := httptest.NewServer(stream.New(store))
+	t.Cleanup(server.Close) // After the clients disconnect
+	store.Register(types.Instance{Id: "first", Url: "http://example.com"})
+	put(store, "first", http.StatusOK)
+	put(store, "first", http.StatusOK)
+
+	events := connect(t, server, "", "")
+	put(store, "first", http.StatusNotFound)
+	if _, check := nextCheck(t, events); check.HttpStatusCode != http.StatusNotFound {
+		t.Errorf("first check = %+v; want the 404 put after connecting", check)
+	}
+}
+
+func TestStreamAlert(t *testing.T) {
+	store := safe_store.New()
+	server := httptest.NewServer(stream.New(store))
+	t.Cleanup(server.Close) // After the clients disconnect
+	store.Register(types.Instance{Id: "first", Url: "http://example.com"})
+
+	events := connect(t, server, "?id=first", "")
+	put(store, "first", http.StatusNotFound)
+	for {
+		select {
+		case e := <-events:
+			if e.eventType != stream.EventAlert {
+				continue
+			}
+			var alert stream.Alert
+			if err := json.Unmarshal([]byte(e.data), &alert); err != nil {
+				t.Fatalf("alert event data %s: %v", e.data, err)
+			}
+			if alert.Id != "first" || alert.Kind != types.AlertKindAvailability || alert.Name != types.AlertNameDown || !alert.Firing {
+				t.Errorf("alert event = %+v; want first down", alert)
+			}
+			return
+		case <-time.After(2 * time.Second):
+			t.Fatal("No alert event received")
+		}
+	}
+}
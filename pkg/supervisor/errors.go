@@ -0,0 +1,11 @@
+package supervisor
+
+import "errors"
+
+var (
+	// ErrIdDuplicated is returned when an instance is added under an id already supervised.
+	ErrIdDuplicated = errors.New("Instance id already exists")
+
+	// ErrInstanceNotFound is returned when no instance is supervised under the id.
+	ErrInstanceNotFound = errors.New("Instance not found")
+)
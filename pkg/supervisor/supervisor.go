@@ -0,0 +1,270 @@
+// Package supervisor starts and stops the check requests of the instances while wpam runs.
+package supervisor
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/Dainerx/wpam/pkg/logger"
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+const PKG = "supervisor"
+
+// Reloaded tells what a reload changed, by instance id.
+// Skipped instances are not valid or duplicated, the supervised instance of their id if any is left unchanged.
+type Reloaded struct {
+	Added     []string
+	Updated   []string
+	Deleted   []string
+	Unchanged []string
+	Skipped   []error
+}
+
+// ChangeListener is called with every supervised instance, in the order they were added, once one of them changed.
+type ChangeListener func(instances []types.Instance)
+
+// Supervisor runs a check request per instance, instances are registered in the store under their id.
+// Paused instances stay registered with their data but are not checked.
+type Supervisor struct {
+	sync.Mutex //embedded field
+	store      *safe_store.SafeStore
+	instances  map[string]types.Instance
+	ids        []string // Ids in the order the instances were added
+	checks     map[string]*website_check.CheckRequest
+	listeners  []ChangeListener
+}
+
+// New creates a supervisor registering its instances in the store.
+func New(store *safe_store.SafeStore) *Supervisor {
+	return &Supervisor{
+		store:     store,
+		instances: make(map[string]types.Instance),
+		checks:    make(map[string]*website_check.CheckRequest),
+	}
+}
+
+// OnChange registers a listener called after every change of the instances done afterwards.
+// Listeners are called with the Supervisor locked, they must not call it.
+// Locks the Supervisor then unlock it.
+func (s *Supervisor) OnChange(listener ChangeListener) {
+	s.Lock()
+	defer s.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// Add validates the instance, registers it in the store and runs its check request unless it is paused.
+// Returns the validated instance, defaults included.
+// Returns error if the instance is not valid or its id is already supervised.
+// Locks the Supervisor then unlock it.
+func (s *Supervisor) Add(instance types.Instance) (types.Instance, error) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.instances[instance.Id]; ok {
+		return instance, ErrIdDuplicated
+	}
+	checkRequest, err := website_check.NewcheckRequestFromInstance(instance, s.store)
+	if err != nil {
+		return instance, err
+	}
+	s.ids = append(s.ids, instance.Id)
+	s.start(checkRequest)
+	s.changed()
+	return checkRequest.Instance(), nil
+}
+
+// Update validates the instance and replaces the one supervised under its id, its check request is restarted.
+// The data and alerts of the instance are kept.
+// Returns the validated instance, defaults included.
+// Returns error if the instance is not valid or not supervised, the supervised one is left unchanged then.
+// Locks the Supervisor then unlock it.
+func (s *Supervisor) Update(instance types.Instance) (types.Instance, error) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.instances[instance.Id]; !ok {
+		return instance, ErrInstanceNotFound
+	}
+	checkRequest, err := website_check.NewcheckRequestFromInstance(instance, s.store)
+	if err != nil {
+		return instance, err
+	}
+	s.stop(instance.Id)
+	s.start(checkRequest)
+	s.changed()
+	return checkRequest.Instance(), nil
+}
+
+// Pause stops checking the instance, pausing a paused instance is a no-op.
+// Returns error if the instance is not supervised.
+// Locks the Supervisor then unlock it.
+func (s *Supervisor) Pause(id string) (types.Instance, error) {
+	return s.setPaused(id, true)
+}
+
+// Resume checks the instance again right away, resuming a running instance is a no-op.
+// Returns error if the instance is not supervised.
+// Locks the Supervisor then unlock it.
+func (s *Supervisor) Resume(id string) (types.Instance, error) {
+	return s.setPaused(id, false)
+}
+
+func (s *Supervisor) setPaused(id string, paused bool) (types.Instance, error) {
+	s.Lock()
+	defer s.Unlock()
+	instance, ok := s.instances[id]
+	if !ok {
+		return instance, ErrInstanceNotFound
+	}
+	if instance.Paused == paused {
+		return instance, nil
+	}
+	instance.Paused = paused
+	// The instance was validated when added
+	checkRequest, err := website_check.NewcheckRequestFromInstance(instance, s.store)
+	if err != nil {
+		return instance, err
+	}
+	s.stop(id)
+	s.start(checkRequest)
+	s.changed()
+	return instance, nil
+}
+
+// Delete stops checking the instance and unregisters it, its data and alerts are removed from the store.
+// Returns error if the instance is not supervised.
+// Locks the Supervisor then unlock it.
+func (s *Supervisor) Delete(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.instances[id]; !ok {
+		return ErrInstanceNotFound
+	}
+	s.remove(id)
+	s.changed()
+	return nil
+}
+
+// Reload replaces the supervised instances by the given ones, e.g. read again from the configuration file:
+// new ids are added, ids not given anymore are deleted, changed instances are restarted with their data and alerts kept
+// and unchanged ones keep running. Instances are compared once validated, defaults included.
+// Change listeners are not called since the instances come from the configuration already.
+// Locks the Supervisor then unlock it.
+func (s *Supervisor) Reload(instances []types.Instance) Reloaded {
+	s.Lock()
+	defer s.Unlock()
+	var reloaded Reloaded
+	given := make(map[string]bool)
+	for _, instance := range instances {
+		if given[instance.Id] {
+			reloaded.Skipped = append(reloaded.Skipped, fmt.Errorf("Instance %s: %v", instance.Id, ErrIdDuplicated))
+			continue
+		}
+		given[instance.Id] = true
+		checkRequest, err := website_check.NewcheckRequestFromInstance(instance, s.store)
+		if err != nil {
+			reloaded.Skipped = append(reloaded.Skipped, fmt.Errorf("Instance %s: %v", instance.Id, err))
+			continue
+		}
+		supervised, ok := s.instances[instance.Id]
+		switch {
+		case !ok:
+			s.ids = append(s.ids, instance.Id)
+			reloaded.Added = append(reloaded.Added, instance.Id)
+		case reflect.DeepEqual(supervised, checkRequest.Instance()):
+			reloaded.Unchanged = append(reloaded.Unchanged, instance.Id)
+			continue
+		default:
+			s.stop(instance.Id)
+			reloaded.Updated = append(reloaded.Updated, instance.Id)
+		}
+		s.start(checkRequest)
+	}
+	for _, id := range append([]string(nil), s.ids...) {
+		if !given[id] {
+			s.remove(id)
+			reloaded.Deleted = append(reloaded.Deleted, id)
+		}
+	}
+	return reloaded
+}
+
+// Instances returns every supervised instance in the order they were added.
+// Locks the Supervisor then unlock it.
+func (s *Supervisor) Instances() []types.Instance {
+	s.Lock()
+	defer s.Unlock()
+	return s.list()
+}
+
+// StopAll stops the check requests of every instance, they stay registered.
+// Locks the Supervisor then unlock it.
+func (s *Supervisor) StopAll() {
+	s.Lock()
+	defer s.Unlock()
+	for id := range s.checks {
+		s.stop(id)
+	}
+}
+
+// Registers the check request's instance and runs it unless it is paused.
+// The Supervisor must be locked.
+func (s *Supervisor) start(checkRequest *website_check.CheckRequest) {
+	instance := checkRequest.Instance()
+	s.instances[instance.Id] = instance
+	// Keep the instance as metadata of the data stored under its id
+	s.store.Register(instance)
+	if instance.Paused {
+		logger.Logger.Infof("Instance %s is paused", instance.Id)
+		return
+	}
+	s.checks[instance.Id] = checkRequest
+	// Run checkRequest on different go routines (for each instance a goroutine)
+	go checkRequest.Run()
+}
+
+// Stops the check request of the instance if it runs without waiting for its current check, which is dropped.
+// The Supervisor must be locked, stopping does not block it for the check's timeout.
+func (s *Supervisor) stop(id string) {
+	if checkRequest, ok := s.checks[id]; ok {
+		checkRequest.Stop()
+		delete(s.checks, id)
+	}
+}
+
+// Stops the instance and unregisters it, its data and alerts are removed from the store.
+// The Supervisor must be locked.
+func (s *Supervisor) remove(id string) {
+	s.stop(id)
+	delete(s.instances, id)
+	for i := range s.ids {
+		if s.ids[i] == id {
+			s.ids = append(s.ids[:i], s.ids[i+1:]...)
+			break
+		}
+	}
+	s.store.Unregister(id)
+}
+
+// The Supervisor must be locked.
+func (s *Supervisor) list() []types.Instance {
+	instances := make([]types.Instance, 0, len(s.ids))
+	for _, id := range s.ids {
+		instances = append(instances, s.instances[id])
+	}
+	return instances
+}
+
+// Calls the listeners with the instances.
+// The Supervisor must be locked.
+func (s *Supervisor) changed() {
+	if len(s.listeners) == 0 {
+		return
+	}
+	instances := s.list()
+	for _, listener := range s.listeners {
+		listener(instances)
+	}
+}
@@ -0,0 +1,167 @@
+package supervisor_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/supervisor"
+	"github.com/Dainerx/wpam/pkg/types"
+	"github.com/Dainerx/wpam/pkg/website_check"
+)
+
+// Waits for the instance to have n responses in the store.
+func waitResponses(t *testing.T, store *safe_store.SafeStore, id string, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(store.Get(id)) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("len(store.Get(%s)) = %d; want %d", id, len(store.Get(id)), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	store := safe_store.New()
+	s := supervisor.New(store)
+	var changes [][]types.Instance
+	s.OnChange(func(instances []types.Instance) { changes = append(changes, instances) })
+
+	instance, err := s.Add(types.Instance{Id: "first", Url: server.URL, CheckInterval: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("s.Add() failed: %v", err)
+	}
+	if instance.HttpMethod != types.HTTPGet || instance.Timeout != 10*time.Second {
+		t.Errorf("s.Add() = %+v; want the defaults", instance)
+	}
+	// The first check is done right away
+	waitResponses(t, store, "first", 1)
+	if _, err := s.Add(types.Instance{Id: "first", Url: server.URL}); err != supervisor.ErrIdDuplicated {
+		t.Errorf("s.Add() of a duplicated id = %v; want %v", err, supervisor.ErrIdDuplicated)
+	}
+	if _, err := s.Add(types.Instance{Id: "second", Url: "not an url"}); err != website_check.ErrUrlNotValid {
+		t.Errorf("s.Add() of an invalid url = %v; want %v", err, website_check.ErrUrlNotValid)
+	}
+
+	// An invalid update leaves the instance unchanged
+	if _, err := s.Update(types.Instance{Id: "first", Url: server.URL, HttpMethod: "PATCH"}); err != website_check.ErrHttpMethodNotRecognized {
+		t.Errorf("s.Update() of an invalid method = %v; want %v", err, website_check.ErrHttpMethodNotRecognized)
+	}
+	if _, err := s.Update(types.Instance{Id: "unknown", Url: server.URL}); err != supervisor.ErrInstanceNotFound {
+		t.Errorf("s.Update() of an unknown id = %v; want %v", err, supervisor.ErrInstanceNotFound)
+	}
+	// The data is kept and the new check request checks right away
+	if _, err := s.Update(types.Instance{Id: "first", Url: server.URL, HttpMethod: types.HTTPPost}); err != nil {
+		t.Fatalf("s.Update() failed: %v", err)
+	}
+	waitResponses(t, store, "first", 2)
+	if registered, _ := store.GetInstance("first"); registered.HttpMethod != types.HTTPPost {
+		t.Errorf("Registered method = %s; want %s", registered.HttpMethod, types.HTTPPost)
+	}
+
+	if instance, err = s.Pause("first"); err != nil || !instance.Paused {
+		t.Fatalf("s.Pause() = %+v, %v; want a paused instance", instance, err)
+	}
+	if registered, _ := store.GetInstance("first"); !registered.Paused {
+		t.Errorf("Registered instance is not paused")
+	}
+	if instance, err = s.Resume("first"); err != nil || instance.Paused {
+		t.Fatalf("s.Resume() = %+v, %v; want a running instance", instance, err)
+	}
+	waitResponses(t, store, "first", 3)
+
+	if err := s.Delete("first"); err != nil {
+		t.Fatalf("s.Delete() failed: %v", err)
+	}
+	if _, ok := store.GetInstance("first"); ok {
+		t.Errorf("Deleted instance is still registered")
+	}
+	if err := s.Delete("first"); err != supervisor.ErrInstanceNotFound {
+		t.Errorf("s.Delete() of a deleted instance = %v; want %v", err, supervisor.ErrInstanceNotFound)
+	}
+	// Add, update, pause, resume and delete
+	if len(changes) != 5 || len(changes[3]) != 1 || len(changes[4]) != 0 {
+		t.Errorf("Changes = %v; want 5 changes, the last one without instance", changes)
+	}
+	s.StopAll()
+}
+
+// Deleting an instance does not wait for its check in flight, whose response is dropped.
+func TestSupervisorDeleteInFlight(t *testing.T) {
+	requested := make(chan bool, 1)
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- true
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	store := safe_store.New()
+	s := supervisor.New(store)
+	if _, err := s.Add(types.Instance{Id: "first", Url: server.URL, CheckInterval: 5 * time.Second}); err != nil {
+		t.Fatalf("s.Add() failed: %v", err)
+	}
+	<-requested
+	deleted := make(chan error)
+	go func() { deleted <- s.Delete("first") }()
+	select {
+	case err := <-deleted:
+		if err != nil {
+			t.Fatalf("s.Delete() failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("s.Delete() waits for the check in flight")
+	}
+	if instances := s.Instances(); len(instances) != 0 {
+		t.Errorf("s.Instances() = %v; want none", instances)
+	}
+}
+
+// Reloading adds, updates and deletes instances by id, unchanged instances and their data are kept.
+func TestSupervisorReload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	store := safe_store.New()
+	s := supervisor.New(store)
+	defer s.StopAll()
+	changes := 0
+	s.OnChange(func(instances []types.Instance) { changes++ })
+	for _, id := range []string{"kept", "updated", "deleted"} {
+		if _, err := s.Add(types.Instance{Id: id, Url: server.URL, CheckInterval: 5 * time.Second}); err != nil {
+			t.Fatalf("s.Add(%s) failed: %v", id, err)
+		}
+	}
+	waitResponses(t, store, "kept", 1)
+
+	reloaded := s.Reload([]types.Instance{
+		{Id: "kept", Url: server.URL, CheckInterval: 5 * time.Second},
+		{Id: "updated", Url: server.URL, CheckInterval: 6 * time.Second},
+		{Id: "added", Url: server.URL, CheckInterval: 5 * time.Second},
+		{Id: "added", Url: server.URL},
+		{Id: "invalid", Url: "not an url"},
+	})
+	if len(reloaded.Added) != 1 || len(reloaded.Updated) != 1 || len(reloaded.Deleted) != 1 || len(reloaded.Unchanged) != 1 || len(reloaded.Skipped) != 2 {
+		t.Errorf("s.Reload() = %+v; want one instance added, updated, deleted and unchanged, two skipped", reloaded)
+	}
+	var ids []string
+	for _, instance := range s.Instances() {
+		ids = append(ids, instance.Id)
+	}
+	if strings.Join(ids, ",") != "kept,updated,added" {
+		t.Errorf("s.Instances() ids = %v; want kept, updated and added", ids)
+	}
+	if len(store.Get("kept")) == 0 {
+		t.Errorf("Data of the unchanged instance was lost")
+	}
+	if _, ok := store.GetInstance("deleted"); ok {
+		t.Errorf("Deleted instance is still registered")
+	}
+	if changes != 3 {
+		t.Errorf("Changes = %d; want the 3 adds only, reloads are not changes", changes)
+	}
+}
@@ -5,6 +5,7 @@ const (
 	Up                   = "UP"
 	Unkown               = "UNKOWN"
 	AvaiabilityThreshold = 80.00
+	DefaultApdexT        = 0.5
 	HTTPGet              = "GET"
 	HTTPHead             = "HEAD"
 	HTTPPost             = "POST"
@@ -12,4 +13,24 @@ const (
 	HTTPDelete           = "DELETE"
 	HTTPOptions          = "OPTIONS"
 	HTTPTrace            = "TRACE"
+	OperatorAbove        = ">"
+	OperatorAboveOrEqual = ">="
+	OperatorBelow        = "<"
+	OperatorBelowOrEqual = "<="
+	AlertKindRule        = "rule"
+	AlertKindBurnRate    = "burn_rate"
+	AlertKindAnomaly     = "anomaly"
+	AlertKindContent     = "content"
+	// Availability alerts are AlertStatus, they are told to the alert listeners as events of this kind named AlertNameDown.
+	AlertKindAvailability = "availability"
+	AlertNameDown         = "down"
+	DefaultSloWindowDays  = 30
+	// Error classes of a response, empty when the response is accepted.
+	ErrorClassTimeout           = "timeout"
+	ErrorClassDns               = "dns"
+	ErrorClassConnectionRefused = "connection_refused"
+	ErrorClassTls               = "tls"
+	ErrorClassBadStatus         = "bad_status"
+	ErrorClassAssertionFailed   = "assertion_failed"
+	ErrorClassOther             = "other"
 )
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"fmt"
+	"sort"
 	"time"
 )
 
@@ -13,20 +15,109 @@ type Instance struct {
 	HttpAcceptedResponseStatusCode []int //if it is not here then it is down
 	CheckInterval                  time.Duration
 	Data                           map[string]interface{}
+	Rules                          []Rule
+	ApdexT                         float64 // Apdex target time in seconds
+	Slo                            Slo
+	AnomalyDeviations              float64 // Latency anomaly sensitivity: standard deviations above the baseline, 0 disables it
+	Content                        Content
+	Tags                           []string // key:value or key, exported as labels
+	Paused                         bool     // Paused instances are registered but not checked
+	Group                          string   // Instances of a group are shown together on the status page
+}
+
+// Content tells how to detect unexpected changes of an instance's responses content.
+type Content struct {
+	Hash            bool     `json:"hash"`            // Hash the body to alert when it changes
+	Ignore          []string `json:"ignore"`          // Regular expressions of the dynamic parts stripped before hashing
+	LengthDeviation float64  `json:"lengthDeviation"` // Alert when the content length deviates from its baseline by this percentage, 0 disables it
+	Expect          string   `json:"expect"`          // Regular expression the body must match, the check fails with assertion_failed otherwise
+}
+
+// Slo is a service level objective on the availability of an instance, e.g. 99.9% over 30 days.
+// A zero Target means the instance has no objective.
+type Slo struct {
+	Target     float64 `json:"target"` // Availability percentage
+	WindowDays int     `json:"windowDays"`
+}
+
+// Enabled tells whether the instance declared an objective.
+func (slo Slo) Enabled() bool {
+	return slo.Target > 0
+}
+
+// Window returns the duration the objective is measured over.
+func (slo Slo) Window() time.Duration {
+	return time.Duration(slo.WindowDays) * 24 * time.Hour
+}
+
+// Rule is an alert condition on a metric of the instance's stats over the last two minutes, e.g. p95_rt > 2.5.
+type Rule struct {
+	Metric    string  `json:"metric"`
+	Operator  string  `json:"operator"`
+	Threshold float64 `json:"threshold"`
+}
+
+// String returns the rule as written in the configuration, used to name its alerts.
+func (rule Rule) String() string {
+	return fmt.Sprintf("%s %s %g", rule.Metric, rule.Operator, rule.Threshold)
+}
+
+// Matches tells whether the metric's value meets the rule's condition.
+func (rule Rule) Matches(value float64) bool {
+	switch rule.Operator {
+	case OperatorAbove:
+		return value > rule.Threshold
+	case OperatorAboveOrEqual:
+		return value >= rule.Threshold
+	case OperatorBelow:
+		return value < rule.Threshold
+	case OperatorBelowOrEqual:
+		return value <= rule.Threshold
+	default:
+		return false
+	}
 }
 
 // Configuration is struct holding an array of instances.
 type Configuration struct {
-	Input []Instance
+	Input     []Instance
+	Templated bool     // Instances use defaults, templates or environment variables, they are expanded in Input
+	Files     []string // Files the instances were read from, the including file before the included ones
+	Settings  Settings
+}
+
+// Settings are the global settings of wpam, zero values are not set.
+type Settings struct {
+	DisplayInterval  time.Duration // Stats over the display window are displayed at this interval
+	DisplayWindow    time.Duration
+	SummaryInterval  time.Duration // Stats over the summary window are displayed at this interval
+	SummaryWindow    time.Duration
+	CleanupInterval  time.Duration // Data older than the retention is dropped at this interval
+	Retention        time.Duration // How long the raw check history is kept
+	LogFile          string
+	MinTimeout       time.Duration // Bounds of the instances' timeouts and check intervals
+	MaxTimeout       time.Duration
+	MinCheckInterval time.Duration
+	MaxCheckInterval time.Duration
 }
 
-// Response is an interface having five methods, CheckResponse for instance implements this interface.
+// Response is an interface having seven methods, CheckResponse for instance implements this interface.
+// ErrorClass is empty when the response is accepted, otherwise one of the ErrorClass constants.
+// Digest is the hash of the body, empty when content hashing is disabled.
 type Response interface {
 	Timestamp() int64
 	HttpStatusCode() int
 	ResponseTime() time.Duration
 	ContentLength() int64
 	Status() string
+	ErrorClass() string
+	Digest() string
+}
+
+// CertificateResponse is implemented by responses knowing when the certificate of their https url expires.
+// CertificateExpiry is zero for plain http urls and failed requests.
+type CertificateResponse interface {
+	CertificateExpiry() time.Time
 }
 
 // Alerts status is a struct pairing every availability and timestamp.
@@ -35,8 +126,73 @@ type AlertStatus struct {
 	Availability float64
 }
 
-// Alerts is a truct holding an array of Alert Status and bool display (true needs to display, false no).
+// AlertEvent is a transition of an alert other than availability: it started firing or got resolved.
+type AlertEvent struct {
+	Timestamp time.Time
+	Kind      string
+	Name      string
+	Value     float64
+	Firing    bool
+}
+
+// Incident is a period an instance was down, from a down alert to the resume alert.
+// End is zero while the incident is ongoing.
+type Incident struct {
+	Start           time.Time
+	End             time.Time
+	MinAvailability float64
+	ErrorClasses    map[string]int // Failed responses count per error class seen during the incident
+	Notes           []IncidentNote // Written by the operators, shown on the status page
+}
+
+// IncidentNote is a message of an operator about an incident, e.g. its cause or the fix being deployed.
+type IncidentNote struct {
+	Timestamp time.Time
+	Text      string
+}
+
+// Ongoing tells whether the instance has not resumed yet.
+func (incident Incident) Ongoing() bool {
+	return incident.End.IsZero()
+}
+
+// Duration returns how long the incident lasted, until now if it is ongoing.
+func (incident Incident) Duration(now time.Time) time.Duration {
+	if incident.Ongoing() {
+		return now.Sub(incident.Start)
+	}
+	return incident.End.Sub(incident.Start)
+}
+
+// Alerts is a truct holding an array of Alert Status, the other alerts events and bool display (true needs to display, false no).
 type Alerts struct {
 	Alerts  []AlertStatus
+	Events  []AlertEvent
 	Display bool
 }
+
+// Down tells whether the last availability alert of the instance is a down alert.
+func (alerts Alerts) Down() bool {
+	n := len(alerts.Alerts)
+	return n > 0 && alerts.Alerts[n-1].Availability < AvaiabilityThreshold
+}
+
+// Firing returns the last event of every alert still firing sorted by name.
+func (alerts Alerts) Firing() []AlertEvent {
+	lastEvents := make(map[string]AlertEvent)
+	var names []string
+	for _, event := range alerts.Events {
+		if _, ok := lastEvents[event.Name]; !ok {
+			names = append(names, event.Name)
+		}
+		lastEvents[event.Name] = event
+	}
+	sort.Strings(names)
+	var firing []AlertEvent
+	for _, name := range names {
+		if lastEvents[name].Firing {
+			firing = append(firing, lastEvents[name])
+		}
+	}
+	return firing
+}
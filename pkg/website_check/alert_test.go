@@ -73,7 +73,7 @@ func TestAlertsAlwaysDown(t *testing.T) {
 
 	// Run the instance for 10 seconds
 	checkRequestAlwaysDown.RunForXSeconds(10 * time.Second)
-	alerts := safeStore.GetUrlAlerts(url)
+	alerts := safeStore.GetInstanceAlerts(alwaysDown)
 	// This instance is always down it should have only one alert that it was down.
 	if len(alerts.Alerts) != alwaysDownAlertsCount {
 		t.Errorf("Failed to find the right number of alerts got %d; want %d", len(alerts.Alerts), alwaysDownAlertsCount)
@@ -114,7 +114,7 @@ func TestAlertsAlwaysUp(t *testing.T) {
 	}
 	// Run the instance for 10 seconds
 	checkRequestAlwaysUp.RunForXSeconds(10 * time.Second)
-	alerts := safeStore.GetUrlAlerts(url)
+	alerts := safeStore.GetInstanceAlerts(alwaysUp)
 	// This instance should have 1 alerts saying it up and not changing.
 	if len(alerts.Alerts) != alwaysUpAlertsCount {
 		t.Errorf("Failed to find the right number of alerts got %d; want %d", len(alerts.Alerts), alwaysUpAlertsCount)
@@ -151,7 +151,7 @@ func TestAlertsDownUp(t *testing.T) {
 	}
 	// Run the instance for 60 seconds
 	checkRequestDownUp.RunForXSeconds(60 * time.Second)
-	alerts := safeStore.GetUrlAlerts(url)
+	alerts := safeStore.GetInstanceAlerts(downUp)
 	// This instance should 4 alerts since it fails and resumes twice.
 	if len(alerts.Alerts) != downUpAlertsCount {
 		t.Errorf("Failed to find the right number of alerts got %d; want %d", len(alerts.Alerts), downUpAlertsCount)
@@ -0,0 +1,81 @@
+package website_check
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bounds are the accepted ranges of the timeouts and check intervals of the instances.
+type Bounds struct {
+	MinTimeout       time.Duration
+	MaxTimeout       time.Duration
+	MinCheckInterval time.Duration
+	MaxCheckInterval time.Duration
+}
+
+// DefaultBounds are the bounds the instances are validated against unless SetBounds is called.
+var DefaultBounds = Bounds{
+	MinTimeout:       100 * time.Millisecond,
+	MaxTimeout:       20 * time.Second,
+	MinCheckInterval: 5 * time.Second,
+	MaxCheckInterval: 2 * time.Minute,
+}
+
+var (
+	boundsLock sync.RWMutex
+	bounds     = DefaultBounds
+)
+
+// SetBounds sets the bounds the instances are validated against from now on, instances validated already are kept.
+// Returns ErrBoundsNotValid if a bound is not positive or a minimum is above its maximum.
+func SetBounds(b Bounds) error {
+	if b.MinTimeout <= 0 || b.MinCheckInterval <= 0 || b.MinTimeout > b.MaxTimeout || b.MinCheckInterval > b.MaxCheckInterval {
+		return ErrBoundsNotValid
+	}
+	boundsLock.Lock()
+	defer boundsLock.Unlock()
+	bounds = b
+	return nil
+}
+
+// GetBounds returns the bounds the instances are validated against.
+func GetBounds() Bounds {
+	boundsLock.RLock()
+	defer boundsLock.RUnlock()
+	return bounds
+}
+
+// Returns the timeout of an instance not setting one: the default one within the bounds.
+// Returns error if the timeout is not within the bounds.
+func (b Bounds) timeout(timeout time.Duration) (time.Duration, error) {
+	if timeout == 0 {
+		return clamp(defaultTimeout, b.MinTimeout, b.MaxTimeout), nil
+	}
+	if timeout < b.MinTimeout || timeout > b.MaxTimeout {
+		return timeout, fmt.Errorf("%w [%v,%v]", ErrTimeOutNowNotInInterval, b.MinTimeout, b.MaxTimeout)
+	}
+	return timeout, nil
+}
+
+// Returns the check interval of an instance not setting one: the default one within the bounds.
+// Returns error if the check interval is not within the bounds.
+func (b Bounds) checkInterval(checkInterval time.Duration) (time.Duration, error) {
+	if checkInterval == 0 {
+		return clamp(defaultCheckInterval, b.MinCheckInterval, b.MaxCheckInterval), nil
+	}
+	if checkInterval < b.MinCheckInterval || checkInterval > b.MaxCheckInterval {
+		return checkInterval, fmt.Errorf("%w [%v,%v]", ErrCheckIntervalNotInInterval, b.MinCheckInterval, b.MaxCheckInterval)
+	}
+	return checkInterval, nil
+}
+
+func clamp(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
@@ -2,28 +2,41 @@ package website_check
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/Dainerx/wpam/pkg/logger"
 	"github.com/Dainerx/wpam/pkg/safe_store"
+	"github.com/Dainerx/wpam/pkg/stat"
 	"github.com/Dainerx/wpam/pkg/types"
 )
 
 var (
+	tagKey               = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 	httpMethods          = []string{types.HTTPGet, types.HTTPHead, types.HTTPPost, types.HTTPPut, types.HTTPDelete, types.HTTPOptions, types.HTTPTrace}
 	httpMethodsSupported = []string{types.HTTPGet, types.HTTPPost}
+	ruleOperators        = []string{types.OperatorAbove, types.OperatorAboveOrEqual, types.OperatorBelow, types.OperatorBelowOrEqual}
 )
 
 const (
 	PKG              = "website_check"
-	maxTimeOut       = (20 * time.Second)
-	minTimeOut       = (1 * time.Second)
-	maxCheckInterval = (2 * time.Minute)
-	minCheckInterval = (5 * time.Second)
+	defaultTimeout       = (10 * time.Second)
+	defaultCheckInterval = (10 * time.Second)
+	maxBodySize          = 10 << 20 // Bodies are read up to 10MB
+	maxSloWindowDays     = 365      // Availability over the window is computed from rollups kept a year by default
+	minSloWindowDays     = 1
 )
 
 //add default values for mashling
@@ -35,6 +48,16 @@ type CheckRequest struct {
 	httpAcceptedResponseStatusCode []int //if it is not here then it is down
 	checkInterval                  time.Duration
 	data                           map[string]interface{}
+	rules                          []types.Rule
+	apdexT                         float64
+	slo                            types.Slo
+	anomalyDeviations              float64
+	tags                           []string
+	paused                         bool
+	group                          string
+	content                        types.Content
+	contentIgnore                  []*regexp.Regexp
+	contentExpect                  *regexp.Regexp
 	netClient                      *http.Client
 	store                          *safe_store.SafeStore
 	firstRequest                   bool
@@ -55,10 +78,11 @@ func NewCheckRequest(id, url string) CheckRequest {
 	checkRequest.id = id
 	checkRequest.url = url
 	checkRequest.httpMethod = types.HTTPGet
-	checkRequest.timeout = time.Duration(10 * time.Second)
+	checkRequest.timeout = defaultTimeout
 	checkRequest.httpAcceptedResponseStatusCode = append(checkRequest.httpAcceptedResponseStatusCode, http.StatusOK)
-	checkRequest.checkInterval = time.Duration(10 * time.Second)
+	checkRequest.checkInterval = defaultCheckInterval
 	checkRequest.data = make(map[string]interface{})
+	checkRequest.apdexT = types.DefaultApdexT
 	checkRequest.netClient = &http.Client{
 		Timeout: checkRequest.timeout,
 	}
@@ -91,29 +115,76 @@ func NewcheckRequestFromInstance(instance types.Instance, store *safe_store.Safe
 	if !findString(httpMethodsSupported, checkRequest.httpMethod) {
 		return checkRequest, ErrHttpMethodNotSupported
 	}
-	if instance.Timeout == time.Duration(0*time.Second) {
-		checkRequest.timeout = time.Duration(10 * time.Second)
-	} else {
-		checkRequest.timeout = instance.Timeout
-		if checkRequest.timeout > maxTimeOut || checkRequest.timeout < minTimeOut {
-			return checkRequest, ErrTimeOutNowNotInInterval
-		}
+	bounds := GetBounds()
+	var err error
+	if checkRequest.timeout, err = bounds.timeout(instance.Timeout); err != nil {
+		return checkRequest, err
 	}
 	if len(instance.HttpAcceptedResponseStatusCode) == 0 {
 		checkRequest.httpAcceptedResponseStatusCode = []int{http.StatusOK}
 	} else {
 		checkRequest.httpAcceptedResponseStatusCode = instance.HttpAcceptedResponseStatusCode
 	}
-	if instance.CheckInterval == time.Duration(0*time.Second) {
-		checkRequest.checkInterval = time.Duration(10 * time.Second)
+	if checkRequest.checkInterval, err = bounds.checkInterval(instance.CheckInterval); err != nil {
+		return checkRequest, err
+	}
+	checkRequest.data = instance.Data
+	for _, rule := range instance.Rules {
+		if _, err := (stat.Stat{}).Metric(rule.Metric); err != nil || !findString(ruleOperators, rule.Operator) {
+			return checkRequest, ErrRuleNotValid
+		}
+	}
+	checkRequest.rules = instance.Rules
+	if instance.ApdexT == 0 {
+		checkRequest.apdexT = types.DefaultApdexT
+	} else if instance.ApdexT < 0 {
+		return checkRequest, ErrApdexTNotValid
 	} else {
-		checkRequest.checkInterval = instance.CheckInterval //converts to seconds
-		if checkRequest.checkInterval > maxCheckInterval || checkRequest.checkInterval < minCheckInterval {
-			return checkRequest, ErrCheckIntervalNotInInterval
+		checkRequest.apdexT = instance.ApdexT
+	}
+	if instance.AnomalyDeviations < 0 {
+		return checkRequest, ErrAnomalyDeviationsNotValid
+	}
+	checkRequest.anomalyDeviations = instance.AnomalyDeviations
+	tagKeys := map[string]bool{} // A key used twice would be a duplicated label of the exported metrics
+	for _, tag := range instance.Tags {
+		key := strings.SplitN(tag, ":", 2)[0]
+		if !tagKey.MatchString(key) || tagKeys[key] {
+			return checkRequest, ErrTagNotValid
+		}
+		tagKeys[key] = true
+	}
+	checkRequest.tags = instance.Tags
+	checkRequest.paused = instance.Paused
+	checkRequest.group = instance.Group
+	if instance.Content.LengthDeviation < 0 {
+		return checkRequest, ErrContentNotValid
+	}
+	for _, pattern := range instance.Content.Ignore {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return checkRequest, ErrContentNotValid
+		}
+		checkRequest.contentIgnore = append(checkRequest.contentIgnore, re)
+	}
+	if instance.Content.Expect != "" {
+		re, err := regexp.Compile(instance.Content.Expect)
+		if err != nil {
+			return checkRequest, ErrContentNotValid
+		}
+		checkRequest.contentExpect = re
+	}
+	checkRequest.content = instance.Content
+	checkRequest.slo = instance.Slo
+	if instance.Slo.Target != 0 {
+		if instance.Slo.WindowDays == 0 {
+			checkRequest.slo.WindowDays = types.DefaultSloWindowDays
+		}
+		if checkRequest.slo.Target <= 0 || checkRequest.slo.Target >= 100 ||
+			checkRequest.slo.WindowDays > maxSloWindowDays || checkRequest.slo.WindowDays < minSloWindowDays {
+			return checkRequest, ErrSloNotValid
 		}
-
 	}
-	checkRequest.data = instance.Data
 	checkRequest.netClient = &http.Client{
 		Timeout: checkRequest.timeout,
 	}
@@ -131,49 +202,133 @@ func (checkRequest CheckRequest) Url() string {
 	return checkRequest.url
 }
 
-func (checkRequest CheckRequest) doRequest() (*http.Response, error) {
+// Instance returns the validated instance behind the check request, defaults included.
+func (checkRequest CheckRequest) Instance() types.Instance {
+	return types.Instance{
+		Id:                             checkRequest.id,
+		Url:                            checkRequest.url,
+		HttpMethod:                     checkRequest.httpMethod,
+		Timeout:                        checkRequest.timeout,
+		HttpAcceptedResponseStatusCode: checkRequest.httpAcceptedResponseStatusCode,
+		CheckInterval:                  checkRequest.checkInterval,
+		Data:                           checkRequest.data,
+		Rules:                          checkRequest.rules,
+		ApdexT:                         checkRequest.apdexT,
+		Slo:                            checkRequest.slo,
+		AnomalyDeviations:              checkRequest.anomalyDeviations,
+		Content:                        checkRequest.content,
+		Tags:                           checkRequest.tags,
+		Paused:                         checkRequest.paused,
+		Group:                          checkRequest.group,
+	}
+}
+
+// Sends the request, handshakeFailed tells whether the TLS handshake with the server failed.
+func (checkRequest CheckRequest) doRequest() (res *http.Response, handshakeFailed bool, err error) {
+	var failed atomic.Bool // The handshake may end after the request timed out
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				failed.Store(true)
+			}
+		},
+	}
+	ctx := httptrace.WithClientTrace(context.Background(), trace)
+	var req *http.Request
 	switch checkRequest.httpMethod {
 	case types.HTTPPost:
 		requestBody, err := json.Marshal(checkRequest.data)
 		if err != nil {
-			return nil, err
+			return nil, false, err
+		}
+		if req, err = http.NewRequestWithContext(ctx, http.MethodPost, checkRequest.url, bytes.NewBuffer(requestBody)); err != nil {
+			return nil, false, err
 		}
-		return checkRequest.netClient.Post(checkRequest.url, "application/json", bytes.NewBuffer(requestBody))
+		req.Header.Set("Content-Type", "application/json")
 	case types.HTTPGet:
-		return checkRequest.netClient.Get(checkRequest.url)
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, checkRequest.url, nil); err != nil {
+			return nil, false, err
+		}
 	default: // Will never be reached on runtime, since the HttpMethod check happens on configuration's parsing.
-		return nil, ErrHttpMethodNotRecognized
+		return nil, false, ErrHttpMethodNotRecognized
 	}
+	res, err = checkRequest.netClient.Do(req)
+	return res, failed.Load(), err
 }
 
 // Returns Response with Status DOWN when any of the following occur:
-// - The request to url times out.
-// - The response code is not in the httpAcceptedResponseStatusCode slice
+// - The request to url fails (times out, dns failure, connection refused, tls error...), its error class tells why.
+// - The response code is not in the httpAcceptedResponseStatusCode slice, its error class is bad_status.
+// - The body does not match the content's expect pattern, its error class is assertion_failed.
 // Otherwise returns Response with Status UP.
+// The body is always read, its length is used when the Content-Length header is missing.
 func (checkRequest *CheckRequest) Response() (CheckResponse, error) {
 	start := time.Now()
-	res, err := checkRequest.doRequest()
+	res, handshakeFailed, err := checkRequest.doRequest()
 	if err != nil {
 		checkResponse := NewCheckResponse(-1, 0, -1)
 		checkResponse.status = types.Down
-		logger.Logger.Warnf("Website is %s, reason: %v", checkResponse.status, err)
+		checkResponse.errorClass = classifyError(err, handshakeFailed)
+		logger.Logger.Warnf("Website %s (%s) is %s, error_class=%s, reason: %v", checkRequest.id, checkRequest.url, checkResponse.status, checkResponse.errorClass, err)
 		return *checkResponse, err
 	}
 	responseTime := time.Since(start)
 	httpResponseStatusCode := res.StatusCode
-	checkResponse := NewCheckResponse(httpResponseStatusCode, responseTime, res.ContentLength)
+	contentLength, digest, expected, err := checkRequest.readBody(res.Body)
+	if err != nil {
+		logger.Logger.Warnf("Website %s (%s) body could not be read: %v", checkRequest.id, checkRequest.url, err)
+	}
+	if res.ContentLength >= 0 {
+		contentLength = res.ContentLength
+	}
+	checkResponse := NewCheckResponse(httpResponseStatusCode, responseTime, contentLength)
+	checkResponse.digest = digest
+	if res.TLS != nil && len(res.TLS.PeerCertificates) > 0 { // The first one is the server's certificate
+		checkResponse.certificateExpiry = res.TLS.PeerCertificates[0].NotAfter
+	}
 	//Add an if statement for when the http method is not reconigzed
-	if checkResponse.matchesAcceptedCodes(checkRequest.httpAcceptedResponseStatusCode) {
-		checkResponse.status = types.Up
-		logger.Logger.Infof("Website %s is %s, with http_response_status_code=%d, took %v s to respond", checkRequest.url, checkResponse.status, checkResponse.httpStatusCode, checkResponse.responseTime.Seconds())
-	} else {
+	if !checkResponse.matchesAcceptedCodes(checkRequest.httpAcceptedResponseStatusCode) {
+		checkResponse.status = types.Down
+		checkResponse.errorClass = types.ErrorClassBadStatus
+		logger.Logger.Infof("Website %s (%s) is %s with http_code = %d, error_class=%s", checkRequest.id, checkRequest.url, checkResponse.status, checkResponse.httpStatusCode, checkResponse.errorClass)
+	} else if !expected {
 		checkResponse.status = types.Down
-		logger.Logger.Infof("Website %s is %s with http_code = %d", checkRequest.url, checkResponse.status, checkResponse.httpStatusCode)
+		checkResponse.errorClass = types.ErrorClassAssertionFailed
+		logger.Logger.Infof("Website %s (%s) is %s, its body does not match %s, error_class=%s", checkRequest.id, checkRequest.url, checkResponse.status, checkRequest.contentExpect, checkResponse.errorClass)
+	} else {
+		checkResponse.status = types.Up
+		logger.Logger.Infof("Website %s (%s) is %s, with http_response_status_code=%d, took %v s to respond", checkRequest.id, checkRequest.url, checkResponse.status, checkResponse.httpStatusCode, checkResponse.responseTime.Seconds())
 	}
 	// Update Last check
 	return *checkResponse, nil
 }
 
+// Reads and closes a response's body, returns the length read, the body's digest if content hashing is enabled
+// and whether the body matches the expect pattern, always true without one.
+// The digest is the hex encoded sha256 of the body once the ignored patterns are stripped.
+func (checkRequest *CheckRequest) readBody(body io.ReadCloser) (length int64, digest string, expected bool, err error) {
+	defer body.Close()
+	if !checkRequest.content.Hash && checkRequest.contentExpect == nil {
+		// Drained so that the connection can be reused
+		n, err := io.Copy(ioutil.Discard, io.LimitReader(body, maxBodySize))
+		return n, "", true, err
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		return int64(len(content)), "", true, err
+	}
+	length = int64(len(content))
+	expected = checkRequest.contentExpect == nil || checkRequest.contentExpect.Match(content)
+	if !checkRequest.content.Hash {
+		return length, "", expected, nil
+	}
+	for _, re := range checkRequest.contentIgnore {
+		content = re.ReplaceAll(content, nil)
+	}
+	sum := sha256.Sum256(content)
+	return length, hex.EncodeToString(sum[:]), expected, nil
+}
+
 // Does a firstRequest if checkRequest.firstRequest has false as value
 // Otherwise enter an infinite loop, fetch a response put in the safe store.
 // Stops when the channel when the checkRequest.stop channel is unlocked through the Stop() method.
@@ -181,16 +336,27 @@ func (checkRequest *CheckRequest) Run() {
 	// If it is the first request do it instantly to feed data to the store
 	if checkRequest.firstRequest {
 		checkResponse, _ := checkRequest.Response()
-		checkRequest.store.Put(checkRequest.url, checkResponse)
+		select {
+		case <-checkRequest.stop: // Stopped during the check, the instance may be deleted already
+			return
+		default:
+		}
+		checkRequest.store.Put(checkRequest.id, checkResponse)
 		checkRequest.firstRequest = false
 	}
 	ticker := time.NewTicker(checkRequest.checkInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			checkResponse, _ := checkRequest.Response()
-			checkRequest.store.Put(checkRequest.url, checkResponse)
-		case <-checkRequest.stop: // If stop is called this chan is unlocked and the infinite loop is exited
+			select {
+			case <-checkRequest.stop: // Stopped during the check, the instance may be deleted already
+				return
+			default:
+			}
+			checkRequest.store.Put(checkRequest.id, checkResponse)
+		case <-checkRequest.stop: // If stop is called this chan is closed and the infinite loop is exited
 			logger.Logger.Errorf("check request stopped!")
 			return
 		}
@@ -205,7 +371,7 @@ func (checkRequest *CheckRequest) RunForXSeconds(x time.Duration) {
 		if err != nil {
 			logger.Logger.Errorf("%v", err)
 		}
-		checkRequest.store.Put(checkRequest.url, checkResponse)
+		checkRequest.store.Put(checkRequest.id, checkResponse)
 		checkRequest.firstRequest = false
 	}
 	ticker := time.NewTicker(checkRequest.checkInterval)
@@ -217,14 +383,15 @@ func (checkRequest *CheckRequest) RunForXSeconds(x time.Duration) {
 			if err != nil {
 				logger.Logger.Errorf("%v", err)
 			}
-			checkRequest.store.Put(checkRequest.url, checkResponse)
+			checkRequest.store.Put(checkRequest.id, checkResponse)
 		case <-stopTime.C: // Stop after X seconds
 			return
 		}
 	}
 }
 
-// Unlocks the stop channel.
+// Closes the stop channel, returns right away even if a check is in flight: its response is dropped.
+// Must be called once.
 func (checkRequest *CheckRequest) Stop() {
-	checkRequest.stop <- true
+	close(checkRequest.stop)
 }
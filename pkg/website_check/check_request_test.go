@@ -1,6 +1,7 @@
 package website_check
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"testing"
@@ -143,3 +144,132 @@ func TestCheckIntervalValidation(t *testing.T) {
 		t.Errorf("CheckInterval validation failed got %v; want %v", err, ErrCheckIntervalNotInInterval)
 	}
 }
+
+func TestBounds(t *testing.T) {
+	if err := SetBounds(Bounds{MinTimeout: 2 * time.Second, MaxTimeout: time.Second, MinCheckInterval: time.Second, MaxCheckInterval: time.Minute}); err != ErrBoundsNotValid {
+		t.Errorf("SetBounds() = %v; want %v", err, ErrBoundsNotValid)
+	}
+	if err := SetBounds(Bounds{MinTimeout: time.Second, MaxTimeout: 5 * time.Second, MinCheckInterval: time.Second, MaxCheckInterval: 30 * time.Second}); err != nil {
+		t.Fatalf("SetBounds() failed: %v", err)
+	}
+	defer SetBounds(DefaultBounds)
+	instance := types.Instance{Id: "google", Url: "http://google.com", CheckInterval: 2 * time.Second}
+	checkRequest, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{})
+	if err != nil {
+		t.Fatalf("NewcheckRequestFromInstance() failed: %v", err)
+	}
+	if checkRequest.timeout != 5*time.Second || checkRequest.checkInterval != 2*time.Second {
+		t.Errorf("Timeout %v, check interval %v; want the default timeout within the bounds and 2s", checkRequest.timeout, checkRequest.checkInterval)
+	}
+	instance.CheckInterval = time.Minute
+	if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); !errors.Is(err, ErrCheckIntervalNotInInterval) {
+		t.Errorf("NewcheckRequestFromInstance() = %v; want %v", err, ErrCheckIntervalNotInInterval)
+	}
+}
+
+func TestRuleValidation(t *testing.T) {
+	instance := types.Instance{
+		Id:            "google",
+		Url:           "http://google.com",
+		CheckInterval: time.Second * 10,
+		Rules:         []types.Rule{{Metric: "p95_rt", Operator: types.OperatorAbove, Threshold: 2.5}},
+	}
+	if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != nil {
+		t.Errorf("Rule validation failed got %v; want %v", err, nil)
+	}
+	instance.Rules = []types.Rule{{Metric: "not_a_metric", Operator: types.OperatorAbove, Threshold: 2.5}}
+	if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != ErrRuleNotValid {
+		t.Errorf("Rule validation failed got %v; want %v", err, ErrRuleNotValid)
+	}
+	instance.Rules = []types.Rule{{Metric: "p95_rt", Operator: "!=", Threshold: 2.5}}
+	if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != ErrRuleNotValid {
+		t.Errorf("Rule validation failed got %v; want %v", err, ErrRuleNotValid)
+	}
+}
+
+func TestApdexTValidation(t *testing.T) {
+	instance := types.Instance{
+		Id:            "google",
+		Url:           "http://google.com",
+		CheckInterval: time.Second * 10,
+	}
+	checkRequest, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{})
+	if err != nil || checkRequest.Instance().ApdexT != types.DefaultApdexT {
+		t.Errorf("ApdexT validation failed got %v, %f; want %v, %f", err, checkRequest.Instance().ApdexT, nil, types.DefaultApdexT)
+	}
+	instance.ApdexT = -1
+	if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != ErrApdexTNotValid {
+		t.Errorf("ApdexT validation failed got %v; want %v", err, ErrApdexTNotValid)
+	}
+}
+
+func TestSloValidation(t *testing.T) {
+	instance := types.Instance{
+		Id:            "google",
+		Url:           "http://google.com",
+		CheckInterval: time.Second * 10,
+		Slo:           types.Slo{Target: 99.9},
+	}
+	checkRequest, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{})
+	if err != nil || checkRequest.Instance().Slo.WindowDays != types.DefaultSloWindowDays {
+		t.Errorf("Slo validation failed got %v, %d days; want %v, %d days", err, checkRequest.Instance().Slo.WindowDays, nil, types.DefaultSloWindowDays)
+	}
+	for _, slo := range []types.Slo{{Target: 100}, {Target: -1}, {Target: 99, WindowDays: 400}} {
+		instance.Slo = slo
+		if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != ErrSloNotValid {
+			t.Errorf("Slo validation of %+v failed got %v; want %v", slo, err, ErrSloNotValid)
+		}
+	}
+}
+
+func TestAnomalyDeviationsValidation(t *testing.T) {
+	instance := types.Instance{
+		Id:                "google",
+		Url:               "http://google.com",
+		CheckInterval:     time.Second * 10,
+		AnomalyDeviations: 3,
+	}
+	if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != nil {
+		t.Errorf("AnomalyDeviations validation failed got %v; want %v", err, nil)
+	}
+	instance.AnomalyDeviations = -3
+	if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != ErrAnomalyDeviationsNotValid {
+		t.Errorf("AnomalyDeviations validation failed got %v; want %v", err, ErrAnomalyDeviationsNotValid)
+	}
+}
+
+func TestContentValidation(t *testing.T) {
+	instance := types.Instance{
+		Id:            "google",
+		Url:           "http://google.com",
+		CheckInterval: time.Second * 10,
+		Content:       types.Content{Hash: true, Ignore: []string{`\d+`}, Expect: `<title>Google</title>`},
+	}
+	if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != nil {
+		t.Errorf("Content validation failed got %v; want %v", err, nil)
+	}
+	for _, content := range []types.Content{{Ignore: []string{`(`}}, {Expect: `[`}, {LengthDeviation: -1}} {
+		instance.Content = content
+		if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != ErrContentNotValid {
+			t.Errorf("Content validation of %+v failed got %v; want %v", content, err, ErrContentNotValid)
+		}
+	}
+}
+
+func TestTagValidation(t *testing.T) {
+	instance := types.Instance{
+		Id:            "google",
+		Url:           "http://google.com",
+		CheckInterval: time.Second * 10,
+		Tags:          []string{"env:prod", "team:a", "critical"},
+	}
+	if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != nil {
+		t.Errorf("Tag validation failed got %v; want %v", err, nil)
+	}
+	for _, tags := range [][]string{{"team-name:a"}, {"team:a", "team:b"}, {"critical", "critical:yes"}} {
+		instance.Tags = tags
+		if _, err := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{}); err != ErrTagNotValid {
+			t.Errorf("Tag validation of %q failed got %v; want %v", tags, err, ErrTagNotValid)
+		}
+	}
+}
@@ -7,11 +7,14 @@ import (
 )
 
 type CheckResponse struct {
-	timestamp      int64
-	httpStatusCode int
-	responseTime   time.Duration
-	contentLength  int64
-	status         string
+	timestamp         int64
+	httpStatusCode    int
+	responseTime      time.Duration
+	contentLength     int64
+	status            string
+	errorClass        string
+	digest            string
+	certificateExpiry time.Time
 }
 
 func NewCheckResponse(httpStatusCode int, responseTime time.Duration, contentLength int64) *CheckResponse {
@@ -24,14 +27,20 @@ func NewCheckResponse(httpStatusCode int, responseTime time.Duration, contentLen
 }
 
 func NewCheckResponseWithStatus(httpAcceptedResponseStatusCode []int, httpStatusCode int, responseTime time.Duration, contentLength int64) *CheckResponse {
+	return NewCheckResponseAt(time.Now(), httpAcceptedResponseStatusCode, httpStatusCode, responseTime, contentLength)
+}
+
+// NewCheckResponseAt behaves like NewCheckResponseWithStatus for a response received at timestamp, e.g. replayed history.
+func NewCheckResponseAt(timestamp time.Time, httpAcceptedResponseStatusCode []int, httpStatusCode int, responseTime time.Duration, contentLength int64) *CheckResponse {
 	checkResponse := &CheckResponse{}
-	checkResponse.timestamp = time.Now().UnixNano()
+	checkResponse.timestamp = timestamp.UnixNano()
 	checkResponse.httpStatusCode = httpStatusCode
 	checkResponse.responseTime = responseTime
 	if checkResponse.matchesAcceptedCodes(httpAcceptedResponseStatusCode) {
 		checkResponse.status = types.Up
 	} else {
 		checkResponse.status = types.Down
+		checkResponse.errorClass = types.ErrorClassBadStatus
 	}
 	checkResponse.contentLength = contentLength
 	return checkResponse
@@ -57,6 +66,18 @@ func (checkResponse CheckResponse) Status() string {
 	return checkResponse.status
 }
 
+func (checkResponse CheckResponse) ErrorClass() string {
+	return checkResponse.errorClass
+}
+
+func (checkResponse CheckResponse) Digest() string {
+	return checkResponse.digest
+}
+
+func (checkResponse CheckResponse) CertificateExpiry() time.Time {
+	return checkResponse.certificateExpiry
+}
+
 // matchesAcceptedCodes tells wether an url is up depending on the checkRequest httpAcceptedResponseStatusCodes
 // And checkResponseesponse Http_status_code
 // It returns true if checkResponseesponse.Http_status_code is in checkRequest.httpAcceptedResponseStatusCode.
@@ -1,9 +1,15 @@
 package website_check
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -132,3 +138,133 @@ func TestResponseAgainstTimeOut(t *testing.T) {
 	}
 
 }
+
+// Test the error class of failed responses.
+func TestResponseErrorClass(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(alwaysDownUrlHandler),
+	)
+	defer ts.Close()
+	tlsTs := httptest.NewTLSServer(
+		http.HandlerFunc(getHandler),
+	)
+	defer tlsTs.Close()
+	oldTlsTs := httptest.NewUnstartedServer(
+		http.HandlerFunc(getHandler),
+	)
+	oldTlsTs.TLS = &tls.Config{MaxVersion: tls.VersionTLS10}
+	oldTlsTs.StartTLS()
+	defer oldTlsTs.Close()
+	okTs := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html>Maintenance</html>"))
+		}),
+	)
+	defer okTs.Close()
+	closedTs := httptest.NewServer(
+		http.HandlerFunc(getHandler),
+	)
+	closedTs.Close()
+
+	tests := []struct {
+		url     string
+		timeout time.Duration
+		expect  string
+		want    string
+	}{
+		{ts.URL, time.Second, "", types.ErrorClassBadStatus},
+		{tlsTs.URL, time.Second, "", types.ErrorClassTls},    // Certificate signed by an unknown authority
+		{oldTlsTs.URL, time.Second, "", types.ErrorClassTls}, // Protocol version rejected by an alert of the server
+		{okTs.URL, time.Second, "<title>", types.ErrorClassAssertionFailed},
+		{closedTs.URL, time.Second, "", types.ErrorClassConnectionRefused},
+		{ts.URL, time.Nanosecond, "", types.ErrorClassTimeout},
+	}
+	for _, test := range tests {
+		instance := types.Instance{
+			Id:      "TestResponseErrorClass",
+			Url:     test.url,
+			Content: types.Content{Expect: test.expect},
+		}
+		checkRequest, _ := NewcheckRequestFromInstance(instance, &safe_store.SafeStore{})
+		checkRequest.netClient.Timeout = test.timeout // Bad way to access it
+		got, _ := checkRequest.Response()
+		if got.Status() != types.Down || got.ErrorClass() != test.want {
+			t.Errorf("checkRequest.Response() on %s = %s, %s; want %s, %s", test.url, got.Status(), got.ErrorClass(), types.Down, test.want)
+		}
+	}
+
+	dnsError := &url.Error{Op: "Get", URL: "http://unknown.invalid", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "unknown.invalid", IsNotFound: true}}}
+	if got := classifyError(dnsError, false); got != types.ErrorClassDns {
+		t.Errorf("classifyError(%v) = %s; want %s", dnsError, got, types.ErrorClassDns)
+	}
+	// Most handshake failures are plain errors, told by the handshake trace of the request
+	handshakeError := &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("tls: handshake failure")}
+	if got := classifyError(handshakeError, true); got != types.ErrorClassTls {
+		t.Errorf("classifyError(%v) = %s; want %s", handshakeError, got, types.ErrorClassTls)
+	}
+	if got := classifyError(nil, false); got != "" {
+		t.Errorf("classifyError(nil) = %s; want empty", got)
+	}
+}
+
+// Test the body digest and the content change alerts.
+func TestResponseContentChange(t *testing.T) {
+	body := "<html>Version 1 <span id=\"time\">0</span></html>"
+	requests := 0
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			// The time changes on every request, it is ignored
+			w.Write([]byte(strings.Replace(body, ">0<", ">"+strconv.Itoa(requests)+"<", 1)))
+		}),
+	)
+	defer ts.Close()
+	instance := types.Instance{
+		Id:      "TestResponseContentChange",
+		Url:     ts.URL,
+		Content: types.Content{Hash: true, Ignore: []string{`<span id="time">\d+</span>`}},
+	}
+	store := safe_store.New()
+	checkRequest, err := NewcheckRequestFromInstance(instance, store)
+	if err != nil {
+		t.Fatalf("NewcheckRequestFromInstance() failed: %v", err)
+	}
+	store.Register(checkRequest.Instance())
+	put := func() CheckResponse {
+		checkResponse, err := checkRequest.Response()
+		if err != nil {
+			t.Fatalf("checkRequest.Response() failed: %v", err)
+		}
+		store.Put(instance.Id, checkResponse)
+		return checkResponse
+	}
+	first, second := put(), put()
+	if first.Digest() == "" || first.Digest() != second.Digest() || first.ContentLength() != int64(len(body)) {
+		t.Errorf("Digests = %s, %s and length %d; want the same digests and length %d", first.Digest(), second.Digest(), first.ContentLength(), len(body))
+	}
+	body = "<html>Defaced</html>"
+	put()
+	put() // Still firing while the page is defaced
+	got := store.GetInstanceAlerts(instance.Id).Events
+	if len(got) != 1 || !got[0].Firing || got[0].Kind != types.AlertKindContent {
+		t.Errorf("store.GetInstanceAlerts().Events = %+v; want one firing content event", got)
+	}
+	body = "<html>Version 1 <span id=\"time\">0</span></html>"
+	put()
+	if got = store.GetInstanceAlerts(instance.Id).Events; len(got) != 2 || got[1].Firing {
+		t.Errorf("store.GetInstanceAlerts().Events = %+v; want the content event resolved once the content is back", got)
+	}
+	// A new content stable for long enough is the baseline, e.g. a deploy
+	body = "<html>Version 2</html>"
+	for i := 0; i < 10; i++ {
+		put()
+	}
+	if got = store.GetInstanceAlerts(instance.Id).Events; len(got) != 4 || !got[2].Firing || got[3].Firing {
+		t.Errorf("store.GetInstanceAlerts().Events = %+v; want the content event firing then resolved by the new baseline", got)
+	}
+
+	instance.Content.Ignore = []string{"("}
+	if _, err := NewcheckRequestFromInstance(instance, store); err != ErrContentNotValid {
+		t.Errorf("Content validation failed got %v; want %v", err, ErrContentNotValid)
+	}
+}
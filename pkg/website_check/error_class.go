@@ -0,0 +1,54 @@
+package website_check
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/Dainerx/wpam/pkg/types"
+)
+
+// Operation of the net.OpError wrapping an alert received from the server.
+const tlsRemoteErrorOp = "remote error"
+
+// classifyError returns the error class of a failed request, handshakeFailed tells whether its TLS handshake failed.
+// DNS failures are checked first since a DNS timeout is reported as a timeout too.
+func classifyError(err error, handshakeFailed bool) string {
+	if err == nil {
+		return ""
+	}
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return types.ErrorClassDns
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return types.ErrorClassConnectionRefused
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return types.ErrorClassTimeout
+	}
+	if handshakeFailed || isTlsError(err) {
+		return types.ErrorClassTls
+	}
+	return types.ErrorClassOther
+}
+
+// isTlsError tells whether the error is a TLS one: a certificate verification error, a record not looking like TLS
+// or an alert sent by the server, e.g. rejecting the client's certificate after the handshake.
+// Other handshake failures are plain errors, those are told by the handshake trace of the request.
+func isTlsError(err error) bool {
+	var (
+		verificationError *tls.CertificateVerificationError
+		recordHeaderError tls.RecordHeaderError
+		unknownAuthority  x509.UnknownAuthorityError
+		hostnameError     x509.HostnameError
+		invalidError      x509.CertificateInvalidError
+		opError           *net.OpError
+	)
+	return errors.As(err, &verificationError) || errors.As(err, &recordHeaderError) ||
+		errors.As(err, &unknownAuthority) || errors.As(err, &hostnameError) || errors.As(err, &invalidError) ||
+		(errors.As(err, &opError) && opError.Op == tlsRemoteErrorOp)
+}
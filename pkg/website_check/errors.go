@@ -15,9 +15,32 @@ var (
 	// ErrHttpMethodNotSupported is returned when an instance has a not supported yet HTTP method.
 	ErrHttpMethodNotSupported = errors.New("HTTP method not supported yet.")
 
-	// ErrCheckIntervalNotInInterval is returned when the instance's check interval is not in the range.
-	ErrCheckIntervalNotInInterval = errors.New("Check interval is not in the accepted range [5s,2m]")
+	// ErrCheckIntervalNotInInterval is returned when the instance's check interval is not in the range, the range follows.
+	ErrCheckIntervalNotInInterval = errors.New("Check interval is not in the accepted range")
 
-	// ErrCheckIntervalNotInInterval is returned when the instance's timeout is not in the range.
-	ErrTimeOutNowNotInInterval = errors.New("Timeout is not in the accepted range [1s,20s]")
+	// ErrCheckIntervalNotInInterval is returned when the instance's timeout is not in the range, the range follows.
+	ErrTimeOutNowNotInInterval = errors.New("Timeout is not in the accepted range")
+
+	// ErrBoundsNotValid is returned when a bound of the timeouts or check intervals is not positive or a minimum is
+	// above its maximum.
+	ErrBoundsNotValid = errors.New("Bounds are not valid: minimums must be positive and not above their maximums")
+
+	// ErrApdexTNotValid is returned when an instance's Apdex target time is negative.
+	ErrApdexTNotValid = errors.New("Apdex target time must be positive")
+
+	// ErrSloNotValid is returned when an instance's service level objective is not in the accepted range.
+	ErrSloNotValid = errors.New("SLO target must be in ]0,100[ and its window in [1,365] days")
+
+	// ErrAnomalyDeviationsNotValid is returned when an instance's anomaly sensitivity is negative.
+	ErrAnomalyDeviationsNotValid = errors.New("Anomaly deviations must be positive, 0 disables the detection")
+
+	// ErrContentNotValid is returned when an instance's content ignore or expect pattern does not compile or its length deviation is negative.
+	ErrContentNotValid = errors.New("Content ignore and expect patterns must be valid regular expressions and length deviation positive")
+
+	// ErrTagNotValid is returned when an instance's tag is not key:value or key, with a key made of letters, digits and underscores,
+	// or when its key is used by another tag of the instance.
+	ErrTagNotValid = errors.New("Tag must be key:value or key, the key made of letters, digits and underscores and used once")
+
+	// ErrRuleNotValid is returned when an instance's alert rule has an unknown metric or operator.
+	ErrRuleNotValid = errors.New("Alert rule is not valid, check its metric and operator (>, >=, <, <=)")
 )